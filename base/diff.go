@@ -0,0 +1,46 @@
+package base
+
+// DiffLines compares two texts line by line, the lines of the result are
+// prefixed with "-" if only in a, with "+" if only in b and with " " if in
+// both. The differences are minimal by the longest common subsequence.
+func DiffLines(a []string, b []string) []string {
+	// lcs[i][j] is the length of the longest common subsequence of a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+	rlt := make([]string, 0, len(a)+len(b))
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			rlt = append(rlt, " "+a[i])
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			rlt = append(rlt, "-"+a[i])
+			i++
+		default:
+			rlt = append(rlt, "+"+b[j])
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		rlt = append(rlt, "-"+a[i])
+	}
+	for ; j < len(b); j++ {
+		rlt = append(rlt, "+"+b[j])
+	}
+	return rlt
+}
@@ -2,28 +2,21 @@ package base
 
 import (
 	"fmt"
-	"os"
 	"os/exec"
+	"strconv"
+	"strings"
 
 	log "github.com/sirupsen/logrus"
 )
 
-func Exec(cmd string, args ...string) {
+func Exec(cmd string, args ...string) error {
 	p := exec.Command(cmd, args...)
 	stdout, err := p.CombinedOutput()
 	if err != nil {
-		log.Error("error executing command: ", cmd)
-		log.Fatal(string(stdout))
-	} else {
-		log.Info(string(stdout))
-	}
-}
-
-func CheckIfError(rc int, e error) {
-	if e != nil {
-		log.Fatalf("%s", e)
-		os.Exit(rc)
+		return fmt.Errorf("error executing command %s: %v\n%s", cmd, err, stdout)
 	}
+	log.Info(string(stdout))
+	return nil
 }
 
 func ByteCountSI(b int64) string {
@@ -53,3 +46,54 @@ func ByteCountIEC(b int64) string {
 	return fmt.Sprintf("%.1f %ciB",
 		float64(b)/float64(div), "KMGTPE"[exp])
 }
+
+var byteUnits = []struct {
+	suffix string
+	factor int64
+}{
+	{"KiB", 1 << 10}, {"MiB", 1 << 20}, {"GiB", 1 << 30}, {"TiB", 1 << 40},
+	{"kB", 1000}, {"KB", 1000}, {"MB", 1000 * 1000}, {"GB", 1000 * 1000 * 1000}, {"TB", 1000 * 1000 * 1000 * 1000},
+	{"K", 1 << 10}, {"M", 1 << 20}, {"G", 1 << 30}, {"T", 1 << 40},
+	{"B", 1},
+}
+
+// ParseByteSize parses sizes like 512, 100kB, 16MiB or 2G, single letter
+// suffixes are interpreted by the powers of 1024.
+func ParseByteSize(s string) (int64, error) {
+	v := strings.TrimSpace(s)
+	factor := int64(1)
+	for _, u := range byteUnits {
+		if strings.HasSuffix(v, u.suffix) {
+			v = strings.TrimSpace(strings.TrimSuffix(v, u.suffix))
+			factor = u.factor
+			break
+		}
+	}
+	n, err := strconv.ParseFloat(v, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid byte size '%s'", s)
+	}
+	return int64(n * float64(factor)), nil
+}
+
+// ParseByteRate parses rates like 20MiB/s, the suffix /s is optional.
+func ParseByteRate(s string) (int64, error) {
+	n, err := ParseByteSize(strings.TrimSuffix(strings.TrimSpace(s), "/s"))
+	if err != nil {
+		return 0, fmt.Errorf("invalid byte rate '%s'", s)
+	}
+	return n, nil
+}
+
+// ParseKeyValues parses a list of key=value pairs.
+func ParseKeyValues(pairs []string) (map[string]string, error) {
+	rlt := make(map[string]string)
+	for _, pair := range pairs {
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return nil, fmt.Errorf("invalid key/value pair '%s' (expected key=value)", pair)
+		}
+		rlt[kv[0]] = kv[1]
+	}
+	return rlt, nil
+}
@@ -0,0 +1,147 @@
+package base
+
+import (
+	"bufio"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// IgnorePattern is a pattern in gitignore syntax, see
+// https://git-scm.com/docs/gitignore#_pattern_format
+type IgnorePattern struct {
+	Pattern  string
+	negate   bool
+	dirOnly  bool
+	anchored bool
+	re       *regexp.Regexp
+}
+
+// ParseIgnorePattern parses a single pattern, blank lines and comments
+// result in false.
+func ParseIgnorePattern(line string) (IgnorePattern, bool) {
+	p := IgnorePattern{Pattern: line}
+	s := strings.TrimRight(line, " \t\r")
+	if strings.HasSuffix(s, "\\") {
+		// escaped trailing space
+		s += " "
+	}
+	if s == "" || strings.HasPrefix(s, "#") {
+		return p, false
+	}
+	if strings.HasPrefix(s, "!") {
+		p.negate = true
+		s = s[1:]
+	} else if strings.HasPrefix(s, "\\!") || strings.HasPrefix(s, "\\#") {
+		s = s[1:]
+	}
+	if strings.HasSuffix(s, "/") {
+		p.dirOnly = true
+		s = strings.TrimRight(s, "/")
+	}
+	// patterns containing a slash are relative to the location of the ignore file
+	p.anchored = strings.Contains(s, "/")
+	s = strings.TrimPrefix(s, "/")
+	if s == "" {
+		return p, false
+	}
+	re, err := regexp.Compile("^" + globToRegexp(s) + "$")
+	if err != nil {
+		return p, false
+	}
+	p.re = re
+	return p, true
+}
+
+// ParseIgnorePatterns parses patterns skipping blank lines and comments.
+func ParseIgnorePatterns(lines []string) []IgnorePattern {
+	patterns := make([]IgnorePattern, 0, len(lines))
+	for _, line := range lines {
+		if p, ok := ParseIgnorePattern(line); ok {
+			patterns = append(patterns, p)
+		}
+	}
+	return patterns
+}
+
+// ReadIgnoreFile reads the patterns of an ignore file, a missing file
+// results in no patterns.
+func ReadIgnoreFile(path string) ([]IgnorePattern, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+	lines := make([]string, 0)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	return ParseIgnorePatterns(lines), scanner.Err()
+}
+
+// Match tests a slash separated path relative to the location of the pattern.
+func (p IgnorePattern) Match(rel string, isDir bool) bool {
+	if p.dirOnly && !isDir {
+		return false
+	}
+	if !p.anchored {
+		rel = rel[strings.LastIndex(rel, "/")+1:]
+	}
+	return p.re.MatchString(rel)
+}
+
+// MatchIgnorePatterns applies patterns in order, the last matching pattern
+// decides. The second result tells whether any pattern matched at all.
+func MatchIgnorePatterns(patterns []IgnorePattern, rel string, isDir bool) (bool, bool) {
+	ignored, matched := false, false
+	for _, p := range patterns {
+		if p.Match(rel, isDir) {
+			ignored, matched = !p.negate, true
+		}
+	}
+	return ignored, matched
+}
+
+func globToRegexp(glob string) string {
+	var sb strings.Builder
+	for i := 0; i < len(glob); i++ {
+		c := glob[i]
+		switch {
+		case strings.HasPrefix(glob[i:], "**/"):
+			sb.WriteString("(.*/)?")
+			i += 2
+		case strings.HasPrefix(glob[i:], "/**") && i+3 == len(glob):
+			sb.WriteString("(/.*)?")
+			i += 2
+		case strings.HasPrefix(glob[i:], "**"):
+			sb.WriteString(".*")
+			i++
+		case c == '*':
+			sb.WriteString("[^/]*")
+		case c == '?':
+			sb.WriteString("[^/]")
+		case c == '\\' && i+1 < len(glob):
+			i++
+			sb.WriteString(regexp.QuoteMeta(string(glob[i])))
+		case c == '[':
+			end := strings.IndexByte(glob[i+1:], ']')
+			if end < 0 {
+				sb.WriteString("\\[")
+				continue
+			}
+			class := glob[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			sb.WriteString("[" + strings.ReplaceAll(class, "\\", "\\\\") + "]")
+			i += end + 1
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	return sb.String()
+}
@@ -0,0 +1,18 @@
+//go:build !windows
+// +build !windows
+
+package base
+
+import (
+	"os"
+	"syscall"
+)
+
+// FileOwner returns the numeric user and group id owning a file.
+func FileOwner(fi os.FileInfo) (int, int, bool) {
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, 0, false
+	}
+	return int(st.Uid), int(st.Gid), true
+}
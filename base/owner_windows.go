@@ -0,0 +1,14 @@
+//go:build windows
+// +build windows
+
+package base
+
+import (
+	"os"
+)
+
+// FileOwner returns the numeric user and group id owning a file, which is
+// not supported on windows.
+func FileOwner(fi os.FileInfo) (int, int, bool) {
+	return 0, 0, false
+}
@@ -0,0 +1,35 @@
+package base
+
+import "sync"
+
+// WorkerPool runs tasks concurrently on a limited number of goroutines.
+type WorkerPool struct {
+	slots chan struct{}
+	wg    sync.WaitGroup
+}
+
+// NewWorkerPool creates a pool running up to size tasks at once.
+func NewWorkerPool(size int) *WorkerPool {
+	if size < 1 {
+		size = 1
+	}
+	return &WorkerPool{slots: make(chan struct{}, size)}
+}
+
+// Go runs a task as soon as a slot is free, blocking until then.
+func (p *WorkerPool) Go(task func()) {
+	p.slots <- struct{}{}
+	p.wg.Add(1)
+	go func() {
+		defer func() {
+			<-p.slots
+			p.wg.Done()
+		}()
+		task()
+	}()
+}
+
+// Wait blocks until all tasks started so far are done.
+func (p *WorkerPool) Wait() {
+	p.wg.Wait()
+}
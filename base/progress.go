@@ -0,0 +1,288 @@
+package base
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Progress tracks the transfers of a command. On terminals it redraws bars
+// of the active transfers and the totals, otherwise it prints a line now and
+// then. Totals might grow while transfers are discovered.
+type Progress struct {
+	mu        sync.Mutex
+	out       io.Writer
+	tty       bool
+	interval  time.Duration
+	started   time.Time
+	files     int
+	bytes     int64
+	doneFiles int
+	doneBytes int64
+	failures  int
+	retries   int
+	skipped   int
+	active    map[*Transfer]bool
+	lines     int
+	stop      chan struct{}
+	stopped   sync.WaitGroup
+}
+
+// Transfer is a single file or object being transferred.
+type Transfer struct {
+	progress *Progress
+	name     string
+	size     int64
+	done     int64
+	started  time.Time
+}
+
+// IsTerminal tells whether a file is connected to a terminal.
+func IsTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// NewProgress creates a progress reporter writing to stderr, enabled
+// decides whether anything but the summary is shown.
+func NewProgress(enabled bool) *Progress {
+	p := &Progress{
+		out:      os.Stderr,
+		tty:      IsTerminal(os.Stderr),
+		started:  time.Now(),
+		active:   make(map[*Transfer]bool),
+		stop:     make(chan struct{}),
+		interval: 10 * time.Second,
+	}
+	if p.tty {
+		p.interval = 200 * time.Millisecond
+	}
+	if enabled {
+		p.stopped.Add(1)
+		go p.run()
+	}
+	return p
+}
+
+func (p *Progress) run() {
+	defer p.stopped.Done()
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			p.mu.Lock()
+			p.render()
+			p.mu.Unlock()
+		case <-p.stop:
+			return
+		}
+	}
+}
+
+// AddTotal accounts files to be transferred, a negative size denotes an unknown size.
+func (p *Progress) AddTotal(files int, bytes int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.files += files
+	if bytes > 0 {
+		p.bytes += bytes
+	}
+}
+
+// Skip accounts a file which turned out not to need a transfer.
+func (p *Progress) Skip(size int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.skipped++
+	p.files--
+	if size > 0 {
+		p.bytes -= size
+	}
+}
+
+// Fail accounts a file which could not be transferred.
+func (p *Progress) Fail() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.failures++
+}
+
+// Failures returns the number of files which could not be transferred.
+func (p *Progress) Failures() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.failures
+}
+
+// Retry accounts a transfer which is attempted again.
+func (p *Progress) Retry() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.retries++
+}
+
+// Start begins a transfer of size bytes, the size might be unknown (negative).
+func (p *Progress) Start(name string, size int64) *Transfer {
+	t := &Transfer{progress: p, name: name, size: size, started: time.Now()}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.active[t] = true
+	return t
+}
+
+// Reader counts the bytes read as transferred.
+func (t *Transfer) Reader(r io.Reader) io.Reader {
+	return &countingReader{r: r, t: t}
+}
+
+// Writer counts the bytes written as transferred.
+func (t *Transfer) Writer(w io.Writer) io.Writer {
+	return &countingWriter{w: w, t: t}
+}
+
+// Reset discards the bytes transferred so far, i.e. before a retry.
+func (t *Transfer) Reset() {
+	t.progress.mu.Lock()
+	defer t.progress.mu.Unlock()
+	t.progress.doneBytes -= t.done
+	t.done = 0
+}
+
+// SetSize sets the size of a transfer once it is known.
+func (t *Transfer) SetSize(size int64) {
+	p := t.progress
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if t.size < 0 && size > 0 {
+		p.bytes += size
+	}
+	t.size = size
+}
+
+// Done ends the transfer, only successful transfers count as done.
+func (t *Transfer) Done(err error) {
+	p := t.progress
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.active, t)
+	if err == nil {
+		p.doneFiles++
+	}
+}
+
+func (t *Transfer) add(n int) {
+	p := t.progress
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	t.done += int64(n)
+	p.doneBytes += int64(n)
+}
+
+type countingReader struct {
+	r io.Reader
+	t *Transfer
+}
+
+func (cr *countingReader) Read(b []byte) (int, error) {
+	n, err := cr.r.Read(b)
+	cr.t.add(n)
+	return n, err
+}
+
+type countingWriter struct {
+	w io.Writer
+	t *Transfer
+}
+
+func (cw *countingWriter) Write(b []byte) (int, error) {
+	n, err := cw.w.Write(b)
+	cw.t.add(n)
+	return n, err
+}
+
+// Stop ends the reporting and prints a summary.
+func (p *Progress) Stop() {
+	select {
+	case <-p.stop:
+		return
+	default:
+		close(p.stop)
+	}
+	p.stopped.Wait()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.clear()
+	elapsed := time.Since(p.started)
+	fmt.Fprintf(p.out, "%d object(s) with %s transferred in %s (%s/s)", p.doneFiles, ByteCountIEC(p.doneBytes), elapsed.Round(time.Millisecond), ByteCountIEC(rate(p.doneBytes, elapsed)))
+	if p.skipped > 0 {
+		fmt.Fprintf(p.out, ", %d skipped", p.skipped)
+	}
+	fmt.Fprintf(p.out, ", %d failed, %d retries\n", p.failures, p.retries)
+}
+
+func rate(bytes int64, elapsed time.Duration) int64 {
+	if elapsed < time.Millisecond {
+		return 0
+	}
+	return int64(float64(bytes) / elapsed.Seconds())
+}
+
+func (p *Progress) totals() string {
+	elapsed := time.Since(p.started)
+	speed := rate(p.doneBytes, elapsed)
+	eta := "?"
+	if speed > 0 && p.bytes >= p.doneBytes {
+		eta = (time.Duration(float64(p.bytes-p.doneBytes)/float64(speed)) * time.Second).Round(time.Second).String()
+	}
+	return fmt.Sprintf("%d/%d file(s), %s/%s, %s/s, ETA %s", p.doneFiles, p.files, ByteCountIEC(p.doneBytes), ByteCountIEC(p.bytes), ByteCountIEC(speed), eta)
+}
+
+// clear removes the lines drawn on a terminal before.
+func (p *Progress) clear() {
+	if p.tty && p.lines > 0 {
+		fmt.Fprintf(p.out, "\x1b[%dA\x1b[J", p.lines)
+		p.lines = 0
+	}
+}
+
+func (p *Progress) render() {
+	if !p.tty {
+		fmt.Fprintf(p.out, "progress: %s\n", p.totals())
+		return
+	}
+	p.clear()
+	transfers := make([]*Transfer, 0, len(p.active))
+	for t := range p.active {
+		transfers = append(transfers, t)
+	}
+	sort.Slice(transfers, func(i, j int) bool { return transfers[i].started.Before(transfers[j].started) })
+	for _, t := range transfers {
+		fmt.Fprintln(p.out, t.bar())
+		p.lines++
+	}
+	fmt.Fprintln(p.out, p.totals())
+	p.lines++
+}
+
+func (t *Transfer) bar() string {
+	const width = 30
+	filled := width
+	percent := "  ?%"
+	if t.size > 0 {
+		filled = int(int64(width) * t.done / t.size)
+		if filled > width {
+			filled = width
+		}
+		percent = fmt.Sprintf("%3d%%", 100*t.done/t.size)
+	}
+	size := "?"
+	if t.size >= 0 {
+		size = ByteCountIEC(t.size)
+	}
+	return fmt.Sprintf("[%s%s] %s %s/%s %s", strings.Repeat("=", filled), strings.Repeat(" ", width-filled), percent, ByteCountIEC(t.done), size, t.name)
+}
@@ -0,0 +1,115 @@
+package cmd
+
+import (
+	"fmt"
+	s3 "s3cli/s3"
+	"strings"
+
+	cobra "github.com/spf13/cobra"
+)
+
+var (
+	aclFlags = struct {
+		canned string
+		grants []string
+	}{
+		canned: "",
+		grants: nil,
+	}
+	aclCmd = &cobra.Command{
+		Use:   "acl",
+		Short: "manage the ACLs of buckets and objects",
+		Long: `prints or replaces the access control list of a bucket or, given its key, of
+an object.`,
+	}
+	aclGetCmd = &cobra.Command{
+		Use:   "get [flags] <bucket-name> [key]",
+		Short: "print the ACL",
+		Long: `prints the owner and the grants of the ACL as
+
+owner	<display-name>(<id>)
+<permission>	<grantee>`,
+		RunE:       aclGet,
+		Args:       cobra.RangeArgs(1, 2),
+		ArgAliases: []string{"bucket", "key"},
+	}
+	aclSetCmd = &cobra.Command{
+		Use:   "set [flags] <bucket-name> [key]",
+		Short: "replace the ACL",
+		Long: `replaces the ACL by a canned ACL or by grants given as <permission>=<grantee>,
+i.e. read=AllUsers or full-control=id=<canonical-user-id>. The permissions are
+full-control, read, write, read-acp and write-acp, the grantees are given as
+id=..., uri=..., emailAddress=... or by the groups AllUsers,
+AuthenticatedUsers and LogDelivery.`,
+		RunE:       aclSet,
+		Args:       cobra.RangeArgs(1, 2),
+		ArgAliases: []string{"bucket", "key"},
+	}
+)
+
+func init() {
+	aclSetCmd.PersistentFlags().StringVar(&aclFlags.canned, "canned", aclFlags.canned, "canned ACL, one of "+strings.Join(s3.CannedAcls, ", "))
+	aclSetCmd.PersistentFlags().StringArrayVar(&aclFlags.grants, "grant", aclFlags.grants, "grant a permission as <permission>=<grantee> (repeatable)")
+	aclCmd.AddCommand(aclGetCmd, aclSetCmd)
+	rootCmd.AddCommand(aclCmd)
+}
+
+// parseGrants parses grants given as <permission>=<grantee>.
+func parseGrants(args []string) ([]s3.S3Grant, error) {
+	var grants []s3.S3Grant
+	for _, arg := range args {
+		i := strings.Index(arg, "=")
+		if i < 0 {
+			return nil, fmt.Errorf("invalid grant '%s' (expected i.e. read=AllUsers)", arg)
+		}
+		grantee, err := s3.ParseGrantee(arg[i+1:])
+		if err != nil {
+			return nil, err
+		}
+		permission := strings.ToUpper(strings.Replace(arg[:i], "-", "_", -1))
+		grants = append(grants, s3.S3Grant{Grantee: grantee, Permission: permission})
+	}
+	return grants, nil
+}
+
+func aclGet(cmd *cobra.Command, args []string) error {
+	bucket, err := FindBucket(args[0])
+	if err != nil {
+		return err
+	}
+	var acl *s3.S3AccessControlPolicy
+	if len(args) > 1 {
+		acl, err = bucket.GetObjectAcl(cmd.Context(), args[1])
+	} else {
+		acl, err = bucket.GetBucketAcl(cmd.Context())
+	}
+	if err != nil {
+		return fmt.Errorf("error getting ACL: %w", err)
+	}
+	fmt.Printf("owner\t%s(%s)\n", acl.Owner.DisplayName, acl.Owner.Id)
+	for _, grant := range acl.Grants {
+		fmt.Printf("%s\t%s\n", grant.Permission, grant.Grantee)
+	}
+	return nil
+}
+
+func aclSet(cmd *cobra.Command, args []string) error {
+	grants, err := parseGrants(aclFlags.grants)
+	if err != nil {
+		return err
+	}
+	bucket, err := FindBucket(args[0])
+	if err != nil {
+		return err
+	}
+	if len(args) > 1 {
+		err = bucket.PutObjectAcl(cmd.Context(), args[1], aclFlags.canned, grants)
+	} else {
+		err = bucket.PutBucketAcl(cmd.Context(), aclFlags.canned, grants)
+	}
+	if err != nil {
+		return fmt.Errorf("error putting ACL: %w", err)
+	}
+	fmt.Println("ACL replaced")
+	return nil
+}
@@ -0,0 +1,155 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	s3base "s3cli/base"
+	s3 "s3cli/s3"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// names of the object metadata holding POSIX file attributes
+const (
+	metaMtime = "mtime"
+	metaMode  = "mode"
+	metaUid   = "uid"
+	metaGid   = "gid"
+	// target of symlinks uploaded as objects
+	metaSymlink = "symlink-target"
+)
+
+// fileAttributes encodes modification time, permissions and ownership of a
+// file as object metadata.
+func fileAttributes(fi os.FileInfo) map[string]string {
+	mtime := fi.ModTime()
+	attrs := map[string]string{
+		metaMtime: fmt.Sprintf("%d.%09d", mtime.Unix(), mtime.Nanosecond()),
+		metaMode:  fmt.Sprintf("%04o", fi.Mode().Perm()),
+	}
+	if uid, gid, ok := s3base.FileOwner(fi); ok {
+		attrs[metaUid] = strconv.Itoa(uid)
+		attrs[metaGid] = strconv.Itoa(gid)
+	}
+	return attrs
+}
+
+// withMetadata returns a copy of the options with additional metadata.
+func withMetadata(options s3.S3PutOptions, meta map[string]string) s3.S3PutOptions {
+	rlt := options
+	rlt.Metadata = make(map[string]string)
+	for k, v := range options.Metadata {
+		rlt.Metadata[k] = v
+	}
+	for k, v := range meta {
+		rlt.Metadata[k] = v
+	}
+	return rlt
+}
+
+// restoreFileAttributes applies the file attributes stored in the object
+// metadata, the modification time falls back to lastModified if absent.
+func restoreFileAttributes(target string, metadata map[string]string, lastModified time.Time) error {
+	if v, ok := metadata[metaMode]; ok {
+		mode, err := strconv.ParseUint(v, 8, 32)
+		if err != nil {
+			return fmt.Errorf("invalid mode '%s' stored for %s", v, target)
+		}
+		if err := os.Chmod(target, os.FileMode(mode).Perm()); err != nil {
+			return err
+		}
+	}
+
+	restoreOwner(target, metadata)
+
+	mtime := lastModified
+	if v, ok := metadata[metaMtime]; ok {
+		t, err := parseUnixTime(v)
+		if err != nil {
+			return fmt.Errorf("invalid mtime '%s' stored for %s", v, target)
+		}
+		mtime = t
+	}
+	if mtime.IsZero() {
+		return nil
+	}
+	return os.Chtimes(target, mtime, mtime)
+}
+
+// restoreSymlink replaces a downloaded file by the symlink it was uploaded from.
+func restoreSymlink(target string, linkTarget string, metadata map[string]string) error {
+	err := os.Remove(target)
+	if err != nil {
+		return err
+	}
+	err = os.Symlink(linkTarget, target)
+	if err != nil {
+		return err
+	}
+	restoreOwner(target, metadata)
+	return nil
+}
+
+// symlinkWithin tells whether a symlink at target to linkTarget resolves
+// below root. Symlinks passed on the way are followed as far as they exist.
+func symlinkWithin(root string, target string, linkTarget string) bool {
+	if filepath.IsAbs(linkTarget) || filepath.VolumeName(linkTarget) != "" {
+		return false
+	}
+	realRoot, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return false
+	}
+	p, err := filepath.EvalSymlinks(filepath.Dir(target))
+	if err != nil {
+		return false
+	}
+	for _, seg := range strings.FieldsFunc(linkTarget, func(r rune) bool { return r == '/' || r == os.PathSeparator }) {
+		switch seg {
+		case ".":
+			continue
+		case "..":
+			p = filepath.Dir(p)
+		default:
+			p = filepath.Join(p, seg)
+			if real, err := filepath.EvalSymlinks(p); err == nil {
+				p = real
+			}
+		}
+	}
+	rel, err := filepath.Rel(realRoot, p)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(os.PathSeparator))
+}
+
+func restoreOwner(target string, metadata map[string]string) {
+	uid, uerr := strconv.Atoi(metadata[metaUid])
+	gid, gerr := strconv.Atoi(metadata[metaGid])
+	if uerr == nil && gerr == nil {
+		// changing ownership usually requires privileges
+		if err := os.Lchown(target, uid, gid); err != nil {
+			log.Warnf("can not change ownership of %s to %d:%d: %v", target, uid, gid, err)
+		}
+	}
+}
+
+// parseUnixTime parses seconds since epoch with an optional fraction.
+func parseUnixTime(v string) (time.Time, error) {
+	parts := strings.SplitN(v, ".", 2)
+	sec, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	nsec := int64(0)
+	if len(parts) == 2 {
+		frac := (parts[1] + "000000000")[:9]
+		nsec, err = strconv.ParseInt(frac, 10, 64)
+		if err != nil {
+			return time.Time{}, err
+		}
+	}
+	return time.Unix(sec, nsec), nil
+}
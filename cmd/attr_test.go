@@ -0,0 +1,123 @@
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestParseUnixTime(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected time.Time
+		fails    bool
+	}{
+		{"0", time.Unix(0, 0), false},
+		{"1600000000", time.Unix(1600000000, 0), false},
+		{"1600000000.5", time.Unix(1600000000, 500000000), false},
+		{"1600000000.000000001", time.Unix(1600000000, 1), false},
+		{"1600000000.123456789123", time.Unix(1600000000, 123456789), false},
+		{"1600000000.", time.Unix(1600000000, 0), false},
+		{"-1", time.Unix(-1, 0), false},
+		{"", time.Time{}, true},
+		{"abc", time.Time{}, true},
+		{"1600000000.x", time.Time{}, true},
+		{"2020-09-13T12:26:40Z", time.Time{}, true},
+	}
+	for _, test := range tests {
+		parsed, err := parseUnixTime(test.value)
+		if test.fails {
+			if err == nil {
+				t.Errorf("%q is parsed as %v, expected to fail", test.value, parsed)
+			}
+			continue
+		}
+		if err != nil || !parsed.Equal(test.expected) {
+			t.Errorf("%q is parsed as %v (%v), expected %v", test.value, parsed, err, test.expected)
+		}
+	}
+}
+
+func TestFileAttributes(t *testing.T) {
+	p := filepath.Join(t.TempDir(), "file")
+	if err := ioutil.WriteFile(p, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	mtime := time.Unix(1600000000, 123456789)
+	if err := os.Chtimes(p, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+	fi, err := os.Stat(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	attrs := fileAttributes(fi)
+	if attrs[metaMtime] != "1600000000.123456789" {
+		t.Errorf("mtime is stored as %q", attrs[metaMtime])
+	}
+	if expected := fmt.Sprintf("%04o", fi.Mode().Perm()); attrs[metaMode] != expected {
+		t.Errorf("mode is stored as %q, expected %q", attrs[metaMode], expected)
+	}
+	parsed, err := parseUnixTime(attrs[metaMtime])
+	if err != nil || !parsed.Equal(mtime) {
+		t.Errorf("stored mtime is parsed as %v (%v), expected %v", parsed, err, mtime)
+	}
+}
+
+func TestRestoreFileAttributes(t *testing.T) {
+	lastModified := time.Unix(1500000000, 0)
+	tests := []struct {
+		name     string
+		metadata map[string]string
+		mtime    time.Time
+		fails    bool
+	}{
+		{"mtime", map[string]string{metaMtime: "1600000000.5"}, time.Unix(1600000000, 500000000), false},
+		{"last modified", map[string]string{}, lastModified, false},
+		{"invalid mtime", map[string]string{metaMtime: "yesterday"}, time.Time{}, true},
+		{"invalid mode", map[string]string{metaMode: "rw-r--r--"}, time.Time{}, true},
+	}
+	for _, test := range tests {
+		p := filepath.Join(t.TempDir(), "file")
+		if err := ioutil.WriteFile(p, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+		err := restoreFileAttributes(p, test.metadata, lastModified)
+		if test.fails {
+			if err == nil {
+				t.Errorf("restoring %s succeeded", test.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		fi, err := os.Stat(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !fi.ModTime().Equal(test.mtime) {
+			t.Errorf("restoring %s set mtime %v, expected %v", test.name, fi.ModTime(), test.mtime)
+		}
+	}
+
+	// objects of stores without modification times keep the current one
+	p := filepath.Join(t.TempDir(), "file")
+	if err := ioutil.WriteFile(p, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	before, err := os.Stat(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := restoreFileAttributes(p, nil, time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+	after, err := os.Stat(p)
+	if err != nil || !after.ModTime().Equal(before.ModTime()) {
+		t.Errorf("mtime without metadata and last modified changed to %v (%v)", after.ModTime(), err)
+	}
+}
@@ -0,0 +1,63 @@
+package cmd
+
+import (
+	"fmt"
+	s3 "s3cli/s3"
+	"time"
+
+	cobra "github.com/spf13/cobra"
+)
+
+var (
+	bucketsFlags = struct {
+		longListFormat bool
+	}{
+		longListFormat: false,
+	}
+	bucketsCmd = &cobra.Command{
+		Use:   "buckets [flags] <bucket-name>",
+		Short: "list buckets",
+		Long: `lists the buckets at the service of a configured bucket, which are owned by
+its credentials.`,
+		RunE:       buckets,
+		Args:       cobra.ExactArgs(1),
+		ArgAliases: []string{"bucket"},
+	}
+)
+
+func init() {
+	bucketsCmd.PersistentFlags().BoolVarP(&bucketsFlags.longListFormat, "long-list", "l", bucketsFlags.longListFormat, "print the creation date as well")
+	rootCmd.AddCommand(bucketsCmd)
+}
+
+func buckets(cmd *cobra.Command, args []string) error {
+	bucket, err := FindBucket(args[0])
+	if err != nil {
+		return err
+	}
+	rlt, err := bucket.ListBuckets(cmd.Context())
+	if err != nil {
+		return fmt.Errorf("error listing buckets: %w", err)
+	}
+	for _, b := range rlt.Buckets {
+		if bucketsFlags.longListFormat {
+			fmt.Printf("%s\t%s\n", b.CreationDate.Format(time.RFC3339), b.Name)
+		} else {
+			fmt.Println(b.Name)
+		}
+	}
+	return nil
+}
+
+// findBucketOrSibling looks up a bucket of the configuration or, if like
+// names a configured bucket, derives the bucket of the given name from it.
+func findBucketOrSibling(name string, like string) (s3.S3Bucket, error) {
+	if like == "" {
+		return FindBucket(name)
+	}
+	b, err := FindBucket(like)
+	if err != nil {
+		return s3.S3Bucket{}, err
+	}
+	return b.Sibling(name)
+}
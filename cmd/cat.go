@@ -0,0 +1,147 @@
+package cmd
+
+import (
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	s3 "s3cli/s3"
+	"strconv"
+	"strings"
+
+	cobra "github.com/spf13/cobra"
+)
+
+var (
+	catFlags = struct {
+		byteRange string
+		head      int64
+		tail      int64
+		gunzip    bool
+	}{
+		byteRange: "",
+		head:      0,
+		tail:      0,
+		gunzip:    false,
+	}
+	catCmd = &cobra.Command{
+		Use:        "cat [flags] <bucket-name> <key>...",
+		Aliases:    []string{"print"},
+		Short:      "print objects",
+		Long:       `streams the content of one or more objects to stdout.`,
+		RunE:       cat,
+		Args:       cobra.MinimumNArgs(2),
+		ArgAliases: []string{"bucket", "key"},
+	}
+)
+
+func init() {
+	catCmd.PersistentFlags().StringVar(&catFlags.byteRange, "range", catFlags.byteRange, "print only the given byte range, i.e. start-end, start- or -suffix-length")
+	catCmd.PersistentFlags().Int64Var(&catFlags.head, "head", catFlags.head, "print only the first N bytes")
+	catCmd.PersistentFlags().Int64Var(&catFlags.tail, "tail", catFlags.tail, "print only the last N bytes")
+	catCmd.PersistentFlags().BoolVarP(&catFlags.gunzip, "gunzip", "z", catFlags.gunzip, "decompress objects ending with .gz or stored with Content-Encoding gzip")
+	rootCmd.AddCommand(catCmd)
+}
+
+func cat(cmd *cobra.Command, args []string) error {
+	store, err := FindStore(args[0])
+	if err != nil {
+		return err
+	}
+
+	byteRange, err := catByteRange()
+	if err != nil {
+		return err
+	}
+	for _, key := range args[1:] {
+		err = catObject(cmd.Context(), store, key, byteRange)
+		if err != nil {
+			return fmt.Errorf("error printing %s: %w", key, err)
+		}
+	}
+	return nil
+}
+
+func catObject(ctx context.Context, store s3.ObjectStore, key string, byteRange string) error {
+	obj, err := store.Get(ctx, key, byteRange)
+	if err != nil {
+		return err
+	}
+	defer obj.Body.Close()
+
+	var r io.Reader = obj.Body
+	if catFlags.gunzip && (strings.HasSuffix(key, ".gz") || strings.EqualFold(obj.ContentEncoding, "gzip")) {
+		zr, err := gzip.NewReader(obj.Body)
+		if err != nil {
+			return err
+		}
+		defer zr.Close()
+		r = zr
+	}
+	// --head limits the decompressed output, the content is not requested by
+	// range with --gunzip whether the object is compressed or not
+	if catFlags.head > 0 {
+		r = io.LimitReader(r, catFlags.head)
+	}
+	_, err = io.Copy(os.Stdout, r)
+	return err
+}
+
+// catByteRange translates --range, --head and --tail to a HTTP range.
+func catByteRange() (string, error) {
+	n := 0
+	for _, set := range []bool{catFlags.byteRange != "", catFlags.head > 0, catFlags.tail > 0} {
+		if set {
+			n++
+		}
+	}
+	if n > 1 {
+		return "", fmt.Errorf("only one of --range, --head and --tail may be specified")
+	}
+	if catFlags.head < 0 || catFlags.tail < 0 {
+		return "", fmt.Errorf("--head and --tail require a positive number of bytes")
+	}
+	if catFlags.gunzip {
+		if catFlags.byteRange != "" || catFlags.tail > 0 {
+			return "", fmt.Errorf("--range and --tail can not be combined with --gunzip")
+		}
+		// the compressed stream is read from the beginning
+		return "", nil
+	}
+	switch {
+	case catFlags.head > 0:
+		return s3.ByteRange(0, catFlags.head-1), nil
+	case catFlags.tail > 0:
+		return s3.SuffixByteRange(catFlags.tail), nil
+	case catFlags.byteRange != "":
+		return parseByteRange(catFlags.byteRange)
+	}
+	return "", nil
+}
+
+func parseByteRange(spec string) (string, error) {
+	parts := strings.SplitN(spec, "-", 2)
+	if len(parts) != 2 || (parts[0] == "" && parts[1] == "") {
+		return "", fmt.Errorf("invalid byte range '%s' (expected start-end, start- or -suffix-length)", spec)
+	}
+	if parts[0] == "" {
+		n, err := strconv.ParseInt(parts[1], 10, 64)
+		if err != nil || n <= 0 {
+			return "", fmt.Errorf("invalid byte range '%s'", spec)
+		}
+		return s3.SuffixByteRange(n), nil
+	}
+	start, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil || start < 0 {
+		return "", fmt.Errorf("invalid byte range '%s'", spec)
+	}
+	if parts[1] == "" {
+		return s3.ByteRange(start, -1), nil
+	}
+	end, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil || end < start {
+		return "", fmt.Errorf("invalid byte range '%s'", spec)
+	}
+	return s3.ByteRange(start, end), nil
+}
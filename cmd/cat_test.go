@@ -0,0 +1,75 @@
+package cmd
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io/ioutil"
+	"os"
+	s3 "s3cli/s3"
+	"testing"
+)
+
+// captureStdout returns what the function prints to stdout.
+func captureStdout(t *testing.T, f func() error) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	done := make(chan []byte)
+	go func() {
+		b, _ := ioutil.ReadAll(r)
+		done <- b
+	}()
+	err = f()
+	os.Stdout = stdout
+	w.Close()
+	b := <-done
+	r.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestCatHead(t *testing.T) {
+	saved := catFlags
+	defer func() { catFlags = saved }()
+	ctx := context.Background()
+	store := s3.NewMemoryStore()
+	var compressed bytes.Buffer
+	zw := gzip.NewWriter(&compressed)
+	zw.Write([]byte("compressed content"))
+	zw.Close()
+	for key, content := range map[string][]byte{"plain.txt": []byte("plain content"), "data.gz": compressed.Bytes()} {
+		err := store.Put(ctx, key, bytes.NewReader(content), int64(len(content)), s3.S3PutOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		key    string
+		gunzip bool
+		output string
+	}{
+		{"plain.txt", false, "plain"},
+		{"plain.txt", true, "plain"},
+		{"data.gz", true, "compr"},
+	}
+	for _, test := range tests {
+		catFlags.head = 5
+		catFlags.gunzip = test.gunzip
+		byteRange, err := catByteRange()
+		if err != nil {
+			t.Fatal(err)
+		}
+		output := captureStdout(t, func() error { return catObject(ctx, store, test.key, byteRange) })
+		if output != test.output {
+			t.Errorf("--head 5 of %s with --gunzip=%t printed %q, expected %q", test.key, test.gunzip, output, test.output)
+		}
+	}
+}
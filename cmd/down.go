@@ -1,11 +1,17 @@
 package cmd
 
 import (
+	"context"
+	"fmt"
+	"io"
+	"math/rand"
 	"os"
-	"path"
+	"path/filepath"
 	s3base "s3cli/base"
 	s3 "s3cli/s3"
+	"strconv"
 	"strings"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 
@@ -18,20 +24,34 @@ var (
 		recursive          bool
 		force              bool
 		fetchSize          int
-		//parallel  int
+		preserve           bool
+		onClash            string
+		journal            string
+		resume             string
+		parallel           int
+		retries            int
+		noProgress         bool
+		versionId          string
 	}{
 		keyToPathDelimiter: "/",
 		recursive:          false,
 		force:              false,
 		fetchSize:          1000,
-		//parallel:  3,
+		preserve:           false,
+		onClash:            clashFail,
+		journal:            "",
+		resume:             "",
+		parallel:           3,
+		retries:            2,
+		noProgress:         false,
+		versionId:          "",
 	}
 	downloadCmd = &cobra.Command{
 		Use:        "down [flags] <bucket-name> <key-prefix> [local-path]",
 		Aliases:    []string{"download", "get"},
 		Short:      "downloads objects",
 		Long:       `downloads objects to S3.`,
-		Run:        down,
+		RunE:       down,
 		Args:       cobra.MinimumNArgs(2),
 		ArgAliases: []string{"bucket", "key-prefix", "local-path"},
 	}
@@ -42,104 +62,435 @@ func init() {
 	downloadCmd.PersistentFlags().BoolVarP(&downloadFlags.recursive, "recursive", "r", downloadFlags.recursive, "remove directories and their contents recursively")
 	downloadCmd.PersistentFlags().BoolVarP(&downloadFlags.force, "force", "f", downloadFlags.force, "overwrite an existing destination file")
 	downloadCmd.PersistentFlags().IntVarP(&downloadFlags.fetchSize, "fetch-size", "n", downloadFlags.fetchSize, "fetch objects in batches of this size")
-	//downloadCmd.PersistentFlags().IntVarP(&downloadFlags.fetchSize, "parallel", "p", downloadFlags.fetchSize, "download objects concurrently")
+	downloadCmd.PersistentFlags().StringVar(&downloadFlags.onClash, "on-clash", downloadFlags.onClash, "policy for keys used both as file and directory (i.e. a and a/b) - allowed values are: fail, skip or rename (stores the file with suffix "+clashSuffix+")")
+	downloadCmd.PersistentFlags().BoolVarP(&downloadFlags.preserve, "preserve", "p", downloadFlags.preserve, "restore modification time, mode and ownership of files from object metadata")
+	downloadCmd.PersistentFlags().StringVar(&downloadFlags.journal, "journal", downloadFlags.journal, "record the progress of recursive downloads in this journal (defaults to a new file in ~/.s3/jobs, removed on success)")
+	downloadCmd.PersistentFlags().StringVar(&downloadFlags.resume, "resume", downloadFlags.resume, "resume the interrupted recursive download recorded in this journal")
+	downloadCmd.PersistentFlags().IntVarP(&downloadFlags.parallel, "parallel", "P", downloadFlags.parallel, "download objects concurrently")
+	downloadCmd.PersistentFlags().IntVar(&downloadFlags.retries, "retries", downloadFlags.retries, "retry failed downloads of objects this often")
+	downloadCmd.PersistentFlags().BoolVar(&downloadFlags.noProgress, "no-progress", downloadFlags.noProgress, "show only a summary instead of the progress")
+	downloadCmd.PersistentFlags().StringVar(&downloadFlags.versionId, "version-id", downloadFlags.versionId, "download this version of the object instead of the latest one")
 	rootCmd.AddCommand(downloadCmd)
 }
 
 type downloadingItemVisitor struct {
-	bucket s3.S3Bucket
-	path   string
+	store     s3.ObjectStore
+	path      string
+	journal   *journal
+	transfers *transfers
 }
 
 func (div downloadingItemVisitor) VisitListing(partialResult *s3.S3ListBucketResult) (bool, error) {
+	pending := newPendingTargets(div.path)
 	for _, item := range partialResult.Contents {
-		download(div.bucket, item.Key, div.path, false)
+		item := item
+		div.transfers.progress.AddTotal(1, item.Size)
+		if div.journal.isCompleted(item.Key) {
+			div.transfers.progress.Skip(item.Size)
+			continue
+		}
+		// keys like a and a/b are downloaded one after the other, otherwise
+		// clashes would be resolved before the file or directory exists
+		if target, err := resolveTarget(div.path, item.Key); err == nil {
+			if pending.clashes(target) {
+				div.transfers.wait()
+				pending = newPendingTargets(div.path)
+			}
+			pending.add(target)
+		}
+		div.transfers.submit(func() error {
+			// files of downloads begun before are incomplete
+			overwrite := downloadFlags.force || div.journal.wasStarted(item.Key)
+			start := func() error { return div.journal.start(item.Key) }
+			err := download(div.transfers, div.store, item.Key, item.LastModified, item.Size, div.path, false, overwrite, start)
+			if err != nil {
+				return err
+			}
+			return div.journal.complete(item.Key)
+		})
+	}
+	// the page is done only when all of its objects are
+	div.transfers.wait()
+	if err := div.transfers.ctx.Err(); err != nil {
+		return false, err
+	}
+	if partialResult.IsTruncated && div.transfers.progress.Failures() == 0 {
+		return true, div.journal.setContinuationToken(partialResult.NextContinuationToken)
 	}
 	return true, nil
 }
 
-func down(cmd *cobra.Command, args []string) {
-	bucket := FindBucket(args[0])
+// pendingTargets are the targets of the downloads submitted to the pool and
+// the directories they are stored in.
+type pendingTargets struct {
+	root  string
+	files map[string]bool
+	dirs  map[string]bool
+}
+
+func newPendingTargets(root string) *pendingTargets {
+	return &pendingTargets{root: filepath.Clean(root), files: make(map[string]bool), dirs: make(map[string]bool)}
+}
+
+// ancestors returns the directories of the target below the root.
+func (pt *pendingTargets) ancestors(target string) []string {
+	var dirs []string
+	for dir := filepath.Dir(target); dir != pt.root && dir != filepath.Dir(dir); dir = filepath.Dir(dir) {
+		dirs = append(dirs, dir)
+	}
+	return dirs
+}
+
+// clashes tells whether the target is pending, is the directory of a
+// pending target or is stored below one.
+func (pt *pendingTargets) clashes(target string) bool {
+	if pt.files[target] || pt.dirs[target] {
+		return true
+	}
+	for _, dir := range pt.ancestors(target) {
+		if pt.files[dir] {
+			return true
+		}
+	}
+	return false
+}
+
+func (pt *pendingTargets) add(target string) {
+	pt.files[target] = true
+	for _, dir := range pt.ancestors(target) {
+		pt.dirs[dir] = true
+	}
+}
+
+func down(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	store, err := findDownloadStore(args[0])
+	if err != nil {
+		return err
+	}
 	key := args[1]
 
+	switch downloadFlags.onClash {
+	case clashFail, clashSkip, clashRename:
+	default:
+		return fmt.Errorf("invalid clash policy %s specified!", downloadFlags.onClash)
+	}
+
 	path, err := os.Getwd()
-	s3base.CheckIfError(2, err)
+	if err != nil {
+		return s3base.WithExitCode(exitLocal, err)
+	}
 	if len(args) > 2 {
 		path = args[2]
 	}
 
 	fi, err := os.Stat(path)
 	if downloadFlags.recursive {
-		if err != nil {
-			if !os.IsNotExist(err) {
-				log.Fatalf("error reading stats of %s: %w", path, err)
-			}
-			bucket.List(key, downloadFlags.fetchSize, downloadingItemVisitor{
-				bucket: bucket,
-				path:   path,
-			})
-			return
-
+		if err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("error reading stats of %s: %v", path, err)
 		}
-		if fi.IsDir() {
-			bucket.List(key, downloadFlags.fetchSize, downloadingItemVisitor{
-				bucket: bucket,
-				path:   path,
-			})
-			return
+		if err == nil && !fi.IsDir() {
+			return fmt.Errorf("recursive download target %s needs to be a directory", path)
 		}
-		log.Fatalf("recursive download target %s needs to be a directory", path)
-		return
+		return downRecursive(ctx, store, key, path, args)
 	}
 	if err != nil {
 		if !os.IsNotExist(err) {
-			log.Fatalf("error reading stats of %s: %w", path, err)
-			return
+			return fmt.Errorf("error reading stats of %s: %v", path, err)
 		}
-		download(bucket, key, path, true)
-		return
+		return downloadSingle(ctx, store, key, path, true)
+	}
+	if fi.IsDir() {
+		return downloadSingle(ctx, store, key, path, false)
+	}
+	if downloadFlags.force {
+		return downloadSingle(ctx, store, key, path, true)
+	}
+	return fmt.Errorf("file %s already exists (use force flag)", path)
+}
 
-	} else {
-		if fi.IsDir() {
-			download(bucket, key, path, false)
-			return
-		}
-		if downloadFlags.force {
-			download(bucket, key, path, true)
-			return
-		}
-		log.Fatalf("file %s already exists (use force flag)", path)
-		return
+// findDownloadStore looks up the store of the bucket, which gets the version
+// of the version id flag if set.
+func findDownloadStore(name string) (s3.ObjectStore, error) {
+	if downloadFlags.versionId == "" {
+		return FindStore(name)
+	}
+	if downloadFlags.recursive {
+		return nil, fmt.Errorf("a version can only be downloaded of a single object")
+	}
+	bucket, err := FindBucket(name)
+	if err != nil {
+		return nil, err
+	}
+	return objectVersion{S3Bucket: bucket, versionId: downloadFlags.versionId}, nil
+}
+
+// objectVersion gets a version of objects instead of the latest one.
+type objectVersion struct {
+	s3.S3Bucket
+	versionId string
+}
+
+func (ov objectVersion) Get(ctx context.Context, key string, byteRange string) (*s3.S3Object, error) {
+	return ov.GetVersion(ctx, key, ov.versionId, byteRange)
+}
+
+func downRecursive(ctx context.Context, store s3.ObjectStore, key string, path string, args []string) (err error) {
+	j, err := startJournal(downloadFlags.resume, downloadFlags.journal, "down", args[0], args)
+	if err != nil {
+		return s3base.WithExitCode(exitJournal, err)
+	}
+	defer func() { err = j.resumeHint(err) }()
+	ts := newTransfers(ctx, downloadFlags.parallel, downloadFlags.retries, !downloadFlags.noProgress)
+	err = store.ListFrom(ctx, key, j.continuationToken(), downloadFlags.fetchSize, downloadingItemVisitor{
+		store:     store,
+		path:      path,
+		journal:   j,
+		transfers: ts,
+	})
+	failures := ts.finish()
+	if err := interrupted(ctx); err != nil {
+		return err
+	}
+	if err != nil {
+		return s3base.WithExitCode(exitListing, err)
+	}
+	if failures > 0 {
+		return s3base.WithExitCode(exitDownload, fmt.Errorf("%d object(s) failed to download", failures))
+	}
+	return s3base.WithExitCode(exitJournal, j.finish())
+}
+
+func downloadSingle(ctx context.Context, store s3.ObjectStore, key string, targetPath string, exact bool) error {
+	ts := newTransfers(ctx, 1, downloadFlags.retries, !downloadFlags.noProgress)
+	err := download(ts, store, key, time.Time{}, -1, targetPath, exact, downloadFlags.force, nil)
+	if err != nil {
+		ts.progress.Fail()
 	}
+	ts.finish()
+	if err := interrupted(ctx); err != nil {
+		return err
+	}
+	return s3base.WithExitCode(exitDownload, err)
 }
 
-func download(bucket s3.S3Bucket, key string, targetPath string, exact bool) {
+// download stores an object below or at the target path, failed transfers
+// are retried. Objects are written to a temporary file first, which replaces
+// the target once the object is complete. start is called once the target
+// may be written, i.e. a refused download is not recorded as begun.
+func download(ts *transfers, store s3.ObjectStore, key string, lastModified time.Time, size int64, targetPath string, exact bool, overwrite bool, start func() error) error {
 	target := targetPath
 	if !exact {
-		target = convertKey(targetPath, key)
+		var err error
+		target, err = resolveTarget(targetPath, key)
+		if err != nil {
+			if downloadFlags.recursive {
+				log.Warnf("skipping object: %v", err)
+				ts.progress.Skip(size)
+				return nil
+			}
+			return err
+		}
+		if strings.HasSuffix(key, downloadFlags.keyToPathDelimiter) {
+			// directory marker objects
+			ts.progress.Skip(size)
+			return os.MkdirAll(target, os.ModePerm)
+		}
+		var ok bool
+		target, ok, err = resolveClash(targetPath, target)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			ts.progress.Skip(size)
+			return nil
+		}
 	}
-	_, err := os.Stat(target)
+	_, err := os.Lstat(target)
 	if err == nil {
-		if !downloadFlags.force {
-			log.Fatalf("file %s already exists (use force flag)", target)
+		if !overwrite {
+			return fmt.Errorf("file %s already exists (use force flag)", target)
 		}
-	} else {
-		if !os.IsNotExist(err) {
-			log.Fatal(err)
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	if start != nil {
+		err = start()
+		if err != nil {
+			return err
 		}
 	}
-	dir := path.Dir(target)
-	err = os.MkdirAll(dir, os.ModePerm)
+	// symlinks restored must not lead out of the directory downloaded to
+	root := targetPath
+	if exact {
+		root = filepath.Dir(targetPath)
+	}
+	// a symlink at the target is replaced by the rename, not written through
+	err = os.MkdirAll(filepath.Dir(target), os.ModePerm)
+	if err != nil {
+		return err
+	}
+	return ts.transfer(key, size, func(t *s3base.Transfer) error {
+		obj, err := store.Get(ts.ctx, key, "")
+		if err != nil {
+			return err
+		}
+		defer obj.Body.Close()
+		t.SetSize(obj.Size)
+		if linkTarget, ok := obj.Metadata[metaSymlink]; ok && downloadFlags.preserve && !symlinkWithin(root, target, linkTarget) {
+			// later objects would be written through the symlink
+			err = fmt.Errorf("symlink %s to %s leads outside of %s", target, linkTarget, root)
+			if downloadFlags.recursive {
+				log.Warnf("skipping object: %v", err)
+				return nil
+			}
+			return err
+		}
+		err = writeAtomically(target, func(f *os.File) error {
+			_, err := io.Copy(t.Writer(f), obj.Body)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		if !downloadFlags.preserve {
+			return nil
+		}
+		if linkTarget, ok := obj.Metadata[metaSymlink]; ok {
+			return restoreSymlink(target, linkTarget, obj.Metadata)
+		}
+		if lastModified.IsZero() {
+			lastModified = obj.LastModified
+		}
+		return restoreFileAttributes(target, obj.Metadata, lastModified)
+	})
+}
+
+// writeAtomically writes a file by a temporary file in the same directory,
+// which is renamed to the target on success and removed otherwise.
+func writeAtomically(target string, write func(f *os.File) error) error {
+	f, err := createTempFile(filepath.Dir(target), "."+filepath.Base(target)+".")
 	if err != nil {
-		log.Fatal(err)
+		return err
+	}
+	err = write(f)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), target)
 	}
-	err = bucket.Download(key, target)
 	if err != nil {
-		log.Fatal(err)
+		os.Remove(f.Name())
+	}
+	return err
+}
+
+// createTempFile creates a new file like ioutil.TempFile, but with the mode
+// of regular files, 0666 less the umask, as ioutil.TempFile creates private
+// ones.
+func createTempFile(dir string, prefix string) (*os.File, error) {
+	for i := 0; ; i++ {
+		name := filepath.Join(dir, prefix+strconv.FormatUint(uint64(rand.Uint32()), 10)+tempSuffix)
+		f, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0666)
+		if os.IsExist(err) && i < 100 {
+			continue
+		}
+		return f, err
 	}
 }
 
-func convertKey(path string, key string) string {
-	sep := string(os.PathSeparator)
-	return strings.TrimSuffix(path, sep) + sep + strings.TrimPrefix(strings.ReplaceAll(key, downloadFlags.keyToPathDelimiter, sep), sep)
+// resolveTarget maps an object key to a path below root. Absolute keys are
+// treated relative to root, keys containing NUL characters or .. segments
+// are refused.
+func resolveTarget(root string, key string) (string, error) {
+	if strings.ContainsRune(key, 0) {
+		return "", fmt.Errorf("key %q contains a NUL character", key)
+	}
+	segments := []string{filepath.Clean(root)}
+	for _, s := range strings.Split(key, downloadFlags.keyToPathDelimiter) {
+		// separators not used as delimiter must not introduce segments either
+		for _, seg := range strings.FieldsFunc(s, func(r rune) bool { return r == '/' || r == os.PathSeparator }) {
+			switch {
+			case seg == ".":
+				continue
+			case seg == "..":
+				return "", fmt.Errorf("key %q refers to a parent directory", key)
+			case filepath.VolumeName(seg) != "":
+				return "", fmt.Errorf("key %q refers to a volume", key)
+			}
+			segments = append(segments, seg)
+		}
+	}
+	if len(segments) == 1 {
+		return "", fmt.Errorf("key %q does not denote a file", key)
+	}
+	target := filepath.Join(segments...)
+	rel, err := filepath.Rel(segments[0], target)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(os.PathSeparator)) {
+		return "", fmt.Errorf("key %q resolves outside of %s", key, root)
+	}
+	return target, nil
+}
+
+const (
+	clashFail   = "fail"
+	clashSkip   = "skip"
+	clashRename = "rename"
+	clashSuffix = ".object"
+	tempSuffix  = ".s3tmp"
+)
+
+// resolveClash detects objects which need to be stored where directories
+// are required by other objects and vice versa. The returned path is where
+// the object is stored, or false if it has to be skipped.
+func resolveClash(root string, target string) (string, bool, error) {
+	// an ancestor which is a file
+	rel, _ := filepath.Rel(filepath.Clean(root), target)
+	parent := filepath.Clean(root)
+	for _, seg := range strings.Split(filepath.Dir(rel), string(os.PathSeparator)) {
+		if seg == "." {
+			break
+		}
+		parent = filepath.Join(parent, seg)
+		fi, err := os.Lstat(parent)
+		if err != nil || fi.IsDir() {
+			continue
+		}
+		if fi.Mode()&os.ModeSymlink != 0 {
+			// never write through symlinks, they might point anywhere
+			if downloadFlags.recursive {
+				log.Warnf("skipping %s: %s is a symlink", target, parent)
+				return "", false, nil
+			}
+			return "", false, fmt.Errorf("can not create %s: %s is a symlink", target, parent)
+		}
+		switch downloadFlags.onClash {
+		case clashSkip:
+			log.Warnf("skipping %s: %s is a file", target, parent)
+			return "", false, nil
+		case clashRename:
+			log.Warnf("renaming file %s to %s to create directory", parent, parent+clashSuffix)
+			if err := os.Rename(parent, parent+clashSuffix); err != nil {
+				return "", false, err
+			}
+		default:
+			return "", false, fmt.Errorf("can not create %s: %s is a file (use --on-clash)", target, parent)
+		}
+	}
+
+	// the target which is a directory
+	fi, err := os.Stat(target)
+	if err != nil || !fi.IsDir() {
+		return target, true, nil
+	}
+	switch downloadFlags.onClash {
+	case clashSkip:
+		log.Warnf("skipping %s: it is a directory", target)
+		return "", false, nil
+	case clashRename:
+		log.Warnf("storing %s as %s: it is a directory", target, target+clashSuffix)
+		return target + clashSuffix, true, nil
+	}
+	return "", false, fmt.Errorf("can not create %s: it is a directory (use --on-clash)", target)
 }
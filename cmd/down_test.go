@@ -0,0 +1,246 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	s3 "s3cli/s3"
+	"strings"
+	"testing"
+)
+
+// withDownloadFlags runs a test with a recursive download configuration
+// restored afterwards.
+func withDownloadFlags(t *testing.T, parallel int, onClash string) {
+	t.Helper()
+	saved := downloadFlags
+	t.Cleanup(func() { downloadFlags = saved })
+	downloadFlags.recursive = true
+	downloadFlags.noProgress = true
+	downloadFlags.parallel = parallel
+	downloadFlags.onClash = onClash
+	downloadFlags.journal = filepath.Join(t.TempDir(), "down.journal")
+}
+
+func TestPendingTargetsClash(t *testing.T) {
+	root := filepath.FromSlash("/tmp/down")
+	pt := newPendingTargets(root + string(os.PathSeparator))
+	pt.add(filepath.Join(root, "a"))
+	pt.add(filepath.Join(root, "b", "c", "d"))
+	tests := []struct {
+		target  string
+		clashes bool
+	}{
+		{"a", true},
+		{"a/x", true},
+		{"a/x/y", true},
+		{"b", true},
+		{"b/c", true},
+		{"b/c/d/e", true},
+		{"b/c/e", false},
+		{"ab", false},
+		{"c", false},
+	}
+	for _, test := range tests {
+		target := filepath.Join(root, filepath.FromSlash(test.target))
+		if clashes := pt.clashes(target); clashes != test.clashes {
+			t.Errorf("%s clashes is %t, expected %t", test.target, clashes, test.clashes)
+		}
+	}
+}
+
+func TestDownRecursiveResolvesClashesInOrder(t *testing.T) {
+	withDownloadFlags(t, 8, clashRename)
+	store := s3.NewMemoryStore()
+	ctx := context.Background()
+	const objects = 50
+	for i := 0; i < objects; i++ {
+		for _, key := range []string{fmt.Sprintf("k%d", i), fmt.Sprintf("k%d/x", i)} {
+			err := store.Put(ctx, key, strings.NewReader(key), int64(len(key)), s3.S3PutOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	dir := t.TempDir()
+	err := downRecursive(ctx, store, "", dir, []string{"memory", ""})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// each file has been renamed for the directory of the following key
+	for i := 0; i < objects; i++ {
+		for p, content := range map[string]string{
+			fmt.Sprintf("k%d%s", i, clashSuffix): fmt.Sprintf("k%d", i),
+			fmt.Sprintf("k%d/x", i):              fmt.Sprintf("k%d/x", i),
+		} {
+			b, err := ioutil.ReadFile(filepath.Join(dir, filepath.FromSlash(p)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(b) != content {
+				t.Errorf("%s holds %q, expected %q", p, b, content)
+			}
+		}
+	}
+}
+
+func TestDownRecursiveFailsOnClashes(t *testing.T) {
+	withDownloadFlags(t, 8, clashFail)
+	store := s3.NewMemoryStore()
+	ctx := context.Background()
+	for _, key := range []string{"a", "a/b", "c"} {
+		err := store.Put(ctx, key, strings.NewReader(key), int64(len(key)), s3.S3PutOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	dir := t.TempDir()
+	err := downRecursive(ctx, store, "", dir, []string{"memory", ""})
+	if err == nil || !strings.Contains(err.Error(), "1 object(s) failed") {
+		t.Fatalf("download returned %v, expected the failure of a/b", err)
+	}
+	for _, p := range []string{"a", "c"} {
+		fi, err := os.Stat(filepath.Join(dir, p))
+		if err != nil || !fi.Mode().IsRegular() {
+			t.Errorf("%s is not a file: %v", p, err)
+		}
+	}
+}
+
+func TestResolveTarget(t *testing.T) {
+	saved := downloadFlags.keyToPathDelimiter
+	defer func() { downloadFlags.keyToPathDelimiter = saved }()
+	root := filepath.FromSlash("/tmp/down")
+	windows := os.PathSeparator == '\\'
+	// the expected paths are relative to root, empty ones are refused
+	tests := []struct {
+		key       string
+		delimiter string
+		expected  string
+	}{
+		{"a", "/", "a"},
+		{"a/b/c", "/", "a/b/c"},
+		{"a//b/", "/", "a/b"},
+		{"./a/./b", "/", "a/b"},
+		{"/abs", "/", "abs"},
+		{"//abs/x", "/", "abs/x"},
+		{"../x", "/", ""},
+		{"a/../../x", "/", ""},
+		{"a/..", "/", ""},
+		{"..", "/", ""},
+		{"", "/", ""},
+		{"/", "/", ""},
+		{"./", "/", ""},
+		{"a\x00b", "/", ""},
+		{"a/\x00/b", "/", ""},
+		{"a:b", ":", "a/b"},
+		{"a:..:x", ":", ""},
+		// slashes separate paths regardless of the delimiter
+		{"a:b/c", ":", "a/b/c"},
+		{"a:../x", ":", ""},
+		{`a\b`, `\`, "a/b"},
+		{`a\..\x`, `\`, ""},
+	}
+	if windows {
+		tests = append(tests, []struct {
+			key       string
+			delimiter string
+			expected  string
+		}{
+			{`a\b`, "/", "a/b"},
+			{`..\x`, "/", ""},
+			{`a\..\..\x`, "/", ""},
+			{`C:\x`, "/", ""},
+			{`C:x`, "/", ""},
+			{`C:\x`, `\`, ""},
+			{`\\server\share\x`, "/", "server/share/x"},
+		}...)
+	} else {
+		// backslashes and colons are part of file names
+		tests = append(tests, []struct {
+			key       string
+			delimiter string
+			expected  string
+		}{
+			{`a\b`, "/", `a\b`},
+			{`..\x`, "/", `..\x`},
+			{`C:\x`, "/", `C:\x`},
+			{`C:\x`, `\`, "C:/x"},
+		}...)
+	}
+	for _, test := range tests {
+		downloadFlags.keyToPathDelimiter = test.delimiter
+		target, err := resolveTarget(root, test.key)
+		if test.expected == "" {
+			if err == nil {
+				t.Errorf("%q is resolved to %s, expected to be refused", test.key, target)
+			}
+			continue
+		}
+		expected := filepath.Join(root, filepath.FromSlash(test.expected))
+		if err != nil || target != expected {
+			t.Errorf("%q is resolved to %q (%v), expected %q", test.key, target, err, expected)
+		}
+	}
+}
+
+func TestResolveClash(t *testing.T) {
+	saved := downloadFlags
+	defer func() { downloadFlags = saved }()
+	tests := []struct {
+		onClash  string
+		existing string
+		target   string
+		expected string
+		renamed  string
+		fails    bool
+	}{
+		{clashFail, "", "a", "a", "", false},
+		{clashFail, "a", "a/b", "", "", true},
+		{clashSkip, "a", "a/b", "", "", false},
+		{clashRename, "a", "a/b", "a/b", "a" + clashSuffix, false},
+		{clashFail, "a", "a/b/c", "", "", true},
+		{clashRename, "a", "a/b/c", "a/b/c", "a" + clashSuffix, false},
+		{clashFail, "a/b", "a", "", "", true},
+		{clashSkip, "a/b", "a", "", "", false},
+		{clashRename, "a/b", "a", "a" + clashSuffix, "", false},
+		{clashFail, "a/b", "a/c", "a/c", "", false},
+	}
+	for _, test := range tests {
+		downloadFlags.onClash = test.onClash
+		root := t.TempDir()
+		if test.existing != "" {
+			existing := filepath.Join(root, filepath.FromSlash(test.existing))
+			if err := os.MkdirAll(filepath.Dir(existing), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := ioutil.WriteFile(existing, nil, 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		target, ok, err := resolveClash(root, filepath.Join(root, filepath.FromSlash(test.target)))
+		name := fmt.Sprintf("%s on %s with %s existing", test.target, test.onClash, test.existing)
+		switch {
+		case test.fails:
+			if err == nil {
+				t.Errorf("%s is resolved to %s, expected to fail", name, target)
+			}
+		case test.expected == "":
+			if err != nil || ok {
+				t.Errorf("%s is resolved to %s, %t (%v), expected to be skipped", name, target, ok, err)
+			}
+		default:
+			expected := filepath.Join(root, filepath.FromSlash(test.expected))
+			if err != nil || !ok || target != expected {
+				t.Errorf("%s is resolved to %s, %t (%v), expected %s", name, target, ok, err, expected)
+			}
+		}
+		if test.renamed != "" {
+			if fi, err := os.Stat(filepath.Join(root, test.renamed)); err != nil || fi.IsDir() {
+				t.Errorf("%s did not rename the file to %s: %v", name, test.renamed, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,144 @@
+//go:build !windows
+// +build !windows
+
+package cmd
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	s3 "s3cli/s3"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestWriteAtomicallyHonoursUmask(t *testing.T) {
+	for _, umask := range []int{0022, 0077, 0002} {
+		old := syscall.Umask(umask)
+		target := filepath.Join(t.TempDir(), "file")
+		err := writeAtomically(target, func(f *os.File) error {
+			_, err := f.WriteString("content")
+			return err
+		})
+		syscall.Umask(old)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fi, err := os.Stat(target)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected := os.FileMode(0666 &^ umask); fi.Mode().Perm() != expected {
+			t.Errorf("file written with umask %03o has mode %v, expected %v", umask, fi.Mode().Perm(), expected)
+		}
+		entries, err := os.ReadDir(filepath.Dir(target))
+		if err != nil || len(entries) != 1 {
+			t.Errorf("temporary files are left behind: %v", entries)
+		}
+	}
+}
+
+func TestRestoreFileMode(t *testing.T) {
+	old := syscall.Umask(0022)
+	defer syscall.Umask(old)
+	for _, mode := range []string{"0600", "0755", "0640", "0777"} {
+		p := filepath.Join(t.TempDir(), "file")
+		if err := ioutil.WriteFile(p, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := restoreFileAttributes(p, map[string]string{metaMode: mode}, time.Time{}); err != nil {
+			t.Fatal(err)
+		}
+		fi, err := os.Stat(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stored := fileAttributes(fi)[metaMode]; stored != mode {
+			t.Errorf("restored mode %s is %s", mode, stored)
+		}
+	}
+}
+
+func TestSymlinkWithin(t *testing.T) {
+	root := t.TempDir()
+	for _, dir := range []string{"a/b", "c"} {
+		if err := os.MkdirAll(filepath.Join(root, filepath.FromSlash(dir)), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// links restored before
+	if err := os.Symlink("..", filepath.Join(root, "c", "up")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(os.TempDir(), filepath.Join(root, "tmp")); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		link   string
+		target string
+		within bool
+	}{
+		{"a/l", "b", true},
+		{"a/l", "b/x", true},
+		{"a/b/l", "../../c", true},
+		{"a/l", ".", true},
+		{"l", ".", true},
+		{"l", "a/./b", true},
+		{"a/l", "../..", false},
+		{"l", "..", false},
+		{"a/b/l", "../../../x", false},
+		{"l", "/etc", false},
+		{"a/l", "/", false},
+		{"l", "c/up", true},
+		{"l", "c/up/..", false},
+		{"l", "c/up/../x", false},
+		{"l", "tmp", false},
+		{"l", "tmp/x", false},
+	}
+	for _, test := range tests {
+		within := symlinkWithin(root, filepath.Join(root, filepath.FromSlash(test.link)), test.target)
+		if within != test.within {
+			t.Errorf("link %s to %s is within is %t, expected %t", test.link, test.target, within, test.within)
+		}
+	}
+}
+
+func TestDownPreserveRefusesEscapingSymlinks(t *testing.T) {
+	withDownloadFlags(t, 1, clashFail)
+	downloadFlags.preserve = true
+	downloadFlags.retries = 0
+	store := s3.NewMemoryStore()
+	ctx := context.Background()
+	outside := t.TempDir()
+	links := map[string]string{"in": "dir", "out": outside, "up": "../x"}
+	for key, target := range links {
+		err := store.Put(ctx, key, strings.NewReader(target), int64(len(target)), s3.S3PutOptions{Metadata: map[string]string{metaSymlink: target}})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	// the object below the escaping link is refused as written through it
+	putObjects(t, store, "dir/file", "out/file")
+	dir := t.TempDir()
+	if err := downRecursive(ctx, store, "", dir, []string{"memory", ""}); err != nil {
+		t.Fatal(err)
+	}
+	if target, err := os.Readlink(filepath.Join(dir, "in")); err != nil || target != "dir" {
+		t.Errorf("link within is %q (%v), expected to be restored", target, err)
+	}
+	for _, name := range []string{"out", "up"} {
+		if fi, err := os.Lstat(filepath.Join(dir, name)); err == nil && fi.Mode()&os.ModeSymlink != 0 {
+			t.Errorf("escaping link %s is restored", name)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "out", "file")); err != nil {
+		t.Errorf("object below the refused link is not stored in the destination: %v", err)
+	}
+	entries, err := os.ReadDir(outside)
+	if err != nil || len(entries) != 0 {
+		t.Errorf("files are written outside of the destination: %v (%v)", entries, err)
+	}
+}
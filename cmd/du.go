@@ -31,7 +31,7 @@ var (
 		Aliases:    []string{"usage", "disk-usage"},
 		Short:      "disk usage of objects",
 		Long:       `shows disk usage of objects in S3`,
-		Run:        du,
+		RunE:       du,
 		Args:       cobra.MinimumNArgs(1),
 		ArgAliases: []string{"bucket", "prefix"},
 	}
@@ -43,19 +43,26 @@ func init() {
 	rootCmd.AddCommand(duCmd)
 }
 
-func du(cmd *cobra.Command, args []string) {
+func du(cmd *cobra.Command, args []string) error {
 	prefix := ""
 	if len(args) > 1 {
 		prefix = args[1]
 	}
-	bucket := FindBucket(args[0])
+	store, err := FindStore(args[0])
+	if err != nil {
+		return err
+	}
 	visitor := &usageComputingItemVisitor{}
-	bucket.List(prefix, duFlags.fetchSize, visitor)
+	err = store.List(cmd.Context(), prefix, duFlags.fetchSize, visitor)
+	if err != nil {
+		return s3base.WithExitCode(exitListing, fmt.Errorf("error listing %s: %w", prefix, err))
+	}
 	if duFlags.humanReadable {
 		fmt.Println(visitor.Count, "object(s) using", s3base.ByteCountIEC(visitor.Size))
 	} else {
 		fmt.Println(visitor.Count, "object(s) using", visitor.Size, "B")
 	}
+	return nil
 }
 
 func (uciv *usageComputingItemVisitor) VisitListing(partialResult *s3.S3ListBucketResult) (bool, error) {
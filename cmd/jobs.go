@@ -0,0 +1,136 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	cobra "github.com/spf13/cobra"
+)
+
+var (
+	jobsFlags = struct {
+		olderThan time.Duration
+		all       bool
+	}{
+		olderThan: 24 * time.Hour,
+		all:       false,
+	}
+	jobsCmd = &cobra.Command{
+		Use:   "jobs",
+		Short: "manage journals of interrupted transfers",
+		Long:  `lists and cleans up the journals of interrupted up and down runs.`,
+	}
+	jobsListCmd = &cobra.Command{
+		Use:     "list [flags]",
+		Aliases: []string{"ls"},
+		Short:   "list journals",
+		Long:    `lists the journals of interrupted transfers.`,
+		RunE:    jobsList,
+		Args:    cobra.NoArgs,
+	}
+	jobsCleanCmd = &cobra.Command{
+		Use:        "clean [flags] [journal]...",
+		Aliases:    []string{"rm"},
+		Short:      "remove stale journals",
+		Long:       `removes stale journals and aborts the multipart uploads recorded in them.`,
+		RunE:       jobsClean,
+		ArgAliases: []string{"journal"},
+	}
+)
+
+func init() {
+	jobsCleanCmd.PersistentFlags().DurationVar(&jobsFlags.olderThan, "older-than", jobsFlags.olderThan, "remove journals not updated within this duration")
+	jobsCleanCmd.PersistentFlags().BoolVarP(&jobsFlags.all, "all", "a", jobsFlags.all, "remove all journals")
+	jobsCmd.AddCommand(jobsListCmd)
+	jobsCmd.AddCommand(jobsCleanCmd)
+	rootCmd.AddCommand(jobsCmd)
+}
+
+func listJournals() ([]*journal, error) {
+	dir, err := journalDir()
+	if err != nil {
+		return nil, err
+	}
+	paths, err := filepath.Glob(filepath.Join(dir, "*"+journalSuffix))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+	journals := make([]*journal, 0, len(paths))
+	for _, p := range paths {
+		j, err := loadJournal(p)
+		if err != nil {
+			log.Warnf("skipping %s: %v", p, err)
+			continue
+		}
+		journals = append(journals, j)
+	}
+	return journals, nil
+}
+
+func jobsList(cmd *cobra.Command, args []string) error {
+	journals, err := listJournals()
+	if err != nil {
+		return err
+	}
+	for _, j := range journals {
+		fmt.Printf("%s\t%s\t%d completed\t%d upload(s) in progress\t%s %s\n", j.path, j.updated.Format(time.RFC3339), len(j.completed), len(j.uploads), j.header.Command, strings.Join(j.header.Args, " "))
+	}
+	return nil
+}
+
+func jobsClean(cmd *cobra.Command, args []string) error {
+	var journals []*journal
+	if len(args) > 0 {
+		for _, p := range args {
+			j, err := loadJournal(p)
+			if err != nil {
+				return err
+			}
+			journals = append(journals, j)
+		}
+	} else {
+		all, err := listJournals()
+		if err != nil {
+			return err
+		}
+		for _, j := range all {
+			if jobsFlags.all || time.Since(j.updated) > jobsFlags.olderThan {
+				journals = append(journals, j)
+			}
+		}
+	}
+	for _, j := range journals {
+		abortJournalUploads(cmd.Context(), j)
+		if err := os.Remove(j.path); err != nil {
+			return err
+		}
+		fmt.Printf("%s removed\n", j.path)
+	}
+	return nil
+}
+
+// abortJournalUploads aborts the multipart uploads which would have been
+// resumed, as incomplete uploads are charged for.
+func abortJournalUploads(ctx context.Context, j *journal) {
+	if len(j.uploads) == 0 {
+		return
+	}
+	bucket, err := FindBucket(j.header.Bucket)
+	if err != nil {
+		log.Warnf("can not abort uploads of %s: %v", j.path, err)
+		return
+	}
+	for _, upload := range j.uploads {
+		if err := bucket.AbortUpload(ctx, upload); err != nil {
+			log.Warnf("aborting upload %s of %s failed: %v", upload.UploadId, upload.Key, err)
+		}
+	}
+}
@@ -0,0 +1,291 @@
+package cmd
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	s3 "s3cli/s3"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const journalSuffix = ".jsonl"
+
+// journal records the progress of a transfer as JSON lines appended to a
+// file, which allows to resume an interrupted run. Later lines supersede
+// earlier ones on replay.
+type journal struct {
+	path      string
+	mu        sync.Mutex
+	file      *os.File
+	header    journalHeader
+	updated   time.Time
+	started   map[string]bool
+	completed map[string]bool
+	uploads   map[string]*s3.S3MultipartUpload
+	token     string
+	resumed   bool
+}
+
+type journalHeader struct {
+	Command string    `json:"command"`
+	Bucket  string    `json:"bucket"`
+	Args    []string  `json:"args"`
+	Created time.Time `json:"created"`
+}
+
+type journalEntry struct {
+	Time      time.Time             `json:"time"`
+	Header    *journalHeader        `json:"header,omitempty"`
+	Started   string                `json:"started,omitempty"`
+	Completed string                `json:"completed,omitempty"`
+	Upload    *s3.S3MultipartUpload `json:"upload,omitempty"`
+	Part      *journalPart          `json:"part,omitempty"`
+	Token     *string               `json:"token,omitempty"`
+}
+
+// journalPart records a part of a multipart upload, which is added to the
+// parts of the upload on replay.
+type journalPart struct {
+	Key        string `json:"key"`
+	UploadId   string `json:"uploadId"`
+	PartNumber int    `json:"partNumber"`
+	ETag       string `json:"etag"`
+}
+
+func journalDir() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".s3", "jobs"), nil
+}
+
+func newJournal(path string) *journal {
+	return &journal{
+		path:      path,
+		started:   make(map[string]bool),
+		completed: make(map[string]bool),
+		uploads:   make(map[string]*s3.S3MultipartUpload),
+	}
+}
+
+// createJournal starts a journal at path, or in the jobs directory if path is empty.
+func createJournal(path string, command string, bucket string, args []string) (*journal, error) {
+	if path == "" {
+		dir, err := journalDir()
+		if err != nil {
+			return nil, err
+		}
+		path = filepath.Join(dir, fmt.Sprintf("%s-%s-%d%s", command, time.Now().Format("20060102-150405"), os.Getpid(), journalSuffix))
+	}
+	err := os.MkdirAll(filepath.Dir(path), 0700)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return nil, err
+	}
+	j := newJournal(path)
+	j.file = f
+	j.header = journalHeader{Command: command, Bucket: bucket, Args: args, Created: time.Now()}
+	return j, j.append(journalEntry{Header: &j.header})
+}
+
+// loadJournal replays a journal without opening it for further records.
+func loadJournal(path string) (*journal, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	j := newJournal(path)
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var e journalEntry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			// the last line might be incomplete if the process was killed
+			log.Warnf("ignoring invalid record in journal %s: %v", path, err)
+			continue
+		}
+		j.replay(e)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if j.header.Command == "" {
+		return nil, fmt.Errorf("%s is not a job journal", path)
+	}
+	return j, nil
+}
+
+// resumeJournal replays a journal and opens it for further records.
+func resumeJournal(path string, command string, bucket string, args []string) (*journal, error) {
+	j, err := loadJournal(path)
+	if err != nil {
+		return nil, err
+	}
+	if j.header.Command != command || j.header.Bucket != bucket || strings.Join(j.header.Args, "\x00") != strings.Join(args, "\x00") {
+		return nil, fmt.Errorf("journal %s belongs to '%s %s'", path, j.header.Command, strings.Join(j.header.Args, " "))
+	}
+	j.file, err = os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+	log.Infof("resuming job of %s with %d completed object(s)", j.header.Created.Format(time.RFC3339), len(j.completed))
+	return j, nil
+}
+
+func (j *journal) replay(e journalEntry) {
+	j.updated = e.Time
+	switch {
+	case e.Header != nil:
+		j.header = *e.Header
+	case e.Started != "":
+		j.started[e.Started] = true
+	case e.Completed != "":
+		j.completed[e.Completed] = true
+		delete(j.uploads, e.Completed)
+	case e.Upload != nil:
+		j.uploads[e.Upload.Key] = e.Upload
+	case e.Part != nil:
+		j.replayPart(*e.Part)
+	case e.Token != nil:
+		j.token = *e.Token
+	}
+}
+
+// replayPart adds a part to its upload, replacing a part of the same number
+// uploaded again on resume.
+func (j *journal) replayPart(p journalPart) {
+	u, ok := j.uploads[p.Key]
+	if !ok || u.UploadId != p.UploadId {
+		return
+	}
+	part := s3.S3CompletedPart{PartNumber: p.PartNumber, ETag: p.ETag}
+	for i := range u.Parts {
+		if u.Parts[i].PartNumber == p.PartNumber {
+			u.Parts[i] = part
+			return
+		}
+	}
+	u.Parts = append(u.Parts, part)
+	sort.Slice(u.Parts, func(a, b int) bool { return u.Parts[a].PartNumber < u.Parts[b].PartNumber })
+}
+
+func (j *journal) append(e journalEntry) error {
+	e.Time = time.Now()
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.replay(e)
+	_, err = j.file.Write(append(b, '\n'))
+	return err
+}
+
+func (j *journal) isCompleted(key string) bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.completed[key]
+}
+
+// wasStarted tells whether the transfer of an object has been begun before.
+func (j *journal) wasStarted(key string) bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.started[key]
+}
+
+// upload returns a copy of the multipart upload in progress for an object, if any.
+func (j *journal) upload(key string) *s3.S3MultipartUpload {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	u, ok := j.uploads[key]
+	if !ok {
+		return nil
+	}
+	rlt := *u
+	rlt.Parts = append([]s3.S3CompletedPart{}, u.Parts...)
+	return &rlt
+}
+
+func (j *journal) continuationToken() string {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.token
+}
+
+func (j *journal) start(key string) error {
+	return j.append(journalEntry{Started: key})
+}
+
+func (j *journal) complete(key string) error {
+	return j.append(journalEntry{Completed: key})
+}
+
+func (j *journal) setContinuationToken(token string) error {
+	return j.append(journalEntry{Token: &token})
+}
+
+// VisitUpload records a created upload and then each of its parts, the
+// parts reused on resume have been recorded before.
+func (j *journal) VisitUpload(upload *s3.S3MultipartUpload) error {
+	if len(upload.Parts) == 0 {
+		u := *upload
+		u.Parts = nil
+		return j.append(journalEntry{Upload: &u})
+	}
+	part := upload.Parts[len(upload.Parts)-1]
+	return j.append(journalEntry{Part: &journalPart{Key: upload.Key, UploadId: upload.UploadId, PartNumber: part.PartNumber, ETag: part.ETag}})
+}
+
+// finish removes the journal of a job which completed successfully.
+func (j *journal) finish() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	err := j.file.Close()
+	if err != nil {
+		return err
+	}
+	return os.Remove(j.path)
+}
+
+// startJournal creates or resumes the journal of a command.
+func startJournal(resumePath string, path string, command string, bucket string, args []string) (*journal, error) {
+	var j *journal
+	var err error
+	if resumePath != "" {
+		j, err = resumeJournal(resumePath, command, bucket, args)
+	} else {
+		j, err = createJournal(path, command, bucket, args)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("can not open journal: %v", err)
+	}
+	j.resumed = resumePath != ""
+	log.Debugf("recording progress in journal %s", j.path)
+	return j, nil
+}
+
+// resumeHint adds how to resume to the error of a failed command.
+func (j *journal) resumeHint(err error) error {
+	if j == nil || err == nil {
+		return err
+	}
+	hint := os.Args[1:]
+	if !j.resumed {
+		hint = append(hint, "--resume", j.path)
+	}
+	return fmt.Errorf("%w (resume with: %s %s)", err, filepath.Base(os.Args[0]), strings.Join(hint, " "))
+}
@@ -0,0 +1,430 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	s3 "s3cli/s3"
+	"strings"
+	"sync"
+	"testing"
+
+	viper "github.com/spf13/viper"
+)
+
+// emulatedBucket serves the bucket bkt by an emulator for the test.
+func emulatedBucket(t *testing.T) s3.S3Bucket {
+	t.Helper()
+	em := s3.NewEmulator(t.TempDir())
+	em.AccessKeyId = "AK"
+	em.SecretKey = "SK"
+	if err := os.Mkdir(filepath.Join(em.Root, "bkt"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(em)
+	t.Cleanup(srv.Close)
+	return s3.S3Bucket{
+		Name:        "bkt",
+		Endpoint:    srv.URL + "/bkt",
+		AccessKeyId: "AK",
+		SecretKey:   "SK",
+		Region:      "us-east-1",
+		PartSize:    s3.MinPartSize,
+	}
+}
+
+// interruptingStore cancels the context of a run once the object of the key
+// is transferred and records the keys transferred.
+type interruptingStore struct {
+	s3.ObjectStore
+	key    string
+	cancel context.CancelFunc
+	mu     sync.Mutex
+	keys   []string
+}
+
+func (s *interruptingStore) transferred(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys = append(s.keys, key)
+	if key == s.key {
+		s.cancel()
+		return context.Canceled
+	}
+	return nil
+}
+
+func (s *interruptingStore) Get(ctx context.Context, key string, byteRange string) (*s3.S3Object, error) {
+	if err := s.transferred(key); err != nil {
+		return nil, err
+	}
+	return s.ObjectStore.Get(ctx, key, byteRange)
+}
+
+func (s *interruptingStore) Put(ctx context.Context, key string, r io.Reader, size int64, options s3.S3PutOptions) error {
+	if err := s.transferred(key); err != nil {
+		return err
+	}
+	return s.ObjectStore.Put(ctx, key, r, size, options)
+}
+
+func newJournalForTest(t *testing.T) *journal {
+	t.Helper()
+	j, err := createJournal(filepath.Join(t.TempDir(), "test"+journalSuffix), "up", "bkt", []string{"bkt", "dir"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { j.file.Close() })
+	return j
+}
+
+func TestJournalReplay(t *testing.T) {
+	j := newJournalForTest(t)
+	upload := &s3.S3MultipartUpload{Key: "big", UploadId: "u1", PartSize: s3.MinPartSize}
+	records := []func() error{
+		func() error { return j.start("a") },
+		func() error { return j.complete("a") },
+		func() error { return j.start("b") },
+		func() error { return j.setContinuationToken("t1") },
+		func() error { return j.VisitUpload(upload) },
+		func() error {
+			upload.Parts = append(upload.Parts, s3.S3CompletedPart{PartNumber: 1, ETag: `"e1"`})
+			return j.VisitUpload(upload)
+		},
+		func() error {
+			upload.Parts = append(upload.Parts, s3.S3CompletedPart{PartNumber: 2, ETag: `"e2"`})
+			return j.VisitUpload(upload)
+		},
+		// part 2 uploaded again on resume
+		func() error {
+			upload.Parts = append(upload.Parts[:1], s3.S3CompletedPart{PartNumber: 2, ETag: `"e2b"`})
+			return j.VisitUpload(upload)
+		},
+		func() error { return j.VisitUpload(&s3.S3MultipartUpload{Key: "done", UploadId: "u2"}) },
+		func() error { return j.complete("done") },
+		func() error { return j.setContinuationToken("t2") },
+	}
+	for _, record := range records {
+		if err := record(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// the last line of a killed process might be incomplete
+	if _, err := j.file.WriteString(`{"time":"2021-`); err != nil {
+		t.Fatal(err)
+	}
+
+	replayed, err := loadJournal(j.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(replayed.header.Args, []string{"bkt", "dir"}) || replayed.header.Command != "up" {
+		t.Errorf("header is %+v", replayed.header)
+	}
+	if !replayed.isCompleted("a") || replayed.isCompleted("b") || !replayed.isCompleted("done") {
+		t.Errorf("completed objects are %v, expected a and done", replayed.completed)
+	}
+	if !replayed.wasStarted("a") || !replayed.wasStarted("b") || replayed.wasStarted("c") {
+		t.Errorf("started objects are %v, expected a and b", replayed.started)
+	}
+	if token := replayed.continuationToken(); token != "t2" {
+		t.Errorf("continuation token is %q, expected t2", token)
+	}
+	expected := &s3.S3MultipartUpload{Key: "big", UploadId: "u1", PartSize: s3.MinPartSize, Parts: []s3.S3CompletedPart{{PartNumber: 1, ETag: `"e1"`}, {PartNumber: 2, ETag: `"e2b"`}}}
+	if u := replayed.upload("big"); !reflect.DeepEqual(u, expected) {
+		t.Errorf("upload is %+v, expected %+v", u, expected)
+	}
+	if u := replayed.upload("done"); u != nil {
+		t.Errorf("upload of a completed object is %+v", u)
+	}
+}
+
+func TestJournalRecordsSinglePart(t *testing.T) {
+	j := newJournalForTest(t)
+	upload := &s3.S3MultipartUpload{Key: "big", UploadId: "u1", PartSize: s3.MinPartSize}
+	if err := j.VisitUpload(upload); err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i <= 100; i++ {
+		upload.Parts = append(upload.Parts, s3.S3CompletedPart{PartNumber: i, ETag: fmt.Sprintf(`"%032d"`, i)})
+		if err := j.VisitUpload(upload); err != nil {
+			t.Fatal(err)
+		}
+	}
+	b, err := ioutil.ReadFile(j.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+	for _, line := range lines[2:] {
+		if strings.Count(line, "etag") != 1 {
+			t.Fatalf("record %s holds more than one part", line)
+		}
+	}
+	if u := j.upload("big"); len(u.Parts) != 100 || u.Parts[99].PartNumber != 100 {
+		t.Errorf("upload has %d parts, expected 100", len(u.Parts))
+	}
+}
+
+func TestResumeJournalRequiresSameCommand(t *testing.T) {
+	j := newJournalForTest(t)
+	if _, err := resumeJournal(j.path, "down", "bkt", []string{"bkt", "dir"}); err == nil {
+		t.Error("journal of up was resumed by down")
+	}
+	if _, err := resumeJournal(j.path, "up", "bkt", []string{"bkt", "other"}); err == nil {
+		t.Error("journal was resumed with other arguments")
+	}
+	resumed, err := resumeJournal(j.path, "up", "bkt", []string{"bkt", "dir"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resumed.file.Close()
+}
+
+func TestResumeHint(t *testing.T) {
+	saved := os.Args
+	defer func() { os.Args = saved }()
+	os.Args = []string{"/usr/bin/s3", "up", "-r", "bkt", "dir"}
+	var none *journal
+	if err := none.resumeHint(fmt.Errorf("failed")); err.Error() != "failed" {
+		t.Errorf("hint without journal is %q", err)
+	}
+	j := newJournalForTest(t)
+	if err := j.resumeHint(nil); err != nil {
+		t.Errorf("hint of success is %v", err)
+	}
+	expected := "failed (resume with: s3 up -r bkt dir --resume " + j.path + ")"
+	if err := j.resumeHint(fmt.Errorf("failed")); err.Error() != expected {
+		t.Errorf("hint is %q, expected %q", err, expected)
+	}
+	// resumed runs are resumed by the same command line
+	j.resumed = true
+	os.Args = []string{"/usr/bin/s3", "up", "-r", "bkt", "dir", "--resume", j.path}
+	expected = "failed (resume with: s3 up -r bkt dir --resume " + j.path + ")"
+	if err := j.resumeHint(fmt.Errorf("failed")); err.Error() != expected {
+		t.Errorf("hint of a resumed run is %q, expected %q", err, expected)
+	}
+}
+
+// putObjects stores objects holding their keys.
+func putObjects(t *testing.T, store s3.ObjectStore, keys ...string) {
+	t.Helper()
+	for _, key := range keys {
+		err := store.Put(context.Background(), key, strings.NewReader(key), int64(len(key)), s3.S3PutOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestDownResumesFromContinuationToken(t *testing.T) {
+	withDownloadFlags(t, 1, clashFail)
+	downloadFlags.fetchSize = 2
+	downloadFlags.retries = 0
+	memory := s3.NewMemoryStore()
+	putObjects(t, memory, "a", "b", "c", "d", "e")
+	dir := t.TempDir()
+	args := []string{"memory", ""}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	store := &interruptingStore{ObjectStore: memory, key: "d", cancel: cancel}
+	err := downRecursive(ctx, store, "", dir, args)
+	if err == nil || !strings.Contains(err.Error(), "--resume "+downloadFlags.journal) {
+		t.Fatalf("interrupted download returned %v, expected a resume hint", err)
+	}
+
+	// the first page is not listed again, c is completed
+	downloadFlags.resume = downloadFlags.journal
+	store = &interruptingStore{ObjectStore: memory}
+	err = downRecursive(context.Background(), store, "", dir, args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(store.keys, []string{"d", "e"}) {
+		t.Errorf("resumed download got %v, expected [d e]", store.keys)
+	}
+	for _, key := range []string{"a", "b", "c", "d", "e"} {
+		b, err := ioutil.ReadFile(filepath.Join(dir, key))
+		if err != nil || string(b) != key {
+			t.Errorf("%s holds %q (%v)", key, b, err)
+		}
+	}
+	if _, err := os.Stat(downloadFlags.journal); !os.IsNotExist(err) {
+		t.Errorf("journal of the completed download is kept: %v", err)
+	}
+}
+
+func TestDownResumeKeepsExistingFiles(t *testing.T) {
+	withDownloadFlags(t, 1, clashFail)
+	downloadFlags.retries = 0
+	memory := s3.NewMemoryStore()
+	putObjects(t, memory, "a", "b", "c")
+	dir := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(dir, "b"), []byte("mine"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	args := []string{"memory", ""}
+
+	err := downRecursive(context.Background(), memory, "", dir, args)
+	if err == nil || !strings.Contains(err.Error(), "1 object(s) failed") {
+		t.Fatalf("download returned %v, expected the failure of b", err)
+	}
+	downloadFlags.resume = downloadFlags.journal
+	err = downRecursive(context.Background(), memory, "", dir, args)
+	if err == nil || !strings.Contains(err.Error(), "1 object(s) failed") {
+		t.Fatalf("resumed download returned %v, expected the failure of b", err)
+	}
+	b, err := ioutil.ReadFile(filepath.Join(dir, "b"))
+	if err != nil || string(b) != "mine" {
+		t.Errorf("existing file holds %q (%v) after resuming, expected it to be kept", b, err)
+	}
+}
+
+func TestUpResumesCompletedFiles(t *testing.T) {
+	memory := s3.NewMemoryStore()
+	dir := t.TempDir()
+	for _, name := range []string{"a", "b", "c"} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	upAll := func(ctx context.Context, store s3.ObjectStore, j *journal) int {
+		u := &uploader{ctx: ctx, store: store, journal: j, transfers: newTransfers(ctx, 1, 0, false)}
+		for _, name := range []string{"a", "b", "c"} {
+			name := name
+			p := filepath.Join(dir, name)
+			fi, err := os.Stat(p)
+			if err != nil {
+				t.Fatal(err)
+			}
+			u.transfers.submit(func() error { return u.uploadFile(name, p, fi) })
+		}
+		return u.transfers.finish()
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	j := newJournalForTest(t)
+	upAll(ctx, &interruptingStore{ObjectStore: memory, key: "b", cancel: cancel}, j)
+	j.file.Close()
+
+	j, err := resumeJournal(j.path, "up", "bkt", []string{"bkt", "dir"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := &interruptingStore{ObjectStore: memory}
+	if failures := upAll(context.Background(), store, j); failures > 0 {
+		t.Fatalf("%d file(s) failed on resume", failures)
+	}
+	if !reflect.DeepEqual(store.keys, []string{"b", "c"}) {
+		t.Errorf("resumed upload put %v, expected [b c]", store.keys)
+	}
+	if err := j.finish(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// cancellingReader cancels a context once n bytes have been read.
+type cancellingReader struct {
+	io.Reader
+	n      int64
+	cancel context.CancelFunc
+}
+
+func (r *cancellingReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	r.n -= int64(n)
+	if r.n <= 0 {
+		r.cancel()
+	}
+	return n, err
+}
+
+// interruptedUpload uploads content in three parts and interrupts the
+// upload while the second part is read.
+func interruptedUpload(t *testing.T, bucket s3.S3Bucket, key string, content []byte) *journal {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	j := newJournalForTest(t)
+	u := &uploader{ctx: ctx, store: bucket, journal: j}
+	r := &cancellingReader{Reader: bytes.NewReader(content), n: 2 * s3.MinPartSize, cancel: cancel}
+	if err := u.upload(key, r, int64(len(content)), s3.S3PutOptions{}); err == nil {
+		t.Fatal("interrupted upload succeeded")
+	}
+	return j
+}
+
+func TestUpKeepsInterruptedMultipartUpload(t *testing.T) {
+	bucket := emulatedBucket(t)
+	content := bytes.Repeat([]byte("0123456789"), int(5*s3.MinPartSize/20))
+	j := interruptedUpload(t, bucket, "big", content)
+	upload := j.upload("big")
+	if upload == nil || upload.UploadId == "" || len(upload.Parts) != 1 {
+		t.Fatalf("upload recorded is %+v, expected the upload with its first part", upload)
+	}
+	j.file.Close()
+
+	j, err := resumeJournal(j.path, "up", "bkt", []string{"bkt", "dir"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	u := &uploader{ctx: context.Background(), store: bucket, journal: j}
+	if err := u.upload("big", bytes.NewReader(content), int64(len(content)), s3.S3PutOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	obj, err := bucket.Get(context.Background(), "big", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer obj.Body.Close()
+	b, err := ioutil.ReadAll(obj.Body)
+	if err != nil || !bytes.Equal(b, content) {
+		t.Errorf("resumed upload stored %d bytes (%v), expected %d", len(b), err, len(content))
+	}
+	if !strings.HasSuffix(obj.ETag, `-3"`) {
+		t.Errorf("ETag of the resumed upload is %s, expected one of 3 parts", obj.ETag)
+	}
+	if err := bucket.AbortUpload(context.Background(), upload); err == nil {
+		t.Error("the interrupted upload was not the one completed")
+	}
+}
+
+func TestJobsCleanAbortsUploads(t *testing.T) {
+	bucket := emulatedBucket(t)
+	content := bytes.Repeat([]byte("0123456789"), int(5*s3.MinPartSize/20))
+	j := interruptedUpload(t, bucket, "big", content)
+	upload := j.upload("big")
+	j.file.Close()
+
+	config := filepath.Join(t.TempDir(), "buckets.yaml")
+	err := ioutil.WriteFile(config, []byte(fmt.Sprintf("buckets:\n  - name: bkt\n    endpoint: %s\n    accesskeyid: AK\n    secretkey: SK\n    region: us-east-1\n", bucket.Endpoint)), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	savedConfig := configFile
+	defer func() {
+		configFile = savedConfig
+		rootCmd.SetArgs(nil)
+		viper.Reset()
+	}()
+	rootCmd.SetArgs([]string{"--config", config, "jobs", "clean", j.path})
+	out := captureStdout(t, func() error { return rootCmd.ExecuteContext(context.Background()) })
+	if out != j.path+" removed\n" {
+		t.Errorf("jobs clean printed %q", out)
+	}
+	if _, err := os.Stat(j.path); !os.IsNotExist(err) {
+		t.Errorf("journal is kept: %v", err)
+	}
+	// the upload has been aborted already
+	if err := bucket.AbortUpload(context.Background(), upload); err == nil {
+		t.Error("upload of the removed journal is not aborted")
+	}
+}
@@ -0,0 +1,200 @@
+package cmd
+
+import (
+	"crypto/md5"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// keyTemplate renders object keys of uploaded files from templates like
+// backups/{host}/{date:2006-01-02}/{relpath}, where variables are written
+// as {name} or {name:argument}.
+type keyTemplate struct {
+	literals  []string
+	variables []keyVariable
+	delimiter string
+	now       time.Time
+}
+
+type keyVariable struct {
+	name string
+	arg  string
+}
+
+// keyFile describes a file to be uploaded relative to the base of the upload.
+type keyFile struct {
+	path string
+	base string
+	info os.FileInfo
+}
+
+var keyVariables = map[string]string{
+	"relpath":  "path relative to the uploaded directory",
+	"reldir":   "directory of relpath",
+	"abspath":  "absolute path",
+	"basename": "file name",
+	"name":     "file name without extension",
+	"ext":      "file extension including the dot",
+	"mtime":    "modification time in UTC, formatted by an optional Go time layout (default RFC3339)",
+	"date":     "time of the upload in UTC, formatted by an optional Go time layout (default 2006-01-02)",
+	"host":     "host name",
+	"hash":     "leading hex digits of the MD5 checksum, an optional length (default 8)",
+}
+
+// keyModeTemplates translate the key modes used before templates existed.
+var keyModeTemplates = map[string]string{
+	"B": "{basename}",
+	"A": "{abspath}",
+	"R": "{relpath}",
+}
+
+func parseKeyTemplate(template string, delimiter string, now time.Time) (*keyTemplate, error) {
+	t := &keyTemplate{delimiter: delimiter, now: now}
+	rest := template
+	for {
+		start := strings.Index(rest, "{")
+		if start < 0 {
+			if strings.Contains(rest, "}") {
+				return nil, fmt.Errorf("unbalanced '}' in key template '%s'", template)
+			}
+			t.literals = append(t.literals, rest)
+			return t, nil
+		}
+		end := strings.Index(rest[start:], "}")
+		if end < 0 {
+			return nil, fmt.Errorf("unbalanced '{' in key template '%s'", template)
+		}
+		literal := rest[:start]
+		if strings.Contains(literal, "}") {
+			return nil, fmt.Errorf("unbalanced '}' in key template '%s'", template)
+		}
+		v := keyVariable{name: rest[start+1 : start+end]}
+		if i := strings.Index(v.name, ":"); i >= 0 {
+			v.name, v.arg = v.name[:i], v.name[i+1:]
+		}
+		if _, ok := keyVariables[v.name]; !ok {
+			return nil, fmt.Errorf("unknown variable {%s} in key template '%s'", v.name, template)
+		}
+		if v.name == "hash" && v.arg != "" {
+			if n, err := strconv.Atoi(v.arg); err != nil || n < 1 || n > 2*md5.Size {
+				return nil, fmt.Errorf("invalid hash length '%s' in key template '%s'", v.arg, template)
+			}
+		}
+		t.literals = append(t.literals, literal)
+		t.variables = append(t.variables, v)
+		rest = rest[start+end+1:]
+	}
+}
+
+func (t *keyTemplate) render(f keyFile) (string, error) {
+	var sb strings.Builder
+	for i, v := range t.variables {
+		sb.WriteString(t.literals[i])
+		value, err := t.value(v, f)
+		if err != nil {
+			return "", err
+		}
+		sb.WriteString(value)
+	}
+	sb.WriteString(t.literals[len(t.literals)-1])
+	return sb.String(), nil
+}
+
+// literalPrefix returns the constant beginning of all rendered keys.
+func (t *keyTemplate) literalPrefix() string {
+	return t.literals[0]
+}
+
+func (t *keyTemplate) value(v keyVariable, f keyFile) (string, error) {
+	base := filepath.Base(f.path)
+	switch v.name {
+	case "relpath", "reldir":
+		rel, err := relativePath(f.base, f.path)
+		if err != nil {
+			return "", err
+		}
+		if v.name == "reldir" {
+			rel = filepath.Dir(rel)
+			if rel == "." {
+				return "", nil
+			}
+		}
+		return t.toKey(rel), nil
+	case "abspath":
+		abs, err := filepath.Abs(f.path)
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimPrefix(t.toKey(abs), t.delimiter), nil
+	case "basename":
+		return base, nil
+	case "name":
+		return strings.TrimSuffix(base, filepath.Ext(base)), nil
+	case "ext":
+		return filepath.Ext(base), nil
+	case "mtime":
+		return formatTime(f.info.ModTime().UTC(), v.arg, time.RFC3339), nil
+	case "date":
+		return formatTime(t.now.UTC(), v.arg, "2006-01-02"), nil
+	case "host":
+		host, err := os.Hostname()
+		if err != nil {
+			return "", err
+		}
+		return strings.SplitN(host, ".", 2)[0], nil
+	case "hash":
+		n := 8
+		if v.arg != "" {
+			n, _ = strconv.Atoi(v.arg)
+		}
+		sum, err := md5File(f.path)
+		if err != nil {
+			return "", err
+		}
+		return sum[:n], nil
+	}
+	return "", fmt.Errorf("unknown variable {%s}", v.name)
+}
+
+func (t *keyTemplate) toKey(p string) string {
+	return strings.ReplaceAll(filepath.ToSlash(p), "/", t.delimiter)
+}
+
+// relativePath resolves a path relative to base, both may be relative to
+// the working directory.
+func relativePath(base string, p string) (string, error) {
+	absBase, err := filepath.Abs(base)
+	if err != nil {
+		return "", err
+	}
+	abs, err := filepath.Abs(p)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Rel(absBase, abs)
+}
+
+func formatTime(t time.Time, layout string, defaultLayout string) string {
+	if layout == "" {
+		layout = defaultLayout
+	}
+	return t.Format(layout)
+}
+
+func md5File(p string) (string, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	hash := md5.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", hash.Sum(nil)), nil
+}
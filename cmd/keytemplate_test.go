@@ -0,0 +1,148 @@
+package cmd
+
+import (
+	"crypto/md5"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// inTempDir changes into a temporary directory holding dir/sub/file.tar.gz
+// for the duration of the test.
+func inTempDir(t *testing.T) string {
+	t.Helper()
+	dir, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+	p := filepath.Join(dir, "dir", "sub", "file.tar.gz")
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(p, []byte("content"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	mtime := time.Date(2026, 3, 4, 23, 30, 0, 0, time.FixedZone("UTC-2", -2*60*60))
+	if err := os.Chtimes(p, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func renderKey(t *testing.T, template string, delimiter string, now time.Time, path string, base string) string {
+	t.Helper()
+	kt, err := parseKeyTemplate(template, delimiter, now)
+	if err != nil {
+		t.Fatalf("parsing '%s' failed: %v", template, err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := kt.render(keyFile{path: path, base: base, info: info})
+	if err != nil {
+		t.Fatalf("rendering '%s' failed: %v", template, err)
+	}
+	return key
+}
+
+func TestKeyModes(t *testing.T) {
+	dir := inTempDir(t)
+	abs := strings.TrimPrefix(filepath.ToSlash(filepath.Join(dir, "dir", "sub", "file.tar.gz")), "/")
+	tests := []struct {
+		mode string
+		path string
+		base string
+		key  string
+	}{
+		{"B", "dir/sub/file.tar.gz", "dir", "file.tar.gz"},
+		{"A", "dir/sub/file.tar.gz", "dir", abs},
+		{"A", filepath.Join(dir, "dir/sub/file.tar.gz"), "dir", abs},
+		{"R", "dir/sub/file.tar.gz", "dir", "sub/file.tar.gz"},
+		// relative bases are resolved against the working directory like
+		// relative and absolute paths
+		{"R", filepath.Join(dir, "dir/sub/file.tar.gz"), "dir", "sub/file.tar.gz"},
+		{"R", "dir/sub/file.tar.gz", filepath.Join(dir, "dir"), "sub/file.tar.gz"},
+		{"R", "./dir/sub/../sub/file.tar.gz", "./dir/", "sub/file.tar.gz"},
+		{"R", "dir/sub/file.tar.gz", ".", "dir/sub/file.tar.gz"},
+		{"R", "dir/sub/file.tar.gz", "dir/sub/file.tar.gz", "."},
+	}
+	for _, test := range tests {
+		key := renderKey(t, keyModeTemplates[test.mode], "/", time.Now(), test.path, test.base)
+		if key != test.key {
+			t.Errorf("mode %s of %s below %s is %s, expected %s", test.mode, test.path, test.base, key, test.key)
+		}
+	}
+}
+
+func TestKeyTemplateVariables(t *testing.T) {
+	inTempDir(t)
+	host, err := os.Hostname()
+	if err != nil {
+		t.Fatal(err)
+	}
+	host = strings.SplitN(host, ".", 2)[0]
+	hash := fmt.Sprintf("%x", md5.Sum([]byte("content")))
+	// the upload happens on the 5th of March in UTC, but on the 4th locally
+	now := time.Date(2026, 3, 5, 1, 0, 0, 0, time.FixedZone("UTC-3", -3*60*60)).Add(-2 * time.Hour)
+	tests := []struct {
+		template  string
+		delimiter string
+		key       string
+	}{
+		{"{relpath}", "/", "sub/file.tar.gz"},
+		{"{relpath}", "_", "sub_file.tar.gz"},
+		{"{reldir}", "/", "sub"},
+		{"x/{reldir}/{basename}", "/", "x/sub/file.tar.gz"},
+		{"{basename}", "/", "file.tar.gz"},
+		{"{name}", "/", "file.tar"},
+		{"{ext}", "/", ".gz"},
+		{"{mtime}", "/", "2026-03-05T01:30:00Z"},
+		{"{mtime:2006/01}", "/", "2026/03"},
+		{"{date}", "/", "2026-03-05"},
+		{"{date:15h}", "/", "02h"},
+		{"{host}", "/", host},
+		{"{hash}", "/", hash[:8]},
+		{"{hash:3}", "/", hash[:3]},
+		{"{hash:32}", "/", hash},
+		{"backups/{host}/{date:2006-01-02}/{relpath}", "/", "backups/" + host + "/2026-03-05/sub/file.tar.gz"},
+		{"no variables", "/", "no variables"},
+	}
+	for _, test := range tests {
+		key := renderKey(t, test.template, test.delimiter, now, "dir/sub/file.tar.gz", "dir")
+		if key != test.key {
+			t.Errorf("'%s' rendered %s, expected %s", test.template, key, test.key)
+		}
+	}
+	// files directly below the base have no directory
+	if key := renderKey(t, "{reldir}|{relpath}", "/", now, "dir/sub/file.tar.gz", "dir/sub"); key != "|file.tar.gz" {
+		t.Errorf("'{reldir}|{relpath}' rendered %s, expected |file.tar.gz", key)
+	}
+}
+
+func TestKeyTemplateErrors(t *testing.T) {
+	for _, template := range []string{"{relpath", "relpath}", "a}{relpath}", "{unknown}", "{hash:0}", "{hash:33}", "{hash:x}"} {
+		if _, err := parseKeyTemplate(template, "/", time.Now()); err == nil {
+			t.Errorf("parsing '%s' succeeded", template)
+		}
+	}
+	kt, err := parseKeyTemplate("prefix/{relpath}", "/", time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if kt.literalPrefix() != "prefix/" {
+		t.Errorf("literal prefix is '%s', expected 'prefix/'", kt.literalPrefix())
+	}
+}
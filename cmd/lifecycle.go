@@ -0,0 +1,273 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	s3base "s3cli/base"
+	s3 "s3cli/s3"
+	"strings"
+
+	cobra "github.com/spf13/cobra"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// formats of lifecycle configurations
+const (
+	formatYAML = "yaml"
+	formatJSON = "json"
+	formatXML  = "xml"
+)
+
+var (
+	lifecycleFlags = struct {
+		output string
+		format string
+		yes    bool
+		dryRun bool
+	}{
+		output: formatYAML,
+		format: "",
+		yes:    false,
+		dryRun: false,
+	}
+	lifecycleCmd = &cobra.Command{
+		Use:   "lifecycle",
+		Short: "manage the lifecycle rules of buckets",
+		Long: `prints, replaces or deletes the lifecycle rules of a bucket, which transition
+objects to other storage classes or expire them. The rules are written as
+YAML or JSON like
+
+rules:
+  - id: logs
+    prefix: logs/
+    tags: {team: web}
+    transitions:
+      - days: 30
+        storageClass: STANDARD_IA
+    expiration:
+      days: 365
+    noncurrentVersionExpiration:
+      noncurrentDays: 30
+    abortIncompleteMultipartUpload:
+      daysAfterInitiation: 7
+
+or in the XML format of S3.`,
+	}
+	lifecycleGetCmd = &cobra.Command{
+		Use:        "get [flags] <bucket-name>",
+		Short:      "print lifecycle rules",
+		RunE:       lifecycleGet,
+		Args:       cobra.ExactArgs(1),
+		ArgAliases: []string{"bucket"},
+	}
+	lifecyclePutCmd = &cobra.Command{
+		Use:   "put [flags] <bucket-name> <file>",
+		Short: "replace lifecycle rules",
+		Long: `checks the rules of the file, - for stdin, and replaces the rules of the bucket
+by them. The changes of existing rules are shown and have to be confirmed.`,
+		RunE:       lifecyclePut,
+		Args:       cobra.ExactArgs(2),
+		ArgAliases: []string{"bucket", "file"},
+	}
+	lifecycleDeleteCmd = &cobra.Command{
+		Use:        "delete [flags] <bucket-name>",
+		Short:      "delete lifecycle rules",
+		RunE:       lifecycleDelete,
+		Args:       cobra.ExactArgs(1),
+		ArgAliases: []string{"bucket"},
+	}
+)
+
+func init() {
+	lifecycleGetCmd.PersistentFlags().StringVarP(&lifecycleFlags.output, "output", "o", lifecycleFlags.output, "output format, one of yaml, json or xml")
+	lifecyclePutCmd.PersistentFlags().StringVar(&lifecycleFlags.format, "format", lifecycleFlags.format, "format of the file, one of yaml, json or xml (defaults to its extension)")
+	lifecyclePutCmd.PersistentFlags().BoolVarP(&lifecycleFlags.yes, "yes", "y", lifecycleFlags.yes, "replace existing rules without confirmation")
+	lifecyclePutCmd.PersistentFlags().BoolVar(&lifecycleFlags.dryRun, "dry-run", lifecycleFlags.dryRun, "only check the rules and show the changes")
+	lifecycleCmd.AddCommand(lifecycleGetCmd, lifecyclePutCmd, lifecycleDeleteCmd)
+	rootCmd.AddCommand(lifecycleCmd)
+}
+
+// readLifecycleFile reads a lifecycle configuration, the format is taken
+// from the extension of the file unless given.
+func readLifecycleFile(path string, format string) (*s3.S3LifecycleConfiguration, error) {
+	if format == "" {
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".json":
+			format = formatJSON
+		case ".xml":
+			format = formatXML
+		default:
+			format = formatYAML
+		}
+	}
+	var b []byte
+	var err error
+	if path == "-" {
+		b, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		b, err = ioutil.ReadFile(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	config := &s3.S3LifecycleConfiguration{}
+	switch format {
+	case formatYAML:
+		// unknown fields are rather typos than to be ignored
+		err = yaml.UnmarshalStrict(b, config)
+	case formatJSON:
+		decoder := json.NewDecoder(bytes.NewReader(b))
+		decoder.DisallowUnknownFields()
+		err = decoder.Decode(config)
+	case formatXML:
+		config, err = s3.ParseLifecycleXML(b)
+	default:
+		return nil, fmt.Errorf("invalid format %s specified - allowed values are: %s, %s or %s", format, formatYAML, formatJSON, formatXML)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading lifecycle rules of %s: %v", path, err)
+	}
+	withDefaults := config.WithDefaults()
+	return &withDefaults, nil
+}
+
+func formatLifecycle(config *s3.S3LifecycleConfiguration, format string) ([]byte, error) {
+	switch format {
+	case formatYAML:
+		return yaml.Marshal(config)
+	case formatJSON:
+		b, err := json.MarshalIndent(config, "", "  ")
+		return append(b, '\n'), err
+	case formatXML:
+		b, err := config.XML()
+		return append(b, '\n'), err
+	}
+	return nil, fmt.Errorf("invalid output format %s specified - allowed values are: %s, %s or %s", format, formatYAML, formatJSON, formatXML)
+}
+
+func lifecycleGet(cmd *cobra.Command, args []string) error {
+	bucket, err := FindBucket(args[0])
+	if err != nil {
+		return err
+	}
+	config, err := bucket.GetLifecycle(cmd.Context())
+	if err != nil {
+		return fmt.Errorf("error getting lifecycle rules of %s: %w", bucket.Name, err)
+	}
+	if len(config.Rules) == 0 {
+		return fmt.Errorf("bucket %s has no lifecycle rules", bucket.Name)
+	}
+	b, err := formatLifecycle(config, lifecycleFlags.output)
+	if err != nil {
+		return err
+	}
+	os.Stdout.Write(b)
+	return nil
+}
+
+func lifecyclePut(cmd *cobra.Command, args []string) error {
+	config, err := readLifecycleFile(args[1], lifecycleFlags.format)
+	if err != nil {
+		return err
+	}
+	err = config.Validate()
+	if err != nil {
+		return err
+	}
+	bucket, err := FindBucket(args[0])
+	if err != nil {
+		return err
+	}
+	current, err := bucket.GetLifecycle(cmd.Context())
+	if err != nil {
+		return fmt.Errorf("error getting lifecycle rules of %s: %w", bucket.Name, err)
+	}
+	if len(current.Rules) > 0 {
+		changed, err := printLifecycleDiff(current, config)
+		if err != nil {
+			return err
+		}
+		if !changed {
+			fmt.Println("lifecycle rules are unchanged")
+			return nil
+		}
+		if lifecycleFlags.dryRun {
+			return nil
+		}
+		if !lifecycleFlags.yes {
+			ok, err := confirm(fmt.Sprintf("replace the lifecycle rules of %s?", bucket.Name), args[1] != "-")
+			if err != nil {
+				return err
+			}
+			if !ok {
+				fmt.Printf("lifecycle rules of %s not replaced\n", bucket.Name)
+				return nil
+			}
+		}
+	} else if lifecycleFlags.dryRun {
+		fmt.Printf("bucket %s has no lifecycle rules yet\n", bucket.Name)
+		return nil
+	}
+	err = bucket.PutLifecycle(cmd.Context(), *config)
+	if err != nil {
+		return fmt.Errorf("error putting lifecycle rules of %s: %w", bucket.Name, err)
+	}
+	fmt.Printf("%d lifecycle rule(s) of %s put\n", len(config.Rules), bucket.Name)
+	return nil
+}
+
+// printLifecycleDiff shows the changes between the configurations as YAML.
+func printLifecycleDiff(current *s3.S3LifecycleConfiguration, config *s3.S3LifecycleConfiguration) (bool, error) {
+	a, err := yaml.Marshal(current)
+	if err != nil {
+		return false, err
+	}
+	b, err := yaml.Marshal(config)
+	if err != nil {
+		return false, err
+	}
+	if bytes.Equal(a, b) {
+		return false, nil
+	}
+	fmt.Println("--- current")
+	fmt.Println("+++ new")
+	split := func(b []byte) []string { return strings.Split(strings.TrimSuffix(string(b), "\n"), "\n") }
+	for _, line := range s3base.DiffLines(split(a), split(b)) {
+		fmt.Println(line)
+	}
+	return true, nil
+}
+
+// confirm asks the user on the terminal, it fails if stdin is not a
+// terminal or is not free to be read.
+func confirm(question string, stdinFree bool) (bool, error) {
+	if !stdinFree || !s3base.IsTerminal(os.Stdin) {
+		return false, fmt.Errorf("can not ask for confirmation, use the yes flag")
+	}
+	fmt.Printf("%s [y/N] ", question)
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return false, err
+	}
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes", nil
+}
+
+func lifecycleDelete(cmd *cobra.Command, args []string) error {
+	bucket, err := FindBucket(args[0])
+	if err != nil {
+		return err
+	}
+	err = bucket.DeleteLifecycle(cmd.Context())
+	if err != nil {
+		return fmt.Errorf("error deleting lifecycle rules of %s: %w", bucket.Name, err)
+	}
+	fmt.Printf("lifecycle rules of %s deleted\n", bucket.Name)
+	return nil
+}
@@ -0,0 +1,189 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	s3base "s3cli/base"
+	s3 "s3cli/s3"
+	"strconv"
+	"time"
+
+	cobra "github.com/spf13/cobra"
+)
+
+var (
+	lifecycleSimulateFlags = struct {
+		rules         string
+		format        string
+		at            string
+		fetchSize     int
+		parallel      int
+		humanReadable bool
+	}{
+		rules:         "",
+		format:        "",
+		at:            "",
+		fetchSize:     1000,
+		parallel:      8,
+		humanReadable: false,
+	}
+	lifecycleSimulateCmd = &cobra.Command{
+		Use:   "simulate [flags] <bucket-name>",
+		Short: "show what lifecycle rules would do",
+		Long: `applies lifecycle rules, by default the ones of the bucket, to its current
+objects and prints the transitions and expirations they would cause as
+
+<date>	<action>	<size>	<key>	<rule>
+
+followed by the number of objects and bytes of each action. Without the at
+flag all future actions are shown, otherwise the ones up to the date. Rules
+on noncurrent versions, delete markers and multipart uploads are ignored.`,
+		RunE:       lifecycleSimulate,
+		Args:       cobra.ExactArgs(1),
+		ArgAliases: []string{"bucket"},
+	}
+)
+
+func init() {
+	lifecycleSimulateCmd.PersistentFlags().StringVar(&lifecycleSimulateFlags.rules, "rules", lifecycleSimulateFlags.rules, "file of the rules to simulate instead of the rules of the bucket")
+	lifecycleSimulateCmd.PersistentFlags().StringVar(&lifecycleSimulateFlags.format, "format", lifecycleSimulateFlags.format, "format of the file, one of yaml, json or xml (defaults to its extension)")
+	lifecycleSimulateCmd.PersistentFlags().StringVar(&lifecycleSimulateFlags.at, "at", lifecycleSimulateFlags.at, "only show the actions up to this date, i.e. 2027-01-01")
+	lifecycleSimulateCmd.PersistentFlags().IntVarP(&lifecycleSimulateFlags.fetchSize, "fetch-size", "n", lifecycleSimulateFlags.fetchSize, "fetch objects in batches of this size")
+	lifecycleSimulateCmd.PersistentFlags().IntVarP(&lifecycleSimulateFlags.parallel, "parallel", "P", lifecycleSimulateFlags.parallel, "fetch the tags of this many objects concurrently")
+	lifecycleSimulateCmd.PersistentFlags().BoolVarP(&lifecycleSimulateFlags.humanReadable, "human-readable", "H", lifecycleSimulateFlags.humanReadable, "print object sizes by the powers of 1024 instead of in bytes")
+	lifecycleCmd.AddCommand(lifecycleSimulateCmd)
+}
+
+// lifecycleTotal sums up the objects of an action.
+type lifecycleTotal struct {
+	action string
+	count  int
+	size   int64
+}
+
+type simulatingItemVisitor struct {
+	ctx    context.Context
+	bucket s3.S3Bucket
+	config *s3.S3LifecycleConfiguration
+	// at is zero if all actions are shown
+	at     time.Time
+	totals []*lifecycleTotal
+}
+
+// describeLifecycleAction names the action like the totals are grouped.
+func describeLifecycleAction(action s3.S3LifecycleAction) string {
+	if action.Action == s3.LifecycleTransition {
+		return "transition to " + action.StorageClass
+	}
+	return action.Action
+}
+
+func (siv *simulatingItemVisitor) formatSize(size int64) string {
+	if lifecycleSimulateFlags.humanReadable {
+		return s3base.ByteCountIEC(size)
+	}
+	return strconv.FormatInt(size, 10)
+}
+
+func (siv *simulatingItemVisitor) add(action string, size int64) {
+	for _, total := range siv.totals {
+		if total.action == action {
+			total.count++
+			total.size += size
+			return
+		}
+	}
+	siv.totals = append(siv.totals, &lifecycleTotal{action: action, count: 1, size: size})
+}
+
+// needsTags tells whether a rule filtering by tags matches the object apart
+// from its tags, only then they are fetched.
+func (siv *simulatingItemVisitor) needsTags(item s3.S3Item) bool {
+	for _, rule := range siv.config.Rules {
+		if len(rule.Tags) > 0 && rule.Status != s3.LifecycleDisabled && rule.Matches(item, rule.Tags) {
+			return true
+		}
+	}
+	return false
+}
+
+func (siv *simulatingItemVisitor) VisitListing(partialResult *s3.S3ListBucketResult) (bool, error) {
+	var keys []string
+	var indexes []int
+	for i, item := range partialResult.Contents {
+		if siv.needsTags(item) {
+			keys = append(keys, item.Key)
+			indexes = append(indexes, i)
+		}
+	}
+	tags := make([]map[string]string, len(partialResult.Contents))
+	fetched, err := fetchTags(siv.ctx, siv.bucket, keys, lifecycleSimulateFlags.parallel)
+	if err != nil {
+		return false, err
+	}
+	for i, index := range indexes {
+		tags[index] = fetched[i]
+	}
+	for i, item := range partialResult.Contents {
+		for _, action := range siv.config.Actions(item, tags[i]) {
+			if !siv.at.IsZero() && action.Date.After(siv.at) {
+				break
+			}
+			description := describeLifecycleAction(action)
+			siv.add(description, item.Size)
+			fmt.Printf("%s\t%s\t%s\t%s\t%s\n", action.Date.Format("2006-01-02"), description, siv.formatSize(item.Size), item.Key, action.Rule)
+		}
+	}
+	return true, nil
+}
+
+func lifecycleSimulate(cmd *cobra.Command, args []string) error {
+	var at time.Time
+	if lifecycleSimulateFlags.at != "" {
+		var err error
+		at, err = s3.ParseLifecycleDate(lifecycleSimulateFlags.at)
+		if err != nil {
+			return err
+		}
+	}
+	bucket, err := FindBucket(args[0])
+	if err != nil {
+		return err
+	}
+	var config *s3.S3LifecycleConfiguration
+	if lifecycleSimulateFlags.rules != "" {
+		config, err = readLifecycleFile(lifecycleSimulateFlags.rules, lifecycleSimulateFlags.format)
+		if err != nil {
+			return err
+		}
+		err = config.Validate()
+		if err != nil {
+			return err
+		}
+	} else {
+		config, err = bucket.GetLifecycle(cmd.Context())
+		if err != nil {
+			return fmt.Errorf("error getting lifecycle rules of %s: %w", bucket.Name, err)
+		}
+		if len(config.Rules) == 0 {
+			return fmt.Errorf("bucket %s has no lifecycle rules", bucket.Name)
+		}
+	}
+	visitor := &simulatingItemVisitor{ctx: cmd.Context(), bucket: bucket, config: config, at: at}
+	prefix := config.Prefix()
+	err = bucket.List(cmd.Context(), prefix, lifecycleSimulateFlags.fetchSize, visitor)
+	if err != nil {
+		return s3base.WithExitCode(exitListing, fmt.Errorf("error listing %s: %w", prefix, err))
+	}
+	if len(visitor.totals) == 0 {
+		fmt.Println("no object(s) affected")
+	}
+	for _, total := range visitor.totals {
+		size := visitor.formatSize(total.size)
+		if !lifecycleSimulateFlags.humanReadable {
+			size += " B"
+		}
+		fmt.Printf("%s: %d object(s) using %s\n", total.action, total.count, size)
+	}
+	return nil
+}
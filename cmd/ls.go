@@ -1,6 +1,7 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	s3base "s3cli/base"
 	s3 "s3cli/s3"
@@ -21,17 +22,23 @@ var (
 		fetchSize      int
 		humanReadable  bool
 		longListFormat bool
+		versions       bool
+		tags           []string
+		parallel       int
 	}{
 		fetchSize:      1000,
 		humanReadable:  false,
 		longListFormat: false,
+		versions:       false,
+		tags:           []string{},
+		parallel:       8,
 	}
 	lsCmd = &cobra.Command{
 		Use:        "ls [flags] <bucket> [prefix]",
 		Aliases:    []string{"get", "list"},
 		Short:      "list objects",
 		Long:       `list information about objects in S3`,
-		Run:        ls,
+		RunE:       ls,
 		Args:       cobra.MinimumNArgs(1),
 		ArgAliases: []string{"bucket", "prefix"},
 	}
@@ -41,16 +48,44 @@ func init() {
 	lsCmd.PersistentFlags().IntVarP(&lsFlags.fetchSize, "fetch-size", "n", lsFlags.fetchSize, "fetch objects in batches of this size")
 	lsCmd.PersistentFlags().BoolVarP(&lsFlags.longListFormat, "long-list", "l", lsFlags.longListFormat, "use a long listing format")
 	lsCmd.PersistentFlags().BoolVarP(&lsFlags.humanReadable, "human-readable", "H", lsFlags.humanReadable, "print object sizes by the powers of 1024 instead of in bytes")
+	lsCmd.PersistentFlags().BoolVar(&lsFlags.versions, "versions", lsFlags.versions, "list all versions of the objects including delete markers")
+	lsCmd.PersistentFlags().StringArrayVar(&lsFlags.tags, "tag", lsFlags.tags, "list only objects with this tag given as key=value (repeatable)")
+	lsCmd.PersistentFlags().IntVarP(&lsFlags.parallel, "parallel", "P", lsFlags.parallel, "fetch the tags of this many objects concurrently")
 	rootCmd.AddCommand(lsCmd)
 }
 
-func ls(cmd *cobra.Command, args []string) {
+func ls(cmd *cobra.Command, args []string) error {
 	prefix := ""
 	if len(args) > 1 {
 		prefix = args[1]
 	}
-	bucket := FindBucket(args[0])
-	bucket.List(prefix, lsFlags.fetchSize, dumpingItemVisitor{})
+	if lsFlags.versions {
+		if len(lsFlags.tags) > 0 {
+			return fmt.Errorf("versions can not be filtered by tags")
+		}
+		return lsVersions(cmd.Context(), args[0], prefix)
+	}
+	store, err := FindStore(args[0])
+	if err != nil {
+		return err
+	}
+	var visitor s3.S3ListBucketResultVisitor = dumpingItemVisitor{}
+	if len(lsFlags.tags) > 0 {
+		tags, err := s3base.ParseKeyValues(lsFlags.tags)
+		if err != nil {
+			return err
+		}
+		bucket, ok := store.(s3.S3Bucket)
+		if !ok {
+			return fmt.Errorf("bucket '%s' has no tags, only S3 buckets are supported", args[0])
+		}
+		visitor = &tagFilteringItemVisitor{ctx: cmd.Context(), bucket: bucket, tags: tags, next: visitor}
+	}
+	err = store.List(cmd.Context(), prefix, lsFlags.fetchSize, visitor)
+	if err != nil {
+		return s3base.WithExitCode(exitListing, fmt.Errorf("error listing %s: %w", prefix, err))
+	}
+	return nil
 }
 
 func (div dumpingItemVisitor) VisitListing(partialResult *s3.S3ListBucketResult) (bool, error) {
@@ -67,3 +102,80 @@ func (div dumpingItemVisitor) VisitListing(partialResult *s3.S3ListBucketResult)
 	}
 	return true, nil
 }
+
+// tagFilteringItemVisitor passes the objects having all of the tags on to
+// the next visitor, the tags of the objects of each page are fetched
+// concurrently.
+type tagFilteringItemVisitor struct {
+	ctx    context.Context
+	bucket s3.S3Bucket
+	tags   map[string]string
+	next   s3.S3ListBucketResultVisitor
+}
+
+func (tfv *tagFilteringItemVisitor) VisitListing(partialResult *s3.S3ListBucketResult) (bool, error) {
+	keys := make([]string, 0, len(partialResult.Contents))
+	for _, item := range partialResult.Contents {
+		keys = append(keys, item.Key)
+	}
+	tags, err := fetchTags(tfv.ctx, tfv.bucket, keys, lsFlags.parallel)
+	if err != nil {
+		return false, err
+	}
+	filtered := *partialResult
+	filtered.Contents = nil
+	for i, item := range partialResult.Contents {
+		if hasTags(tags[i], tfv.tags) {
+			filtered.Contents = append(filtered.Contents, item)
+		}
+	}
+	return tfv.next.VisitListing(&filtered)
+}
+
+func hasTags(tags map[string]string, required map[string]string) bool {
+	for k, v := range required {
+		if value, ok := tags[k]; !ok || value != v {
+			return false
+		}
+	}
+	return true
+}
+
+func lsVersions(ctx context.Context, bucketName string, prefix string) error {
+	bucket, err := FindBucket(bucketName)
+	if err != nil {
+		return err
+	}
+	err = bucket.ListVersions(ctx, prefix, lsFlags.fetchSize, dumpingItemVisitor{})
+	if err != nil {
+		return s3base.WithExitCode(exitListing, fmt.Errorf("error listing versions of %s: %w", prefix, err))
+	}
+	return nil
+}
+
+// VisitVersions prints the version id and the state of each version before
+// its key, the state is one of latest, noncurrent or deleted for delete
+// markers.
+func (div dumpingItemVisitor) VisitVersions(partialResult *s3.S3ListVersionsResult) (bool, error) {
+	for _, v := range partialResult.Entries() {
+		state := "noncurrent"
+		if v.DeleteMarker {
+			state = "deleted"
+		} else if v.IsLatest {
+			state = "latest"
+		}
+		row := fmt.Sprintf("%s\t%s\t%s", v.VersionId, state, v.Key)
+		if lsFlags.longListFormat {
+			size := strconv.FormatInt(v.Size, 10)
+			if lsFlags.humanReadable {
+				size = s3base.ByteCountIEC(v.Size)
+			}
+			if v.DeleteMarker {
+				size = "-"
+			}
+			row = fmt.Sprintf("%s\t%s(%s)\t%s\t%s\t%s", v.StorageClass, v.Owner.DisplayName, v.Owner.Id, v.LastModified.Format(time.RFC3339), size, row)
+		}
+		fmt.Println(row)
+	}
+	return true, nil
+}
@@ -0,0 +1,174 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	s3 "s3cli/s3"
+	"strings"
+
+	cobra "github.com/spf13/cobra"
+	viper "github.com/spf13/viper"
+	yaml "gopkg.in/yaml.v2"
+)
+
+var (
+	mbFlags = struct {
+		like       string
+		location   string
+		objectLock bool
+		versioning bool
+		acl        string
+		save       bool
+	}{
+		like:       "",
+		location:   "",
+		objectLock: false,
+		versioning: false,
+		acl:        "",
+		save:       false,
+	}
+	mbCmd = &cobra.Command{
+		Use:   "mb [flags] <bucket-name>",
+		Short: "make a bucket",
+		Long: `creates a bucket. The bucket is either configured or it is created at the
+service of the configured bucket named by the like flag, using its credentials.
+With the save flag, the new bucket is appended to the buckets of the
+configuration file.`,
+		RunE:       mb,
+		Args:       cobra.ExactArgs(1),
+		ArgAliases: []string{"bucket"},
+	}
+)
+
+func init() {
+	mbCmd.PersistentFlags().StringVar(&mbFlags.like, "like", mbFlags.like, "create the bucket at the service of this configured bucket")
+	mbCmd.PersistentFlags().StringVar(&mbFlags.location, "location", mbFlags.location, "region of the bucket, the region of the bucket configuration by default")
+	mbCmd.PersistentFlags().BoolVar(&mbFlags.objectLock, "object-lock", mbFlags.objectLock, "enable S3 Object Lock, which enables versioning as well")
+	mbCmd.PersistentFlags().BoolVar(&mbFlags.versioning, "versioning", mbFlags.versioning, "enable versioning")
+	mbCmd.PersistentFlags().StringVar(&mbFlags.acl, "acl", mbFlags.acl, "canned ACL of the bucket, i.e. private")
+	mbCmd.PersistentFlags().BoolVar(&mbFlags.save, "save", mbFlags.save, "append the bucket to the configuration file")
+	rootCmd.AddCommand(mbCmd)
+}
+
+func mb(cmd *cobra.Command, args []string) error {
+	if mbFlags.save && mbFlags.like == "" {
+		return fmt.Errorf("only buckets created like a configured bucket can be saved")
+	}
+	if _, err := findBucketConfig(args[0]); mbFlags.save && err == nil {
+		return fmt.Errorf("bucket '%s' is configured already", args[0])
+	}
+	bucket, err := findBucketOrSibling(args[0], mbFlags.like)
+	if err != nil {
+		return err
+	}
+	if mbFlags.location != "" {
+		bucket.Region = mbFlags.location
+	}
+	err = bucket.Create(cmd.Context(), s3.S3CreateBucketOptions{
+		LocationConstraint: mbFlags.location,
+		ObjectLock:         mbFlags.objectLock,
+		Versioning:         mbFlags.versioning,
+		Acl:                mbFlags.acl,
+	})
+	if err != nil {
+		return fmt.Errorf("error creating bucket %s: %w", bucket.Name, err)
+	}
+	fmt.Printf("bucket %s created\n", bucket.Name)
+	if mbFlags.save {
+		return saveBucketConfig(bucket)
+	}
+	return nil
+}
+
+// savedBucket is the entry of a bucket appended to the configuration file.
+type savedBucket struct {
+	Name        string `yaml:"name"`
+	Endpoint    string `yaml:"endpoint"`
+	AccessKeyId string `yaml:"accesskeyid"`
+	SecretKey   string `yaml:"secretkey"`
+	Region      string `yaml:"region,omitempty"`
+}
+
+var (
+	topLevelKeyPattern = regexp.MustCompile(`^([A-Za-z0-9_-]+)\s*:`)
+	listItemPattern    = regexp.MustCompile(`^(\s*)- `)
+)
+
+// saveBucketConfig appends the bucket to the buckets of the configuration
+// file. The file is extended as text to keep its comments, hence the
+// buckets have to be the last setting of the file.
+func saveBucketConfig(bucket s3.S3Bucket) error {
+	entry, err := yaml.Marshal([]savedBucket{{
+		Name:        bucket.Name,
+		Endpoint:    bucket.Endpoint,
+		AccessKeyId: bucket.AccessKeyId,
+		SecretKey:   bucket.SecretKey,
+		Region:      bucket.Region,
+	}})
+	if err != nil {
+		return err
+	}
+	file := viper.ConfigFileUsed()
+	manually := func(reason string) error {
+		return fmt.Errorf("bucket not saved to %s, %s - append it manually:\n%s", file, reason, entry)
+	}
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".yaml", ".yml":
+	default:
+		return manually("only YAML files are supported")
+	}
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	// the entry is indented like the first bucket
+	lastKey := ""
+	indent := ""
+	listed := false
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if m := topLevelKeyPattern.FindStringSubmatch(line); m != nil {
+			lastKey = m[1]
+			listed = false
+		} else if m := listItemPattern.FindStringSubmatch(line); m != nil && lastKey == "buckets" && !listed {
+			indent = m[1]
+			listed = true
+		}
+	}
+	if lastKey != "buckets" {
+		return manually("its buckets are not its last setting")
+	}
+	if !listed {
+		return manually("it lists no bucket yet")
+	}
+
+	var b bytes.Buffer
+	if len(content) > 0 && content[len(content)-1] != '\n' {
+		b.WriteByte('\n')
+	}
+	for _, line := range strings.SplitAfter(strings.TrimRight(string(entry), "\n"), "\n") {
+		b.WriteString(indent + line)
+	}
+	b.WriteByte('\n')
+	f, err := os.OpenFile(file, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(b.Bytes())
+	if err != nil {
+		f.Close()
+		return err
+	}
+	err = f.Close()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("bucket %s saved to %s\n", bucket.Name, file)
+	return nil
+}
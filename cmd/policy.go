@@ -0,0 +1,268 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	s3 "s3cli/s3"
+	"strings"
+
+	cobra "github.com/spf13/cobra"
+)
+
+var (
+	policyFlags = struct {
+		yes    bool
+		dryRun bool
+	}{
+		yes:    false,
+		dryRun: false,
+	}
+	policyCmd = &cobra.Command{
+		Use:   "policy",
+		Short: "manage the policies of buckets",
+		Long: `prints, checks, replaces or deletes the policy of a bucket and its public
+access block. Policies are checked before they are put, statements allowing
+anyone without conditions and unknown actions are warned about.`,
+	}
+	policyGetCmd = &cobra.Command{
+		Use:        "get [flags] <bucket-name>",
+		Short:      "print the policy",
+		RunE:       policyGet,
+		Args:       cobra.ExactArgs(1),
+		ArgAliases: []string{"bucket"},
+	}
+	policyLintCmd = &cobra.Command{
+		Use:        "lint [flags] <file>",
+		Short:      "check a policy",
+		Long:       `checks the policy of the file, - for stdin, and prints it formatted.`,
+		RunE:       policyLint,
+		Args:       cobra.ExactArgs(1),
+		ArgAliases: []string{"file"},
+		// no buckets need to be configured
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			return setupLogging()
+		},
+	}
+	policyPutCmd = &cobra.Command{
+		Use:   "put [flags] <bucket-name> <file>",
+		Short: "replace the policy",
+		Long: `checks the policy of the file, - for stdin, and replaces the policy of the
+bucket by it. Policies with warnings have to be confirmed.`,
+		RunE:       policyPut,
+		Args:       cobra.ExactArgs(2),
+		ArgAliases: []string{"bucket", "file"},
+	}
+	policyDeleteCmd = &cobra.Command{
+		Use:        "delete [flags] <bucket-name>",
+		Short:      "delete the policy",
+		RunE:       policyDelete,
+		Args:       cobra.ExactArgs(1),
+		ArgAliases: []string{"bucket"},
+	}
+	publicAccessBlockCmd = &cobra.Command{
+		Use:   "public-access-block",
+		Short: "manage the public access block of buckets",
+		Long: `prints, sets or deletes the settings blocking public access to a bucket:
+
+BlockPublicAcls        rejects putting public ACLs
+IgnorePublicAcls       ignores public ACLs
+BlockPublicPolicy      rejects putting public policies
+RestrictPublicBuckets  restricts access to buckets with public policies`,
+	}
+	publicAccessBlockGetCmd = &cobra.Command{
+		Use:        "get [flags] <bucket-name>",
+		Short:      "print the settings",
+		RunE:       publicAccessBlockGet,
+		Args:       cobra.ExactArgs(1),
+		ArgAliases: []string{"bucket"},
+	}
+	publicAccessBlockSetCmd = &cobra.Command{
+		Use:        "set [flags] <bucket-name> all|<setting>...",
+		Short:      "turn on settings",
+		Long:       `turns on the given settings, or all of them, and turns off the others.`,
+		RunE:       publicAccessBlockSet,
+		Args:       cobra.MinimumNArgs(2),
+		ArgAliases: []string{"bucket", "settings"},
+	}
+	publicAccessBlockDeleteCmd = &cobra.Command{
+		Use:        "delete [flags] <bucket-name>",
+		Short:      "turn off all settings",
+		RunE:       publicAccessBlockDelete,
+		Args:       cobra.ExactArgs(1),
+		ArgAliases: []string{"bucket"},
+	}
+)
+
+func init() {
+	policyPutCmd.PersistentFlags().BoolVarP(&policyFlags.yes, "yes", "y", policyFlags.yes, "put policies with warnings without confirmation")
+	policyPutCmd.PersistentFlags().BoolVar(&policyFlags.dryRun, "dry-run", policyFlags.dryRun, "only check the policy")
+	publicAccessBlockCmd.AddCommand(publicAccessBlockGetCmd, publicAccessBlockSetCmd, publicAccessBlockDeleteCmd)
+	policyCmd.AddCommand(policyGetCmd, policyLintCmd, policyPutCmd, policyDeleteCmd, publicAccessBlockCmd)
+	rootCmd.AddCommand(policyCmd)
+}
+
+// readPolicyFile reads and checks a policy, its warnings are printed to
+// stderr whatever the log level.
+func readPolicyFile(path string) ([]byte, []string, error) {
+	var b []byte
+	var err error
+	if path == "-" {
+		b, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		b, err = ioutil.ReadFile(path)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	policy, err := s3.ParsePolicy(b)
+	if err != nil {
+		return nil, nil, err
+	}
+	warnings := policy.Warnings()
+	for _, warning := range warnings {
+		fmt.Fprintln(os.Stderr, "warning:", warning)
+	}
+	return b, warnings, nil
+}
+
+func printPolicy(b []byte) error {
+	var buf bytes.Buffer
+	err := json.Indent(&buf, b, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(strings.TrimSpace(buf.String()))
+	return nil
+}
+
+func policyGet(cmd *cobra.Command, args []string) error {
+	bucket, err := FindBucket(args[0])
+	if err != nil {
+		return err
+	}
+	b, err := bucket.GetPolicy(cmd.Context())
+	if err != nil {
+		return fmt.Errorf("error getting policy of %s: %w", bucket.Name, err)
+	}
+	if b == nil {
+		return fmt.Errorf("bucket %s has no policy", bucket.Name)
+	}
+	return printPolicy(b)
+}
+
+func policyLint(cmd *cobra.Command, args []string) error {
+	b, _, err := readPolicyFile(args[0])
+	if err != nil {
+		return err
+	}
+	return printPolicy(b)
+}
+
+func policyPut(cmd *cobra.Command, args []string) error {
+	b, warnings, err := readPolicyFile(args[1])
+	if err != nil {
+		return err
+	}
+	bucket, err := FindBucket(args[0])
+	if err != nil {
+		return err
+	}
+	if policyFlags.dryRun {
+		return nil
+	}
+	if len(warnings) > 0 && !policyFlags.yes {
+		ok, err := confirm(fmt.Sprintf("put the policy of %s despite %d warning(s)?", bucket.Name, len(warnings)), args[1] != "-")
+		if err != nil {
+			return err
+		}
+		if !ok {
+			fmt.Printf("policy of %s not replaced\n", bucket.Name)
+			return nil
+		}
+	}
+	err = bucket.PutPolicy(cmd.Context(), b)
+	if err != nil {
+		return fmt.Errorf("error putting policy of %s: %w", bucket.Name, err)
+	}
+	fmt.Printf("policy of %s put\n", bucket.Name)
+	return nil
+}
+
+func policyDelete(cmd *cobra.Command, args []string) error {
+	bucket, err := FindBucket(args[0])
+	if err != nil {
+		return err
+	}
+	err = bucket.DeletePolicy(cmd.Context())
+	if err != nil {
+		return fmt.Errorf("error deleting policy of %s: %w", bucket.Name, err)
+	}
+	fmt.Printf("policy of %s deleted\n", bucket.Name)
+	return nil
+}
+
+// publicAccessSettings refers to the settings of the configuration by their
+// names in the order of S3.
+func publicAccessSettings(config *s3.S3PublicAccessBlock) ([]string, []*bool) {
+	return []string{"BlockPublicAcls", "IgnorePublicAcls", "BlockPublicPolicy", "RestrictPublicBuckets"},
+		[]*bool{&config.BlockPublicAcls, &config.IgnorePublicAcls, &config.BlockPublicPolicy, &config.RestrictPublicBuckets}
+}
+
+func publicAccessBlockGet(cmd *cobra.Command, args []string) error {
+	bucket, err := FindBucket(args[0])
+	if err != nil {
+		return err
+	}
+	config, err := bucket.GetPublicAccessBlock(cmd.Context())
+	if err != nil {
+		return fmt.Errorf("error getting public access block of %s: %w", bucket.Name, err)
+	}
+	names, values := publicAccessSettings(config)
+	for i, name := range names {
+		fmt.Printf("%s\t%t\n", name, *values[i])
+	}
+	return nil
+}
+
+func publicAccessBlockSet(cmd *cobra.Command, args []string) error {
+	var config s3.S3PublicAccessBlock
+	names, values := publicAccessSettings(&config)
+	for _, arg := range args[1:] {
+		found := false
+		for i, name := range names {
+			if strings.EqualFold(arg, name) || strings.EqualFold(arg, "all") {
+				*values[i] = true
+				found = true
+			}
+		}
+		if !found {
+			return fmt.Errorf("invalid setting %s specified - allowed values are: all, %s", arg, strings.Join(names, ", "))
+		}
+	}
+	bucket, err := FindBucket(args[0])
+	if err != nil {
+		return err
+	}
+	err = bucket.PutPublicAccessBlock(cmd.Context(), config)
+	if err != nil {
+		return fmt.Errorf("error putting public access block of %s: %w", bucket.Name, err)
+	}
+	fmt.Printf("public access block of %s set\n", bucket.Name)
+	return nil
+}
+
+func publicAccessBlockDelete(cmd *cobra.Command, args []string) error {
+	bucket, err := FindBucket(args[0])
+	if err != nil {
+		return err
+	}
+	err = bucket.DeletePublicAccessBlock(cmd.Context())
+	if err != nil {
+		return fmt.Errorf("error deleting public access block of %s: %w", bucket.Name, err)
+	}
+	fmt.Printf("public access block of %s deleted\n", bucket.Name)
+	return nil
+}
@@ -0,0 +1,131 @@
+package cmd
+
+import (
+	"fmt"
+	"mime"
+	"net/url"
+	"path"
+	s3base "s3cli/base"
+	s3 "s3cli/s3"
+	"strings"
+	"time"
+	"unicode"
+
+	cobra "github.com/spf13/cobra"
+)
+
+var (
+	presignFlags = struct {
+		method             string
+		expires            time.Duration
+		contentDisposition string
+		attachment         bool
+		recursive          bool
+		fetchSize          int
+	}{
+		method:             "GET",
+		expires:            time.Hour,
+		contentDisposition: "",
+		attachment:         false,
+		recursive:          false,
+		fetchSize:          1000,
+	}
+	presignCmd = &cobra.Command{
+		Use:   "presign [flags] <bucket-name> <key>|<key-prefix>",
+		Short: "create presigned URLs",
+		Long: `creates URLs which grant downloading or uploading an object to anyone holding
+them until they expire. With the recursive flag, the key and a URL are printed
+for each object below the prefix.`,
+		RunE:       presign,
+		Args:       cobra.ExactArgs(2),
+		ArgAliases: []string{"bucket", "key"},
+	}
+)
+
+func init() {
+	presignCmd.PersistentFlags().StringVarP(&presignFlags.method, "method", "X", presignFlags.method, "HTTP method granted, i.e. GET or PUT")
+	presignCmd.PersistentFlags().DurationVarP(&presignFlags.expires, "expires", "e", presignFlags.expires, "validity of the URLs, at most 168h")
+	presignCmd.PersistentFlags().StringVar(&presignFlags.contentDisposition, "content-disposition", presignFlags.contentDisposition, "override the Content-Disposition of downloads, i.e. attachment; filename=\"report.pdf\"")
+	presignCmd.PersistentFlags().BoolVar(&presignFlags.attachment, "attachment", presignFlags.attachment, "download as attachment named like the object")
+	presignCmd.PersistentFlags().BoolVarP(&presignFlags.recursive, "recursive", "r", presignFlags.recursive, "presign all objects below the prefix")
+	presignCmd.PersistentFlags().IntVarP(&presignFlags.fetchSize, "fetch-size", "n", presignFlags.fetchSize, "fetch objects in batches of this size")
+	rootCmd.AddCommand(presignCmd)
+}
+
+func presign(cmd *cobra.Command, args []string) error {
+	method := strings.ToUpper(presignFlags.method)
+	switch method {
+	case "GET":
+	case "PUT":
+		if presignFlags.contentDisposition != "" || presignFlags.attachment {
+			return fmt.Errorf("the content disposition can only be overridden for downloads")
+		}
+	default:
+		return fmt.Errorf("invalid method %s specified - allowed values are: GET or PUT", presignFlags.method)
+	}
+	if presignFlags.contentDisposition != "" && presignFlags.attachment {
+		return fmt.Errorf("content disposition and attachment flag can not be combined")
+	}
+	if presignFlags.expires > s3.MaxPresignExpiry {
+		return fmt.Errorf("URLs expire after %v at most", s3.MaxPresignExpiry)
+	}
+	bucket, err := FindBucket(args[0])
+	if err != nil {
+		return err
+	}
+	visitor := &presigningItemVisitor{bucket: bucket, method: method, now: time.Now()}
+	if !presignFlags.recursive {
+		u, err := visitor.presign(args[1])
+		if err != nil {
+			return err
+		}
+		fmt.Println(u)
+		return nil
+	}
+	err = bucket.List(cmd.Context(), args[1], presignFlags.fetchSize, visitor)
+	if err != nil {
+		return s3base.WithExitCode(exitListing, fmt.Errorf("error listing %s: %w", args[1], err))
+	}
+	return nil
+}
+
+// presigningItemVisitor prints the key and a presigned URL of each object.
+type presigningItemVisitor struct {
+	bucket s3.S3Bucket
+	method string
+	now    time.Time
+}
+
+func (piv *presigningItemVisitor) VisitListing(partialResult *s3.S3ListBucketResult) (bool, error) {
+	for _, item := range partialResult.Contents {
+		u, err := piv.presign(item.Key)
+		if err != nil {
+			return false, err
+		}
+		fmt.Printf("%s\t%s\n", item.Key, u)
+	}
+	return true, nil
+}
+
+func (piv *presigningItemVisitor) presign(key string) (string, error) {
+	query := url.Values{}
+	disposition := presignFlags.contentDisposition
+	if presignFlags.attachment {
+		disposition = attachmentDisposition(path.Base(key))
+	}
+	if disposition != "" {
+		query.Set("response-content-disposition", disposition)
+	}
+	return piv.bucket.Presign(piv.method, key, query, presignFlags.expires, piv.now)
+}
+
+// attachmentDisposition formats the Content-Disposition of a download saved
+// as file of the given name, non-ASCII names are encoded by RFC 5987.
+func attachmentDisposition(name string) string {
+	for _, r := range name {
+		if r > unicode.MaxASCII || !unicode.IsPrint(r) {
+			return "attachment; filename*=UTF-8''" + url.PathEscape(name)
+		}
+	}
+	return mime.FormatMediaType("attachment", map[string]string{"filename": name})
+}
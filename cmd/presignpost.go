@@ -0,0 +1,144 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"os"
+	s3base "s3cli/base"
+	s3 "s3cli/s3"
+	"sort"
+	"strings"
+	"time"
+
+	cobra "github.com/spf13/cobra"
+)
+
+const (
+	postOutputJSON = "json"
+	postOutputHTML = "html"
+)
+
+var (
+	presignPostFlags = struct {
+		minSize     string
+		maxSize     string
+		contentType string
+		expires     time.Duration
+		output      string
+	}{
+		minSize:     "",
+		maxSize:     "",
+		contentType: "",
+		expires:     time.Hour,
+		output:      postOutputJSON,
+	}
+	presignPostCmd = &cobra.Command{
+		Use:   "presign-post [flags] <bucket-name> [key-prefix]",
+		Short: "create forms for browser uploads",
+		Long: `creates the fields of an HTML form, which lets browsers upload files below the
+key prefix until the form expires. The file name is appended to the prefix.
+The fields are printed as JSON or as ready-made HTML form, the file has to be
+the last field of the form.`,
+		RunE:       presignPost,
+		Args:       cobra.RangeArgs(1, 2),
+		ArgAliases: []string{"bucket", "key-prefix"},
+	}
+)
+
+func init() {
+	presignPostCmd.PersistentFlags().StringVar(&presignPostFlags.minSize, "min-size", presignPostFlags.minSize, "minimum size of uploads, i.e. 1KiB (requires a maximum size)")
+	presignPostCmd.PersistentFlags().StringVar(&presignPostFlags.maxSize, "max-size", presignPostFlags.maxSize, "maximum size of uploads, i.e. 10MiB")
+	presignPostCmd.PersistentFlags().StringVar(&presignPostFlags.contentType, "content-type", presignPostFlags.contentType, "required prefix of the content type of uploads, i.e. image/")
+	presignPostCmd.PersistentFlags().DurationVarP(&presignPostFlags.expires, "expires", "e", presignPostFlags.expires, "validity of the form, at most 168h")
+	presignPostCmd.PersistentFlags().StringVarP(&presignPostFlags.output, "output", "o", presignPostFlags.output, "output format, one of json or html")
+	rootCmd.AddCommand(presignPostCmd)
+}
+
+func presignPost(cmd *cobra.Command, args []string) error {
+	if presignPostFlags.output != postOutputJSON && presignPostFlags.output != postOutputHTML {
+		return fmt.Errorf("invalid output format %s specified - allowed values are: %s or %s", presignPostFlags.output, postOutputJSON, postOutputHTML)
+	}
+	policy := s3.S3PostPolicy{ContentTypePrefix: presignPostFlags.contentType, Expires: presignPostFlags.expires}
+	if len(args) > 1 {
+		policy.KeyPrefix = args[1]
+	}
+	var err error
+	if presignPostFlags.maxSize != "" {
+		policy.MaxSize, err = s3base.ParseByteSize(presignPostFlags.maxSize)
+		if err != nil {
+			return err
+		}
+	}
+	if presignPostFlags.minSize != "" {
+		if presignPostFlags.maxSize == "" {
+			return fmt.Errorf("a minimum size requires a maximum size")
+		}
+		policy.MinSize, err = s3base.ParseByteSize(presignPostFlags.minSize)
+		if err != nil {
+			return err
+		}
+	}
+	bucket, err := FindBucket(args[0])
+	if err != nil {
+		return err
+	}
+	form, err := bucket.PresignPost(policy, time.Now())
+	if err != nil {
+		return err
+	}
+	if presignPostFlags.output == postOutputHTML {
+		return writePostForm(form, bucket.Name)
+	}
+	b, err := json.MarshalIndent(form, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(b))
+	return nil
+}
+
+var postFormTemplate = template.Must(template.New("form").Parse(`<!DOCTYPE html>
+<html>
+<head>
+  <meta charset="utf-8">
+  <title>Upload to {{.Bucket}}</title>
+</head>
+<body>
+  <form action="{{.URL}}" method="post" enctype="multipart/form-data">
+{{- range .Hidden}}
+    <input type="hidden" name="{{.Name}}" value="{{.Value}}">
+{{- end}}
+{{- if .ContentType}}
+    <label>Content type <input type="text" name="Content-Type" value="{{.ContentType}}"></label><br>
+{{- end}}
+    <input type="file" name="file"><br>
+    <input type="submit" value="Upload">
+  </form>
+</body>
+</html>
+`))
+
+// writePostForm prints the form as HTML page, the content type is left to
+// be completed by the user.
+func writePostForm(form *s3.S3PostForm, bucketName string) error {
+	type field struct {
+		Name  string
+		Value string
+	}
+	data := struct {
+		Bucket      string
+		URL         string
+		Hidden      []field
+		ContentType string
+	}{Bucket: bucketName, URL: form.URL}
+	for name, value := range form.Fields {
+		if strings.EqualFold(name, "Content-Type") {
+			data.ContentType = value
+			continue
+		}
+		data.Hidden = append(data.Hidden, field{Name: name, Value: value})
+	}
+	sort.Slice(data.Hidden, func(i, j int) bool { return data.Hidden[i].Name < data.Hidden[j].Name })
+	return postFormTemplate.Execute(os.Stdout, data)
+}
@@ -0,0 +1,300 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	s3 "s3cli/s3"
+	"strings"
+	"sync"
+	"time"
+
+	cobra "github.com/spf13/cobra"
+)
+
+var (
+	proxyFlags = struct {
+		listen    string
+		readOnly  bool
+		prefix    string
+		accessLog string
+	}{
+		listen:    "127.0.0.1:8080",
+		readOnly:  false,
+		prefix:    "",
+		accessLog: "-",
+	}
+	proxyCmd = &cobra.Command{
+		Use:   "proxy [flags] <bucket-name>",
+		Short: "proxy unsigned requests to a bucket",
+		Long: `forwards plain HTTP requests to a bucket, signed with the credentials of the
+bucket, for clients which can not sign requests. Objects are addressed as
+http://127.0.0.1:8080/<key> by GET, HEAD, PUT and DELETE, objects are listed
+by GET http://127.0.0.1:8080/?list-type=2&prefix=<prefix>. Bodies are
+streamed through.
+
+Only requests of clients on the local host are accepted, which address the
+proxy as localhost, 127.0.0.1 or [::1] with the port listened on. Keys with .
+or .. segments are refused.`,
+		RunE:       proxy,
+		Args:       cobra.ExactArgs(1),
+		ArgAliases: []string{"bucket"},
+	}
+)
+
+func init() {
+	proxyCmd.PersistentFlags().StringVar(&proxyFlags.listen, "listen", proxyFlags.listen, "address to listen on")
+	proxyCmd.PersistentFlags().BoolVar(&proxyFlags.readOnly, "read-only", proxyFlags.readOnly, "forward only GET and HEAD requests")
+	proxyCmd.PersistentFlags().StringVar(&proxyFlags.prefix, "prefix", proxyFlags.prefix, "refuse requests for keys outside of this directory, i.e. keys not starting with <prefix>/")
+	proxyCmd.PersistentFlags().StringVar(&proxyFlags.accessLog, "access-log", proxyFlags.accessLog, "append requests to this file, - for stdout or empty to disable")
+	rootCmd.AddCommand(proxyCmd)
+}
+
+func proxy(cmd *cobra.Command, args []string) error {
+	bucket, err := FindBucket(args[0])
+	if err != nil {
+		return err
+	}
+	listener, err := net.Listen("tcp", proxyFlags.listen)
+	if err != nil {
+		return err
+	}
+	_, port, err := net.SplitHostPort(listener.Addr().String())
+	if err != nil {
+		listener.Close()
+		return err
+	}
+	p := &signingProxy{bucket: bucket, readOnly: proxyFlags.readOnly, prefix: proxyFlags.prefix, port: port}
+	switch proxyFlags.accessLog {
+	case "":
+	case "-":
+		p.accessLog = os.Stdout
+	default:
+		f, err := os.OpenFile(proxyFlags.accessLog, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			listener.Close()
+			return err
+		}
+		defer f.Close()
+		p.accessLog = f
+	}
+	fmt.Fprintf(os.Stderr, "proxying bucket %s at http://%s\n", bucket.Name, listener.Addr())
+	return serveUntilDone(cmd.Context(), &http.Server{Handler: p}, listener)
+}
+
+// headers of requests which are forwarded besides x-amz-meta-*, others
+// might extend the permissions of the client, i.e. x-amz-acl or
+// x-amz-copy-source
+var proxyRequestHeaders = []string{
+	"Accept-Encoding",
+	"Cache-Control",
+	"Content-Disposition",
+	"Content-Encoding",
+	"Content-Language",
+	"Content-MD5",
+	"Content-Type",
+	"Expires",
+	"If-Match",
+	"If-Modified-Since",
+	"If-None-Match",
+	"If-Unmodified-Since",
+	"Range",
+	"X-Amz-Storage-Class",
+	"X-Amz-Tagging",
+}
+
+// query parameters of listings which are forwarded
+var proxyListParameters = []string{
+	"continuation-token",
+	"delimiter",
+	"encoding-type",
+	"fetch-owner",
+	"list-type",
+	"max-keys",
+	"prefix",
+	"start-after",
+}
+
+// hop-by-hop headers of responses, which are not forwarded
+var hopByHopHeaders = map[string]bool{
+	"Connection":          true,
+	"Keep-Alive":          true,
+	"Proxy-Authenticate":  true,
+	"Proxy-Authorization": true,
+	"Te":                  true,
+	"Trailer":             true,
+	"Transfer-Encoding":   true,
+	"Upgrade":             true,
+}
+
+// signingProxy forwards requests of local clients to a bucket. Keys are
+// jailed to the directory prefix if set, port is the one listened on.
+type signingProxy struct {
+	bucket    s3.S3Bucket
+	readOnly  bool
+	prefix    string
+	port      string
+	accessLog io.Writer
+	logMutex  sync.Mutex
+}
+
+// proxyResponse records the status and the size of a response for the access log.
+type proxyResponse struct {
+	http.ResponseWriter
+	status int
+	size   int64
+}
+
+func (r *proxyResponse) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *proxyResponse) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	n, err := r.ResponseWriter.Write(b)
+	r.size += int64(n)
+	return n, err
+}
+
+func (p *signingProxy) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	start := time.Now()
+	resp := &proxyResponse{ResponseWriter: w}
+	p.forward(resp, req)
+	if p.accessLog != nil {
+		// in the common log format followed by the duration
+		p.logMutex.Lock()
+		defer p.logMutex.Unlock()
+		host, _, _ := net.SplitHostPort(req.RemoteAddr)
+		fmt.Fprintf(p.accessLog, "%s - - [%s] \"%s %s %s\" %d %d %.3f\n", host, start.Format("02/Jan/2006:15:04:05 -0700"), req.Method, req.URL.RequestURI(), req.Proto, resp.status, resp.size, time.Since(start).Seconds())
+	}
+}
+
+func (p *signingProxy) forward(w http.ResponseWriter, req *http.Request) {
+	if !isLoopback(req.RemoteAddr) {
+		http.Error(w, "only local clients are accepted", http.StatusForbidden)
+		return
+	}
+	// pages of other hosts resolved to the loopback address must not reach
+	// the bucket (DNS rebinding)
+	if !isLocalHost(req.Host, p.port) {
+		http.Error(w, "the proxy is only accepted as localhost:"+p.port, http.StatusForbidden)
+		return
+	}
+	switch req.Method {
+	case "GET", "HEAD":
+	case "PUT", "DELETE":
+		if p.readOnly {
+			http.Error(w, "the proxy is read-only", http.StatusForbidden)
+			return
+		}
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if hasDotSegment(req.URL.EscapedPath()) || hasDotSegment(req.URL.Path) {
+		http.Error(w, "keys with . or .. segments are refused", http.StatusBadRequest)
+		return
+	}
+	jail := p.prefix
+	if jail != "" && !strings.HasSuffix(jail, "/") {
+		jail += "/"
+	}
+	key := strings.TrimPrefix(req.URL.Path, "/")
+	query := url.Values{}
+	if key == "" {
+		if req.Method != "GET" {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		for _, name := range proxyListParameters {
+			if v, ok := req.URL.Query()[name]; ok {
+				query[name] = v
+			}
+		}
+		// listings are narrowed to the jail
+		if query.Get("prefix") == "" && jail != "" {
+			query.Set("prefix", jail)
+		}
+		if !strings.HasPrefix(query.Get("prefix"), jail) {
+			http.Error(w, "listing outside of prefix "+jail, http.StatusForbidden)
+			return
+		}
+	} else if !strings.HasPrefix(key, jail) {
+		http.Error(w, "key outside of prefix "+jail, http.StatusForbidden)
+		return
+	}
+
+	header := make(http.Header)
+	for _, k := range proxyRequestHeaders {
+		if v, ok := req.Header[k]; ok {
+			header[k] = v
+		}
+	}
+	for k, v := range req.Header {
+		if strings.HasPrefix(strings.ToLower(k), "x-amz-meta-") {
+			header[k] = v
+		}
+	}
+	// keeps the body from being decompressed on the way
+	if header.Get("Accept-Encoding") == "" {
+		header.Set("Accept-Encoding", "identity")
+	}
+
+	resp, err := p.bucket.Forward(req.Context(), req.Method, key, query, header, req.Body, req.ContentLength)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	defer resp.Body.Close()
+	for k, v := range resp.Header {
+		if !hopByHopHeaders[k] {
+			w.Header()[k] = v
+		}
+	}
+	w.WriteHeader(resp.StatusCode)
+	io.Copy(w, resp.Body)
+}
+
+// hasDotSegment tells whether a path has . or .. segments, which might be
+// resolved on the way to the bucket.
+func hasDotSegment(p string) bool {
+	for _, seg := range strings.Split(p, "/") {
+		if seg == "." || seg == ".." {
+			return true
+		}
+	}
+	return false
+}
+
+// isLocalHost tells whether the host of a request is the loopback address
+// of the proxy, a missing port is the default one of HTTP.
+func isLocalHost(hostport string, port string) bool {
+	host, p, err := net.SplitHostPort(hostport)
+	if err != nil {
+		host, p = strings.Trim(hostport, "[]"), "80"
+	}
+	if p != port {
+		return false
+	}
+	switch strings.ToLower(host) {
+	case "localhost", "127.0.0.1", "::1":
+		return true
+	}
+	return false
+}
+
+func isLoopback(remoteAddr string) bool {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		return false
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
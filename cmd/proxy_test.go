@@ -0,0 +1,210 @@
+package cmd
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	s3 "s3cli/s3"
+	"strings"
+	"testing"
+)
+
+// proxiedBucket serves a proxy of an emulated bucket on the loopback address.
+func proxiedBucket(t *testing.T, readOnly bool, prefix string) (s3.S3Bucket, *signingProxy, string) {
+	t.Helper()
+	bucket := emulatedBucket(t)
+	p := &signingProxy{bucket: bucket, readOnly: readOnly, prefix: prefix}
+	srv := httptest.NewServer(p)
+	t.Cleanup(srv.Close)
+	_, p.port, _ = net.SplitHostPort(srv.Listener.Addr().String())
+	return bucket, p, srv.URL
+}
+
+// proxyRequest sends a request to the proxy and returns the status and body
+// of the response.
+func proxyRequest(t *testing.T, method string, url string, body string) (int, string) {
+	t.Helper()
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode, string(b)
+}
+
+func objectContent(t *testing.T, store s3.ObjectStore, key string) string {
+	t.Helper()
+	obj, err := store.Get(context.Background(), key, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer obj.Body.Close()
+	b, err := ioutil.ReadAll(obj.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestProxyForwards(t *testing.T) {
+	bucket, _, url := proxiedBucket(t, false, "")
+	status, body := proxyRequest(t, "PUT", url+"/dir/a", "content")
+	if status != http.StatusOK {
+		t.Fatalf("put returned %d: %s", status, body)
+	}
+	status, body = proxyRequest(t, "GET", url+"/dir/a", "")
+	if status != http.StatusOK || body != "content" {
+		t.Errorf("get returned %d: %q, expected the content", status, body)
+	}
+	status, _ = proxyRequest(t, "HEAD", url+"/dir/a", "")
+	if status != http.StatusOK {
+		t.Errorf("head returned %d", status)
+	}
+	status, body = proxyRequest(t, "GET", url+"/?list-type=2&prefix=dir/", "")
+	if status != http.StatusOK || !strings.Contains(body, "<Key>dir/a</Key>") {
+		t.Errorf("listing returned %d: %s", status, body)
+	}
+	status, body = proxyRequest(t, "DELETE", url+"/dir/a", "")
+	if status != http.StatusNoContent {
+		t.Errorf("delete returned %d: %s", status, body)
+	}
+	status, _ = proxyRequest(t, "GET", url+"/dir/a", "")
+	if status != http.StatusNotFound {
+		t.Errorf("get of the deleted object returned %d", status)
+	}
+	if _, err := bucket.Head(context.Background(), "dir/a"); err == nil {
+		t.Error("object deleted by the proxy is kept")
+	}
+}
+
+func TestProxyRestrictsMethods(t *testing.T) {
+	bucket, _, url := proxiedBucket(t, true, "")
+	putObjects(t, bucket, "a")
+	tests := []struct {
+		method string
+		path   string
+		status int
+	}{
+		{"GET", "/a", http.StatusOK},
+		{"HEAD", "/a", http.StatusOK},
+		{"PUT", "/a", http.StatusForbidden},
+		{"DELETE", "/a", http.StatusForbidden},
+		{"POST", "/a", http.StatusMethodNotAllowed},
+		{"PATCH", "/a", http.StatusMethodNotAllowed},
+		{"OPTIONS", "/a", http.StatusMethodNotAllowed},
+		{"HEAD", "/", http.StatusMethodNotAllowed},
+		{"GET", "/?list-type=2", http.StatusOK},
+	}
+	for _, test := range tests {
+		status, body := proxyRequest(t, test.method, url+test.path, "b")
+		if status != test.status {
+			t.Errorf("%s %s returned %d: %s, expected %d", test.method, test.path, status, body, test.status)
+		}
+	}
+	if content := objectContent(t, bucket, "a"); content != "a" {
+		t.Errorf("read-only proxy changed the object to %q", content)
+	}
+
+	_, p, _ := proxiedBucket(t, false, "")
+	req := httptest.NewRequest("PUT", "http://127.0.0.1:"+p.port+"/", strings.NewReader("b"))
+	req.RemoteAddr = "127.0.0.1:40000"
+	rec := httptest.NewRecorder()
+	p.ServeHTTP(rec, req)
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("put to the bucket returned %d, expected %d", rec.Code, http.StatusMethodNotAllowed)
+	}
+}
+
+func TestProxyAcceptsOnlyLocalClients(t *testing.T) {
+	bucket, p, _ := proxiedBucket(t, false, "")
+	putObjects(t, bucket, "a")
+	tests := []struct {
+		remoteAddr string
+		host       string
+		status     int
+	}{
+		{"127.0.0.1:40000", "127.0.0.1:" + p.port, http.StatusOK},
+		{"127.0.0.1:40000", "localhost:" + p.port, http.StatusOK},
+		{"127.0.0.1:40000", "LocalHost:" + p.port, http.StatusOK},
+		{"[::1]:40000", "[::1]:" + p.port, http.StatusOK},
+		{"192.0.2.1:40000", "127.0.0.1:" + p.port, http.StatusForbidden},
+		{"[2001:db8::1]:40000", "[::1]:" + p.port, http.StatusForbidden},
+		{"invalid", "127.0.0.1:" + p.port, http.StatusForbidden},
+		// pages of other sites resolving their names to the loopback address
+		{"127.0.0.1:40000", "attacker.example:" + p.port, http.StatusForbidden},
+		{"127.0.0.1:40000", "attacker.example", http.StatusForbidden},
+		{"127.0.0.1:40000", "127.0.0.1:1", http.StatusForbidden},
+		{"127.0.0.1:40000", "127.0.0.1", http.StatusForbidden},
+		{"127.0.0.1:40000", "", http.StatusForbidden},
+	}
+	for _, test := range tests {
+		req := httptest.NewRequest("GET", "/a", nil)
+		req.RemoteAddr = test.remoteAddr
+		req.Host = test.host
+		rec := httptest.NewRecorder()
+		p.ServeHTTP(rec, req)
+		if rec.Code != test.status {
+			t.Errorf("request of %s for host %s returned %d, expected %d", test.remoteAddr, test.host, rec.Code, test.status)
+		}
+	}
+	if !isLocalHost("localhost", "80") || !isLocalHost("[::1]", "80") {
+		t.Error("hosts without port are not taken as port 80")
+	}
+}
+
+func TestProxyJailsKeys(t *testing.T) {
+	bucket, p, _ := proxiedBucket(t, false, "data")
+	putObjects(t, bucket, "data/a", "data-secret/a", "secret")
+	tests := []struct {
+		method string
+		target string
+		status int
+	}{
+		{"GET", "/data/a", http.StatusOK},
+		{"GET", "/data-secret/a", http.StatusForbidden},
+		{"GET", "/data", http.StatusForbidden},
+		{"GET", "/secret", http.StatusForbidden},
+		{"GET", "/data/../secret", http.StatusBadRequest},
+		{"GET", "/data/./a", http.StatusBadRequest},
+		{"GET", "/data/%2e%2e/secret", http.StatusBadRequest},
+		{"GET", "/data/%2E%2E%2Fsecret", http.StatusBadRequest},
+		{"GET", "/data%2F..%2Fsecret", http.StatusBadRequest},
+		{"GET", "/data/.%2e", http.StatusBadRequest},
+		{"PUT", "/data/../secret", http.StatusBadRequest},
+		{"DELETE", "/data/%2e%2e/secret", http.StatusBadRequest},
+		// a dot within a segment is part of the key
+		{"GET", "/data/..a", http.StatusNotFound},
+		{"GET", "/?list-type=2", http.StatusOK},
+		{"GET", "/?list-type=2&prefix=data/", http.StatusOK},
+		{"GET", "/?list-type=2&prefix=data", http.StatusForbidden},
+		{"GET", "/?list-type=2&prefix=data-", http.StatusForbidden},
+		{"GET", "/?list-type=2&prefix=se", http.StatusForbidden},
+	}
+	for _, test := range tests {
+		req := httptest.NewRequest(test.method, "http://127.0.0.1:"+p.port+test.target, strings.NewReader(""))
+		req.RemoteAddr = "127.0.0.1:40000"
+		rec := httptest.NewRecorder()
+		p.ServeHTTP(rec, req)
+		if rec.Code != test.status {
+			t.Errorf("%s %s returned %d: %s, expected %d", test.method, test.target, rec.Code, rec.Body, test.status)
+		}
+		if rec.Code == http.StatusOK && strings.Contains(rec.Body.String(), "secret") {
+			t.Errorf("%s %s revealed an object outside of the jail: %s", test.method, test.target, rec.Body)
+		}
+	}
+	for _, key := range []string{"data-secret/a", "secret"} {
+		if content := objectContent(t, bucket, key); content != key {
+			t.Errorf("object %s outside of the jail holds %q", key, content)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	s3base "s3cli/base"
+	s3 "s3cli/s3"
+
+	cobra "github.com/spf13/cobra"
+)
+
+var (
+	rbFlags = struct {
+		like      string
+		force     bool
+		fetchSize int
+	}{
+		like:      "",
+		force:     false,
+		fetchSize: 1000,
+	}
+	rbCmd = &cobra.Command{
+		Use:   "rb [flags] <bucket-name>",
+		Short: "remove a bucket",
+		Long: `removes an empty bucket, which is either configured or located at the service
+of the configured bucket named by the like flag. With the force flag, all
+objects of the bucket are deleted before, all of their versions and delete
+markers if the bucket is versioned.`,
+		RunE:       rb,
+		Args:       cobra.ExactArgs(1),
+		ArgAliases: []string{"bucket"},
+	}
+)
+
+func init() {
+	rbCmd.PersistentFlags().StringVar(&rbFlags.like, "like", rbFlags.like, "remove the bucket at the service of this configured bucket")
+	rbCmd.PersistentFlags().BoolVar(&rbFlags.force, "force", rbFlags.force, "delete all objects of the bucket before")
+	rbCmd.PersistentFlags().IntVarP(&rbFlags.fetchSize, "fetch-size", "n", rbFlags.fetchSize, "fetch objects in batches of this size")
+	rootCmd.AddCommand(rbCmd)
+}
+
+// emptyingItemVisitor deletes the objects or the versions of each page of
+// the listing.
+type emptyingItemVisitor struct {
+	ctx     context.Context
+	bucket  s3.S3Bucket
+	deleted int
+	failed  bool
+}
+
+func (eiv *emptyingItemVisitor) VisitListing(partialResult *s3.S3ListBucketResult) (bool, error) {
+	keys := make([]string, 0, len(partialResult.Contents))
+	for _, item := range partialResult.Contents {
+		keys = append(keys, item.Key)
+	}
+	if len(keys) == 0 {
+		return true, nil
+	}
+	return true, eiv.bucket.Delete(eiv.ctx, eiv, keys...)
+}
+
+func (eiv *emptyingItemVisitor) VisitVersions(partialResult *s3.S3ListVersionsResult) (bool, error) {
+	versions := partialResult.Entries()
+	if len(versions) == 0 {
+		return true, nil
+	}
+	return true, eiv.bucket.DeleteVersions(eiv.ctx, eiv, versions...)
+}
+
+func (eiv *emptyingItemVisitor) VisitDeletion(partialResult *s3.S3DeleteResult) error {
+	eiv.deleted += len(partialResult.Deleted)
+	for _, item := range partialResult.Error {
+		eiv.failed = true
+		if item.VersionId != "" {
+			fmt.Printf("version %s of '%s' not deleted: %s -> %s\n", item.VersionId, item.Key, item.Code, item.Message)
+		} else {
+			fmt.Printf("'%s' not deleted: %s -> %s\n", item.Key, item.Code, item.Message)
+		}
+	}
+	return nil
+}
+
+func rb(cmd *cobra.Command, args []string) error {
+	bucket, err := findBucketOrSibling(args[0], rbFlags.like)
+	if err != nil {
+		return err
+	}
+	if rbFlags.force {
+		// buckets are only empty once all versions of their objects are gone
+		status, err := bucket.GetVersioning(cmd.Context())
+		if err != nil {
+			return fmt.Errorf("error getting versioning of bucket %s: %w", bucket.Name, err)
+		}
+		visitor := &emptyingItemVisitor{ctx: cmd.Context(), bucket: bucket}
+		if status == "" {
+			err = bucket.List(cmd.Context(), "", rbFlags.fetchSize, visitor)
+			fmt.Printf("%d objects deleted\n", visitor.deleted)
+		} else {
+			err = bucket.ListVersions(cmd.Context(), "", rbFlags.fetchSize, visitor)
+			fmt.Printf("%d object versions and delete markers deleted\n", visitor.deleted)
+		}
+		if err != nil {
+			return s3base.WithExitCode(exitListing, fmt.Errorf("error emptying bucket %s: %w", bucket.Name, err))
+		}
+		if visitor.failed {
+			return fmt.Errorf("bucket %s not removed, at least one object was not deleted", bucket.Name)
+		}
+	}
+	err = bucket.Remove(cmd.Context())
+	if err != nil {
+		return fmt.Errorf("error removing bucket %s: %w", bucket.Name, err)
+	}
+	fmt.Printf("bucket %s removed\n", bucket.Name)
+	return nil
+}
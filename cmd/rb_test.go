@@ -0,0 +1,40 @@
+package cmd
+
+import (
+	"context"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	s3 "s3cli/s3"
+	"strings"
+	"testing"
+)
+
+func TestEmptyingVersionsOfBucket(t *testing.T) {
+	em := s3.NewEmulator(t.TempDir())
+	if err := os.Mkdir(filepath.Join(em.Root, "bkt"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(em)
+	defer srv.Close()
+	bucket := s3.S3Bucket{Name: "bkt", Endpoint: srv.URL + "/bkt", Region: "us-east-1"}
+	ctx := context.Background()
+	for _, key := range []string{"a", "b/c", "d"} {
+		err := bucket.Put(ctx, key, strings.NewReader(key), int64(len(key)), s3.S3PutOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	visitor := &emptyingItemVisitor{ctx: ctx, bucket: bucket}
+	err := bucket.ListVersions(ctx, "", 2, visitor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if visitor.deleted != 3 || visitor.failed {
+		t.Errorf("%d versions deleted (failed: %t), expected 3", visitor.deleted, visitor.failed)
+	}
+	if err := bucket.Remove(ctx); err != nil {
+		t.Errorf("removing the emptied bucket failed: %v", err)
+	}
+}
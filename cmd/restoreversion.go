@@ -0,0 +1,34 @@
+package cmd
+
+import (
+	"fmt"
+
+	cobra "github.com/spf13/cobra"
+)
+
+var restoreVersionCmd = &cobra.Command{
+	Use:   "restore-version [flags] <bucket-name> <key> <version-id>",
+	Short: "restore a version of an object",
+	Long: `copies a previous version of an object on top of it, which makes the copy the
+latest version. The versions of the object are kept, see ls --versions.`,
+	RunE:       restoreVersion,
+	Args:       cobra.ExactArgs(3),
+	ArgAliases: []string{"bucket", "key", "version-id"},
+}
+
+func init() {
+	rootCmd.AddCommand(restoreVersionCmd)
+}
+
+func restoreVersion(cmd *cobra.Command, args []string) error {
+	bucket, err := FindBucket(args[0])
+	if err != nil {
+		return err
+	}
+	err = bucket.RestoreVersion(cmd.Context(), args[1], args[2])
+	if err != nil {
+		return fmt.Errorf("error restoring version %s of %s: %w", args[2], args[1], err)
+	}
+	fmt.Printf("'%s' restored to version %s\n", args[1], args[2])
+	return nil
+}
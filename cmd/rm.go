@@ -2,7 +2,7 @@ package cmd
 
 import (
 	"fmt"
-	"log"
+	s3base "s3cli/base"
 	s3 "s3cli/s3"
 
 	cobra "github.com/spf13/cobra"
@@ -21,7 +21,7 @@ var (
 		Aliases:    []string{"remove", "delete"},
 		Short:      "remove objects",
 		Long:       `remove objects by path from S3.`,
-		Run:        rm,
+		RunE:       rm,
 		Args:       cobra.ExactArgs(2),
 		ArgAliases: []string{"bucket", "key-prefix"},
 	}
@@ -56,23 +56,33 @@ func (div *deletingItemVisitor) VisitListing(partialResult *s3.S3ListBucketResul
 	return true, nil
 }
 
-func rm(cmd *cobra.Command, args []string) {
-	bucket := FindBucket(args[0])
+func rm(cmd *cobra.Command, args []string) error {
+	store, err := FindStore(args[0])
+	if err != nil {
+		return err
+	}
 	key := args[1]
 
 	visitor := &deletingItemVisitor{
 		keys:   make([]string, 0),
 		failed: false,
 	}
-	bucket.List(key, rmFlags.fetchSize, visitor)
+	err = store.List(cmd.Context(), key, rmFlags.fetchSize, visitor)
+	if err != nil {
+		return s3base.WithExitCode(exitListing, fmt.Errorf("error listing %s: %w", key, err))
+	}
 	if len(visitor.keys) == 0 {
-		log.Fatalf("no objects found for key '%s'", key)
+		return fmt.Errorf("no objects found for key '%s'", key)
 	}
 	if len(visitor.keys) > 1 && !rmFlags.recursive {
-		log.Fatalf("%d objects found for key '%s'\nmaybe retry using -r switch", len(visitor.keys), key)
+		return fmt.Errorf("%d objects found for key '%s', maybe retry using -r switch", len(visitor.keys), key)
+	}
+	err = store.Delete(cmd.Context(), visitor, visitor.keys...)
+	if err != nil {
+		return err
 	}
-	bucket.Delete(visitor, visitor.keys...)
 	if visitor.failed {
-		log.Fatal("at least one object was not deleted!")
+		return fmt.Errorf("at least one object was not deleted!")
 	}
+	return nil
 }
@@ -1,8 +1,11 @@
 package cmd
 
 import (
+	"context"
+	"fmt"
 	"os"
 	"path/filepath"
+	s3base "s3cli/base"
 	s3 "s3cli/s3"
 	"strings"
 
@@ -12,32 +15,60 @@ import (
 )
 
 var (
-	logLevel   string = "ERROR"
-	configFile string
-	rootCmd    = &cobra.Command{
-		Use:   "s3",
-		Short: "S3",
-		Long:  `Various operations with S3 buckets.`,
+	logLevel             string = "ERROR"
+	configFile           string
+	limitRate            string
+	maxRequestsPerSecond float64
+	throttles            = make(map[string]*s3.Throttle)
+	globalThrottle       *s3.Throttle
+	rootCmd              = &cobra.Command{
+		Use:               "s3",
+		Short:             "S3",
+		Long:              `Various operations with S3 buckets.`,
+		PersistentPreRunE: initRootConfig,
+		SilenceUsage:      true,
+		SilenceErrors:     true,
 	}
 )
 
-// Execute executes the root command.
-func Execute() error {
-	return rootCmd.Execute()
+// RootCommand returns the root of the command tree, i.e. to embed the
+// commands into other tools.
+func RootCommand() *cobra.Command {
+	return rootCmd
+}
+
+// Execute executes the root command and returns the exit code, SIGINT and
+// SIGTERM cancel its context.
+func Execute() int {
+	ctx, stop := interruptibleContext(context.Background())
+	defer stop()
+	err := rootCmd.ExecuteContext(ctx)
+	if err == nil {
+		return 0
+	}
+	log.Error(err)
+	if ctx.Err() != nil {
+		return exitInterrupted
+	}
+	return s3base.ExitCode(err)
 }
 
 func init() {
-	cobra.OnInitialize(initRootConfig)
 	rootCmd.PersistentFlags().StringVarP(&configFile, "config", "C", configFile, "config file")
 	rootCmd.PersistentFlags().StringVarP(&logLevel, "log-level", "L", logLevel, "set log level, i.e. one of DEBUG, INFO, WARN, ERROR")
+	rootCmd.PersistentFlags().StringVar(&limitRate, "limit-rate", limitRate, "limit the bandwidth of all transfers to all buckets together, i.e. 20MiB/s (overrides the bucket setting limitRate)")
+	rootCmd.PersistentFlags().Float64Var(&maxRequestsPerSecond, "max-requests-per-second", maxRequestsPerSecond, "limit the rate of requests to all buckets together (overrides the bucket setting maxRequestsPerSecond)")
 }
 
-func initRootConfig() {
-	setupLogging()
-	readConfiguration()
+func initRootConfig(cmd *cobra.Command, args []string) error {
+	err := setupLogging()
+	if err != nil {
+		return err
+	}
+	return readConfiguration()
 }
 
-func setupLogging() {
+func setupLogging() error {
 	switch strings.ToUpper(logLevel) {
 	case "DEBUG":
 		log.SetLevel(log.DebugLevel)
@@ -48,12 +79,13 @@ func setupLogging() {
 	case "INFO":
 		log.SetLevel(log.InfoLevel)
 	default:
-		log.Fatal("unsupported log level specified: ", logLevel)
+		return fmt.Errorf("unsupported log level specified: %s", logLevel)
 	}
 	log.Debug("log level is set to ", logLevel)
+	return nil
 }
 
-func readConfiguration() {
+func readConfiguration() error {
 	viper.SetConfigName("buckets")
 	//viper.SetConfigType("yaml")
 
@@ -74,19 +106,117 @@ func readConfiguration() {
 
 	err := viper.ReadInConfig()
 	if err != nil {
-		log.Fatalf("error reading config file: %w", err)
+		return fmt.Errorf("error reading config file: %v", err)
 	}
 	log.Info("using config file at ", viper.ConfigFileUsed())
+	return nil
+}
+
+// types of stores selectable for buckets of the configuration
+const (
+	storeS3     = "s3"
+	storeFS     = "fs"
+	storeMemory = "memory"
+)
+
+// bucketConfig is a bucket of the configuration, its type selects the
+// store and path is the root directory of stores of type fs.
+type bucketConfig struct {
+	s3.S3Bucket `mapstructure:",squash"`
+	Type        string
+	Path        string
+}
+
+// memoryStores keep their objects for the lifetime of the process.
+var memoryStores = make(map[string]*s3.MemoryStore)
+
+func findBucketConfig(name string) (bucketConfig, error) {
+	var configs []bucketConfig
+	err := viper.UnmarshalKey("buckets", &configs)
+	if err != nil {
+		return bucketConfig{}, fmt.Errorf("error reading buckets of the configuration: %v", err)
+	}
+	for _, c := range configs {
+		if name == c.Name {
+			return c, nil
+		}
+	}
+	return bucketConfig{}, fmt.Errorf("bucket '%s' is unknown", name)
+}
+
+// FindBucket looks up a bucket of the configuration which is stored by S3.
+func FindBucket(name string) (s3.S3Bucket, error) {
+	c, err := findBucketConfig(name)
+	if err != nil {
+		return s3.S3Bucket{}, err
+	}
+	if c.Type != "" && c.Type != storeS3 {
+		return s3.S3Bucket{}, fmt.Errorf("bucket '%s' is of type %s, but S3 is required", name, c.Type)
+	}
+	b := c.S3Bucket
+	return b, setupThrottle(&b)
+}
+
+// FindStore looks up a bucket of the configuration and returns the store of
+// its type, S3 by default.
+func FindStore(name string) (s3.ObjectStore, error) {
+	c, err := findBucketConfig(name)
+	if err != nil {
+		return nil, err
+	}
+	switch c.Type {
+	case "", storeS3:
+		b := c.S3Bucket
+		return b, setupThrottle(&b)
+	case storeFS:
+		if c.Path == "" {
+			return nil, fmt.Errorf("bucket '%s' of type %s requires a path", name, c.Type)
+		}
+		store := s3.NewFileStore(c.Path)
+		store.Defaults = c.Defaults
+		return store, nil
+	case storeMemory:
+		store, ok := memoryStores[name]
+		if !ok {
+			store = s3.NewMemoryStore()
+			store.Defaults = c.Defaults
+			memoryStores[name] = store
+		}
+		return store, nil
+	}
+	return nil, fmt.Errorf("bucket '%s' is of unknown type %s - allowed values are: %s, %s or %s", name, c.Type, storeS3, storeFS, storeMemory)
 }
 
-func FindBucket(name string) s3.S3Bucket {
-	var s3Buckets []s3.S3Bucket
-	viper.UnmarshalKey("buckets", &s3Buckets)
-	for _, b := range s3Buckets {
-		if name == b.Name {
-			return b
+// setupThrottle applies the limits of the bucket configuration, the limits of
+// the command line override them and are shared by all buckets.
+func setupThrottle(b *s3.S3Bucket) error {
+	if globalThrottle == nil && (limitRate != "" || maxRequestsPerSecond > 0) {
+		bytesPerSecond, err := parseLimitRate(limitRate)
+		if err != nil {
+			return fmt.Errorf("invalid rate limit: %v", err)
 		}
+		log.Debugf("throttling all buckets to %d bytes and %g requests per second", bytesPerSecond, maxRequestsPerSecond)
+		globalThrottle = s3.NewThrottle(bytesPerSecond, maxRequestsPerSecond)
+	}
+	// repeated lookups share the limits
+	throttle, ok := throttles[b.Name]
+	if !ok && (b.LimitRate != "" || b.MaxRequestsPerSecond > 0) {
+		bytesPerSecond, err := parseLimitRate(b.LimitRate)
+		if err != nil {
+			return fmt.Errorf("invalid rate limit of bucket '%s': %v", b.Name, err)
+		}
+		log.Debugf("throttling bucket '%s' to %d bytes and %g requests per second", b.Name, bytesPerSecond, b.MaxRequestsPerSecond)
+		throttle = s3.NewThrottle(bytesPerSecond, b.MaxRequestsPerSecond)
+		throttles[b.Name] = throttle
+	}
+	b.Throttle = throttle.Override(globalThrottle)
+	return nil
+}
+
+// parseLimitRate parses a bandwidth limit, empty ones are unlimited.
+func parseLimitRate(rate string) (int64, error) {
+	if rate == "" {
+		return 0, nil
 	}
-	log.Fatalf("bucket '%s' is unknown", name)
-	return s3.S3Bucket{}
+	return s3base.ParseByteRate(rate)
 }
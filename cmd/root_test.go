@@ -0,0 +1,95 @@
+package cmd
+
+import (
+	"reflect"
+	s3 "s3cli/s3"
+	"strings"
+	"testing"
+
+	viper "github.com/spf13/viper"
+)
+
+func TestBucketConfigDefaults(t *testing.T) {
+	defer viper.Reset()
+	viper.SetConfigType("yaml")
+	err := viper.ReadConfig(strings.NewReader(`
+buckets:
+  - name: b
+    endpoint: http://localhost/b
+    defaults:
+      contenttype: text/plain
+      cachecontrol: max-age=3600
+      contentencoding: gzip
+      contentdisposition: attachment
+      storageclass: STANDARD_IA
+      acl: private
+      metadata:
+        owner: data-team
+      tags:
+        tier: hot
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := findBucketConfig("b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := s3.S3PutOptions{
+		ContentType:        "text/plain",
+		CacheControl:       "max-age=3600",
+		ContentEncoding:    "gzip",
+		ContentDisposition: "attachment",
+		StorageClass:       "STANDARD_IA",
+		Acl:                "private",
+		Metadata:           map[string]string{"owner": "data-team"},
+		Tags:               map[string]string{"tier": "hot"},
+	}
+	if !reflect.DeepEqual(c.Defaults, expected) {
+		t.Errorf("defaults are %+v, expected %+v", c.Defaults, expected)
+	}
+}
+
+func TestSetupThrottle(t *testing.T) {
+	savedRate, savedRequests, savedThrottles := limitRate, maxRequestsPerSecond, throttles
+	defer func() {
+		limitRate, maxRequestsPerSecond, throttles = savedRate, savedRequests, savedThrottles
+		globalThrottle = nil
+	}()
+	throttles = make(map[string]*s3.Throttle)
+	globalThrottle = nil
+
+	unlimited := s3.S3Bucket{Name: "unlimited"}
+	if err := setupThrottle(&unlimited); err != nil || unlimited.Throttle != nil {
+		t.Errorf("bucket without limits is throttled by %v (%v)", unlimited.Throttle, err)
+	}
+	limited := s3.S3Bucket{Name: "limited", LimitRate: "1MiB/s"}
+	if err := setupThrottle(&limited); err != nil || limited.Throttle == nil {
+		t.Fatalf("bucket with limits is not throttled (%v)", err)
+	}
+	again := s3.S3Bucket{Name: "limited", LimitRate: "1MiB/s"}
+	if err := setupThrottle(&again); err != nil || again.Throttle != limited.Throttle {
+		t.Error("repeated lookups of a bucket do not share its throttle")
+	}
+	invalid := s3.S3Bucket{Name: "invalid", LimitRate: "fast"}
+	if err := setupThrottle(&invalid); err == nil {
+		t.Error("invalid rate limit of a bucket was accepted")
+	}
+
+	// the limits of the command line are shared by all buckets
+	limitRate = "10MiB/s"
+	if err := setupThrottle(&unlimited); err != nil || unlimited.Throttle != globalThrottle || globalThrottle == nil {
+		t.Fatalf("bucket without limits is not throttled by the command line (%v)", err)
+	}
+	global := globalThrottle
+	other := s3.S3Bucket{Name: "other"}
+	if err := setupThrottle(&other); err != nil || other.Throttle != global {
+		t.Error("buckets do not share the throttle of the command line")
+	}
+	if err := setupThrottle(&limited); err != nil || limited.Throttle == global || limited.Throttle == nil || throttles["limited"] == nil {
+		t.Error("limits of the bucket are not kept besides the ones of the command line")
+	}
+	if limited.LimitRate != "1MiB/s" {
+		t.Errorf("rate limit of the bucket is changed to %s", limited.LimitRate)
+	}
+}
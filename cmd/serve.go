@@ -0,0 +1,116 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	s3base "s3cli/base"
+	s3 "s3cli/s3"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	cobra "github.com/spf13/cobra"
+)
+
+var (
+	serveFlags = struct {
+		emulate     bool
+		listen      string
+		accessKeyId string
+		secretKey   string
+		region      string
+	}{
+		emulate:     false,
+		listen:      "127.0.0.1:9000",
+		accessKeyId: "",
+		secretKey:   "",
+		region:      "",
+	}
+	serveCmd = &cobra.Command{
+		Use:   "serve [flags] --emulate <directory>",
+		Short: "serve a directory like S3",
+		Long: `serves the subdirectories of a directory as buckets by a subset of the S3 API
+(ListBuckets, Create/DeleteBucket, ListObjectsV2, Get/Put/Head/Delete/CopyObject,
+DeleteObjects, Get/Put/DeleteObjectTagging, Get/Put/DeleteBucketLifecycle,
+Get/Put/DeleteBucketPolicy, Get/Put/DeletePublicAccessBlock, Get/PutBucketAcl,
+Get/PutObjectAcl, multipart and POST uploads) with path-style addressing, i.e.
+a bucket is configured with the endpoint http://127.0.0.1:9000/<subdirectory>.
+The buckets are not versioned, ListObjectVersions lists each object as its
+only version. Lifecycle configurations, policies and public access blocks are
+stored but never applied, buckets and objects are always private.
+
+Requests have to be signed with the given credentials, without an access key
+id anonymous requests are accepted as well.`,
+		RunE:       serve,
+		Args:       cobra.ExactArgs(1),
+		ArgAliases: []string{"directory"},
+		// no buckets need to be configured
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			return setupLogging()
+		},
+	}
+)
+
+func init() {
+	serveCmd.PersistentFlags().BoolVar(&serveFlags.emulate, "emulate", serveFlags.emulate, "emulate S3 with the subdirectories of the directory as buckets")
+	serveCmd.PersistentFlags().StringVar(&serveFlags.listen, "listen", serveFlags.listen, "address to listen on")
+	serveCmd.PersistentFlags().StringVar(&serveFlags.accessKeyId, "access-key-id", serveFlags.accessKeyId, "access key id of signed requests (defaults to $AWS_ACCESS_KEY_ID)")
+	serveCmd.PersistentFlags().StringVar(&serveFlags.secretKey, "secret-key", serveFlags.secretKey, "secret key of signed requests (defaults to $AWS_SECRET_ACCESS_KEY)")
+	serveCmd.PersistentFlags().StringVar(&serveFlags.region, "region", serveFlags.region, "region of signed requests (any region is accepted by default)")
+	rootCmd.AddCommand(serveCmd)
+}
+
+func serve(cmd *cobra.Command, args []string) error {
+	if !serveFlags.emulate {
+		return fmt.Errorf("only serving as emulator is supported (use emulate flag)")
+	}
+	fi, err := os.Stat(args[0])
+	if err != nil {
+		return s3base.WithExitCode(exitLocal, err)
+	}
+	if !fi.IsDir() {
+		return s3base.WithExitCode(exitLocal, fmt.Errorf("%s is no directory", args[0]))
+	}
+	em := s3.NewEmulator(args[0])
+	em.AccessKeyId = firstNonEmpty(serveFlags.accessKeyId, os.Getenv("AWS_ACCESS_KEY_ID"))
+	em.SecretKey = firstNonEmpty(serveFlags.secretKey, os.Getenv("AWS_SECRET_ACCESS_KEY"))
+	em.Region = serveFlags.region
+	if em.AccessKeyId == "" {
+		log.Warn("no access key id specified, accepting anonymous requests")
+	}
+
+	listener, err := net.Listen("tcp", serveFlags.listen)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("emulating S3 with the buckets in %s at http://%s\n", args[0], listener.Addr())
+	return serveUntilDone(cmd.Context(), &http.Server{Handler: em}, listener)
+}
+
+// serveUntilDone serves until the context is done and waits a little for
+// requests in progress then.
+func serveUntilDone(ctx context.Context, server *http.Server, listener net.Listener) error {
+	done := make(chan error, 1)
+	go func() {
+		done <- server.Serve(listener)
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+	}
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	return server.Shutdown(shutdownCtx)
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,53 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	s3base "s3cli/base"
+	"syscall"
+)
+
+// exit codes of failed commands, others exit with 1
+const (
+	exitLocal       = 2
+	exitDownload    = 3
+	exitListing     = 4
+	exitUpload      = 6
+	exitJournal     = 7
+	exitInterrupted = 130 // as shells report it for SIGINT
+)
+
+// interruptibleContext returns a context which is cancelled by SIGINT or
+// SIGTERM, so commands stop starting new work and clean up. A second signal
+// exits immediately.
+func interruptibleContext(parent context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(parent)
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		select {
+		case <-signals:
+		case <-ctx.Done():
+			return
+		}
+		fmt.Fprintln(os.Stderr, "interrupted, cleaning up (interrupt again to exit immediately)")
+		cancel()
+		<-signals
+		os.Exit(exitInterrupted)
+	}()
+	return ctx, func() {
+		signal.Stop(signals)
+		cancel()
+	}
+}
+
+// interrupted returns an error if the command has been interrupted, which
+// might have kept work from being started.
+func interrupted(ctx context.Context) error {
+	if ctx.Err() != nil {
+		return s3base.WithExitCode(exitInterrupted, fmt.Errorf("interrupted"))
+	}
+	return nil
+}
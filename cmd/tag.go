@@ -0,0 +1,255 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	s3base "s3cli/base"
+	s3 "s3cli/s3"
+	"sort"
+	"strings"
+
+	cobra "github.com/spf13/cobra"
+)
+
+var (
+	tagFlags = struct {
+		recursive bool
+		fetchSize int
+		parallel  int
+	}{
+		recursive: false,
+		fetchSize: 1000,
+		parallel:  8,
+	}
+	tagCmd = &cobra.Command{
+		Use:   "tag",
+		Short: "manage the tags of objects",
+		Long: `prints or changes the tags of an object or, with the recursive flag, of all
+objects below a prefix. Objects have up to 10 tags.`,
+	}
+	tagGetCmd = &cobra.Command{
+		Use:        "get [flags] <bucket-name> <key>|<key-prefix>",
+		Short:      "print tags",
+		Long:       `prints the tags of an object as key=value, recursively each key is followed by the tags of its object.`,
+		RunE:       tagGet,
+		Args:       cobra.ExactArgs(2),
+		ArgAliases: []string{"bucket", "key-prefix"},
+	}
+	tagSetCmd = &cobra.Command{
+		Use:        "set [flags] <bucket-name> <key>|<key-prefix> <tag>=<value>...",
+		Short:      "replace tags",
+		Long:       `replaces all tags of objects by the given ones.`,
+		RunE:       tagModify(setTags, true),
+		Args:       cobra.MinimumNArgs(3),
+		ArgAliases: []string{"bucket", "key-prefix", "tags"},
+	}
+	tagAddCmd = &cobra.Command{
+		Use:        "add [flags] <bucket-name> <key>|<key-prefix> <tag>=<value>...",
+		Short:      "add tags",
+		Long:       `adds tags to objects, the values of existing tags of the same keys are replaced.`,
+		RunE:       tagModify(addTags, true),
+		Args:       cobra.MinimumNArgs(3),
+		ArgAliases: []string{"bucket", "key-prefix", "tags"},
+	}
+	tagRemoveCmd = &cobra.Command{
+		Use:        "remove [flags] <bucket-name> <key>|<key-prefix> [tag]...",
+		Short:      "remove tags",
+		Long:       `removes the tags of the given keys from objects, all tags are removed if no key is given.`,
+		RunE:       tagModify(removeTags, false),
+		Args:       cobra.MinimumNArgs(2),
+		ArgAliases: []string{"bucket", "key-prefix", "tags"},
+	}
+)
+
+func init() {
+	tagCmd.PersistentFlags().BoolVarP(&tagFlags.recursive, "recursive", "r", tagFlags.recursive, "apply to all objects below the prefix")
+	tagCmd.PersistentFlags().IntVarP(&tagFlags.fetchSize, "fetch-size", "n", tagFlags.fetchSize, "fetch objects in batches of this size")
+	tagCmd.PersistentFlags().IntVarP(&tagFlags.parallel, "parallel", "P", tagFlags.parallel, "process the tags of this many objects concurrently")
+	tagCmd.AddCommand(tagGetCmd, tagSetCmd, tagAddCmd, tagRemoveCmd)
+	rootCmd.AddCommand(tagCmd)
+}
+
+// parseTags parses tags given as key=value and checks them against the
+// limits of S3, no tags result in nil.
+func parseTags(pairs []string) (map[string]string, error) {
+	if len(pairs) == 0 {
+		return nil, nil
+	}
+	tags, err := s3base.ParseKeyValues(pairs)
+	if err != nil {
+		return nil, err
+	}
+	return tags, s3.ValidateTags(tags)
+}
+
+// formatTags formats tags as key=value ordered by their keys.
+func formatTags(tags map[string]string) []string {
+	rlt := make([]string, 0, len(tags))
+	for k, v := range tags {
+		rlt = append(rlt, k+"="+v)
+	}
+	sort.Strings(rlt)
+	return rlt
+}
+
+// concurrently calls fn for each key on up to parallel goroutines, the
+// errors are returned in the order of the keys.
+func concurrently(keys []string, parallel int, fn func(i int, key string) error) []error {
+	errs := make([]error, len(keys))
+	pool := s3base.NewWorkerPool(parallel)
+	for i, key := range keys {
+		i, key := i, key
+		pool.Go(func() { errs[i] = fn(i, key) })
+	}
+	pool.Wait()
+	return errs
+}
+
+// fetchTags gets the tags of the objects concurrently.
+func fetchTags(ctx context.Context, bucket s3.S3Bucket, keys []string, parallel int) ([]map[string]string, error) {
+	tags := make([]map[string]string, len(keys))
+	errs := concurrently(keys, parallel, func(i int, key string) error {
+		var err error
+		tags[i], err = bucket.GetTags(ctx, key)
+		return err
+	})
+	for i, err := range errs {
+		if err != nil {
+			return nil, fmt.Errorf("error getting tags of %s: %w", keys[i], err)
+		}
+	}
+	return tags, nil
+}
+
+// taggingItemVisitor handles the tags of the objects of each page of a
+// listing, a page is done before the next one is fetched.
+type taggingItemVisitor struct {
+	visit func(keys []string) error
+}
+
+func (tiv taggingItemVisitor) VisitListing(partialResult *s3.S3ListBucketResult) (bool, error) {
+	keys := make([]string, 0, len(partialResult.Contents))
+	for _, item := range partialResult.Contents {
+		keys = append(keys, item.Key)
+	}
+	return true, tiv.visit(keys)
+}
+
+// visitTagged passes the key or, recursively, the keys of each page of the
+// listing below the key to visit.
+func visitTagged(ctx context.Context, bucket s3.S3Bucket, key string, visit func(keys []string) error) error {
+	if !tagFlags.recursive {
+		return visit([]string{key})
+	}
+	err := bucket.List(ctx, key, tagFlags.fetchSize, taggingItemVisitor{visit: visit})
+	if err != nil {
+		return s3base.WithExitCode(exitListing, fmt.Errorf("error listing %s: %w", key, err))
+	}
+	return nil
+}
+
+func tagGet(cmd *cobra.Command, args []string) error {
+	bucket, err := FindBucket(args[0])
+	if err != nil {
+		return err
+	}
+	return visitTagged(cmd.Context(), bucket, args[1], func(keys []string) error {
+		tags, err := fetchTags(cmd.Context(), bucket, keys, tagFlags.parallel)
+		if err != nil {
+			return err
+		}
+		for i, key := range keys {
+			if !tagFlags.recursive {
+				for _, tag := range formatTags(tags[i]) {
+					fmt.Println(tag)
+				}
+				continue
+			}
+			fmt.Println(strings.Join(append([]string{key}, formatTags(tags[i])...), "\t"))
+		}
+		return nil
+	})
+}
+
+// tagModifier changes the tags of an object, the arguments are the ones
+// following the key of the command line.
+type tagModifier func(ctx context.Context, bucket s3.S3Bucket, key string, args []string) error
+
+func setTags(ctx context.Context, bucket s3.S3Bucket, key string, args []string) error {
+	tags, err := parseTags(args)
+	if err != nil {
+		return err
+	}
+	return bucket.PutTags(ctx, key, tags)
+}
+
+func addTags(ctx context.Context, bucket s3.S3Bucket, key string, args []string) error {
+	added, err := parseTags(args)
+	if err != nil {
+		return err
+	}
+	tags, err := bucket.GetTags(ctx, key)
+	if err != nil {
+		return err
+	}
+	for k, v := range added {
+		tags[k] = v
+	}
+	return bucket.PutTags(ctx, key, tags)
+}
+
+func removeTags(ctx context.Context, bucket s3.S3Bucket, key string, args []string) error {
+	if len(args) == 0 {
+		return bucket.DeleteTags(ctx, key)
+	}
+	tags, err := bucket.GetTags(ctx, key)
+	if err != nil {
+		return err
+	}
+	for _, k := range args {
+		delete(tags, k)
+	}
+	if len(tags) == 0 {
+		return bucket.DeleteTags(ctx, key)
+	}
+	return bucket.PutTags(ctx, key, tags)
+}
+
+// tagModify applies the modifier to the objects, its arguments are tags if
+// withTags is set, which are checked once before.
+func tagModify(modify tagModifier, withTags bool) func(cmd *cobra.Command, args []string) error {
+	return func(cmd *cobra.Command, args []string) error {
+		ctx := cmd.Context()
+		if withTags {
+			if _, err := parseTags(args[2:]); err != nil {
+				return err
+			}
+		}
+		bucket, err := FindBucket(args[0])
+		if err != nil {
+			return err
+		}
+		failed := false
+		err = visitTagged(ctx, bucket, args[1], func(keys []string) error {
+			errs := concurrently(keys, tagFlags.parallel, func(i int, key string) error {
+				return modify(ctx, bucket, key, args[2:])
+			})
+			for i, err := range errs {
+				if err != nil {
+					failed = true
+					fmt.Printf("'%s' not tagged: %v\n", keys[i], err)
+					continue
+				}
+				fmt.Printf("'%s' tagged\n", keys[i])
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		if failed {
+			return fmt.Errorf("the tags of at least one object were not changed!")
+		}
+		return nil
+	}
+}
@@ -0,0 +1,82 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	s3base "s3cli/base"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// transfers runs the transfers of a command concurrently, retries failed
+// ones and reports the progress.
+type transfers struct {
+	ctx      context.Context
+	pool     *s3base.WorkerPool
+	progress *s3base.Progress
+	retries  int
+}
+
+func newTransfers(ctx context.Context, parallel int, retries int, showProgress bool) *transfers {
+	return &transfers{
+		ctx:      ctx,
+		pool:     s3base.NewWorkerPool(parallel),
+		progress: s3base.NewProgress(showProgress),
+		retries:  retries,
+	}
+}
+
+// submit runs a task on the pool, failures are logged and counted. Tasks
+// are dropped once the context is done.
+func (ts *transfers) submit(task func() error) {
+	ts.pool.Go(func() {
+		if ts.ctx.Err() != nil {
+			return
+		}
+		if err := task(); err != nil {
+			log.Error(err)
+			ts.progress.Fail()
+		}
+	})
+}
+
+// transfer runs a transfer of size bytes (negative if unknown) and repeats
+// it with growing delays as long as retries are left.
+func (ts *transfers) transfer(name string, size int64, run func(t *s3base.Transfer) error) error {
+	t := ts.progress.Start(name, size)
+	delay := time.Second
+	var err error
+	for attempt := 0; ; attempt++ {
+		err = run(t)
+		if err == nil || attempt >= ts.retries || ts.ctx.Err() != nil {
+			break
+		}
+		log.Warnf("retrying %s in %s: %v", name, delay, err)
+		ts.progress.Retry()
+		select {
+		case <-time.After(delay):
+		case <-ts.ctx.Done():
+		}
+		delay *= 2
+		t.Reset()
+	}
+	t.Done(err)
+	if err != nil {
+		return fmt.Errorf("error transferring %s: %v", name, err)
+	}
+	return nil
+}
+
+// wait blocks until all transfers submitted so far are done.
+func (ts *transfers) wait() {
+	ts.pool.Wait()
+}
+
+// finish waits for all transfers and prints the summary, the number of
+// failed transfers is returned.
+func (ts *transfers) finish() int {
+	ts.pool.Wait()
+	ts.progress.Stop()
+	return ts.progress.Failures()
+}
@@ -0,0 +1,81 @@
+package cmd
+
+import (
+	"fmt"
+	s3base "s3cli/base"
+	s3 "s3cli/s3"
+
+	cobra "github.com/spf13/cobra"
+)
+
+var (
+	undeleteFlags = struct {
+		recursive bool
+		fetchSize int
+	}{
+		recursive: false,
+		fetchSize: 1000,
+	}
+	undeleteCmd = &cobra.Command{
+		Use:   "undelete [flags] <bucket-name> <key>|<key-prefix>",
+		Short: "restore deleted objects",
+		Long: `restores objects of a versioned bucket which have been deleted by removing
+their delete markers, the latest version before the deletion becomes the
+latest version again.`,
+		RunE:       undelete,
+		Args:       cobra.ExactArgs(2),
+		ArgAliases: []string{"bucket", "key-prefix"},
+	}
+)
+
+func init() {
+	undeleteCmd.PersistentFlags().BoolVarP(&undeleteFlags.recursive, "recursive", "r", undeleteFlags.recursive, "restore all deleted objects below the prefix")
+	undeleteCmd.PersistentFlags().IntVarP(&undeleteFlags.fetchSize, "fetch-size", "n", undeleteFlags.fetchSize, "fetch versions in batches of this size")
+	rootCmd.AddCommand(undeleteCmd)
+}
+
+// deleteMarkerVisitor collects the delete markers which are the latest
+// versions of their objects.
+type deleteMarkerVisitor struct {
+	key     string
+	markers []s3.S3ObjectVersion
+}
+
+func (dmv *deleteMarkerVisitor) VisitVersions(partialResult *s3.S3ListVersionsResult) (bool, error) {
+	for _, marker := range partialResult.DeleteMarkers {
+		if marker.IsLatest && (undeleteFlags.recursive || marker.Key == dmv.key) {
+			dmv.markers = append(dmv.markers, marker)
+		}
+	}
+	return true, nil
+}
+
+func undelete(cmd *cobra.Command, args []string) error {
+	bucket, err := FindBucket(args[0])
+	if err != nil {
+		return err
+	}
+	key := args[1]
+	visitor := &deleteMarkerVisitor{key: key}
+	err = bucket.ListVersions(cmd.Context(), key, undeleteFlags.fetchSize, visitor)
+	if err != nil {
+		return s3base.WithExitCode(exitListing, fmt.Errorf("error listing versions of %s: %w", key, err))
+	}
+	if len(visitor.markers) == 0 {
+		return fmt.Errorf("no deleted objects found for key '%s'", key)
+	}
+	failed := false
+	for _, marker := range visitor.markers {
+		err = bucket.DeleteVersion(cmd.Context(), marker.Key, marker.VersionId)
+		if err != nil {
+			failed = true
+			fmt.Printf("'%s' not restored: %v\n", marker.Key, err)
+			continue
+		}
+		fmt.Printf("'%s' restored\n", marker.Key)
+	}
+	if failed {
+		return fmt.Errorf("at least one object was not restored!")
+	}
+	return nil
+}
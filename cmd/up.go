@@ -1,11 +1,18 @@
 package cmd
 
 import (
-	"log"
+	"context"
+	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	s3base "s3cli/base"
+	s3 "s3cli/s3"
+	"sort"
 	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
 
 	cobra "github.com/spf13/cobra"
 )
@@ -15,17 +22,78 @@ var (
 		keyToPathDelimiter string
 		recursive          bool
 		keyMode            string
+		keyTemplate        string
+		partSize           string
+		contentType        string
+		cacheControl       string
+		contentEncoding    string
+		contentDisposition string
+		storageClass       string
+		acl                string
+		meta               []string
+		tags               []string
+		preserve           bool
+		excludes           []string
+		includes           []string
+		dryRun             bool
+		followSymlinks     bool
+		storeSymlinks      bool
+		skipHidden         bool
+		skipExisting       string
+		fetchSize          int
+		journal            string
+		resume             string
+		parallel           int
+		retries            int
+		noProgress         bool
 	}{
 		keyToPathDelimiter: "/",
 		recursive:          false,
-		keyMode:            "B",
+		keyMode:            "",
+		keyTemplate:        "",
+		partSize:           "",
+		meta:               []string{},
+		tags:               []string{},
+		preserve:           false,
+		excludes:           []string{},
+		includes:           []string{},
+		dryRun:             false,
+		followSymlinks:     false,
+		storeSymlinks:      false,
+		skipHidden:         false,
+		skipExisting:       "",
+		fetchSize:          1000,
+		journal:            "",
+		resume:             "",
+		parallel:           3,
+		retries:            2,
+		noProgress:         false,
 	}
 	uploadCmd = &cobra.Command{
-		Use:        "up [flags] <bucket-name> <local-path> [key-prefix]",
-		Aliases:    []string{"upload", "put"},
-		Short:      "uploads objects",
-		Long:       `uploads objects to S3.`,
-		Run:        up,
+		Use:     "up [flags] <bucket-name> <local-path>|- [key-prefix]",
+		Aliases: []string{"upload", "put"},
+		Short:   "uploads objects",
+		Long: `uploads objects to S3, use - as local path to upload from stdin.
+
+The headers, metadata and tags of the objects default to the settings of the
+bucket in the configuration file, the flags take precedence:
+
+buckets:
+  - name: my-bucket
+    defaults:
+      contenttype: text/plain
+      cachecontrol: max-age=3600
+      contentencoding: gzip
+      contentdisposition: attachment
+      storageclass: STANDARD_IA
+      acl: private
+      metadata:
+        owner: data-team
+      tags:
+        tier: hot
+
+The keys of metadata and tags of the configuration are read in lower case.`,
+		RunE:       up,
 		Args:       cobra.MinimumNArgs(2),
 		ArgAliases: []string{"bucket", "local-path", "key-prefix"},
 	}
@@ -35,67 +103,327 @@ func init() {
 	uploadCmd.PersistentFlags().StringVarP(&uploadFlags.keyToPathDelimiter, "delimiter", "d", uploadFlags.keyToPathDelimiter, "delimiter used to convert object keys to filesystem paths")
 	uploadCmd.PersistentFlags().BoolVarP(&uploadFlags.recursive, "recursive", "r", uploadFlags.recursive, "uploads directories and their contents recursively")
 	uploadCmd.PersistentFlags().StringVarP(&uploadFlags.keyMode, "use-keymode", "k", uploadFlags.keyMode, "mode to translate filenames if object key is not specified explicitly - allowed values are: B (basename), A (absolute) or R (relative)")
+	uploadCmd.PersistentFlags().MarkDeprecated("use-keymode", "use --key-template {basename}, {abspath} or {relpath} instead")
+	uploadCmd.PersistentFlags().StringVarP(&uploadFlags.keyTemplate, "key-template", "t", uploadFlags.keyTemplate, "template of the object keys appended to the key prefix (default "+defaultKeyTemplate+", use {relpath} to keep the directory structure of recursive uploads) - variables are:"+keyVariableUsage())
+	uploadCmd.PersistentFlags().StringVar(&uploadFlags.partSize, "part-size", uploadFlags.partSize, "size of the parts of multipart uploads, i.e. 16MiB (defaults to the bucket setting or 8MiB)")
+	uploadCmd.PersistentFlags().StringVar(&uploadFlags.contentType, "content-type", uploadFlags.contentType, "content type of the objects (detected from file extension or content if omitted)")
+	uploadCmd.PersistentFlags().StringVar(&uploadFlags.cacheControl, "cache-control", uploadFlags.cacheControl, "Cache-Control header of the objects")
+	uploadCmd.PersistentFlags().StringVar(&uploadFlags.contentEncoding, "content-encoding", uploadFlags.contentEncoding, "Content-Encoding header of the objects, i.e. gzip")
+	uploadCmd.PersistentFlags().StringVar(&uploadFlags.contentDisposition, "content-disposition", uploadFlags.contentDisposition, "Content-Disposition header of the objects")
+	uploadCmd.PersistentFlags().StringVar(&uploadFlags.storageClass, "storage-class", uploadFlags.storageClass, "storage class of the objects, i.e. STANDARD, STANDARD_IA or GLACIER")
+	uploadCmd.PersistentFlags().StringVar(&uploadFlags.acl, "acl", uploadFlags.acl, "canned ACL of the objects, i.e. private or public-read")
+	uploadCmd.PersistentFlags().StringArrayVar(&uploadFlags.meta, "meta", uploadFlags.meta, "user metadata of the objects as key=value (repeatable)")
+	uploadCmd.PersistentFlags().StringArrayVar(&uploadFlags.tags, "tag", uploadFlags.tags, "tag of the objects as key=value (repeatable)")
+	uploadCmd.PersistentFlags().BoolVarP(&uploadFlags.preserve, "preserve", "p", uploadFlags.preserve, "store modification time, mode and ownership of files as object metadata")
+	uploadCmd.PersistentFlags().StringArrayVar(&uploadFlags.excludes, "exclude", uploadFlags.excludes, "skip files and directories matching this pattern in gitignore syntax (repeatable), "+ignoreFileName+" files are respected as well")
+	uploadCmd.PersistentFlags().StringArrayVar(&uploadFlags.includes, "include", uploadFlags.includes, "upload only files matching this pattern in gitignore syntax (repeatable)")
+	uploadCmd.PersistentFlags().BoolVar(&uploadFlags.dryRun, "dry-run", uploadFlags.dryRun, "show which files would be uploaded under which keys")
+	uploadCmd.PersistentFlags().BoolVar(&uploadFlags.followSymlinks, "follow-symlinks", uploadFlags.followSymlinks, "upload the files and directories symlinks point to (symlinks are skipped otherwise)")
+	uploadCmd.PersistentFlags().BoolVar(&uploadFlags.storeSymlinks, "store-symlinks", uploadFlags.storeSymlinks, "upload symlinks as small objects holding the link target, restored by down --preserve")
+	uploadCmd.PersistentFlags().BoolVar(&uploadFlags.skipHidden, "skip-hidden", uploadFlags.skipHidden, "skip files and directories whose names start with a dot")
+	uploadCmd.PersistentFlags().StringVar(&uploadFlags.skipExisting, "skip-existing", uploadFlags.skipExisting, "skip files whose object exists and matches by this criterion - allowed values are: size, etag (same content) or mtime (object is not older than the file)")
+	uploadCmd.PersistentFlags().IntVarP(&uploadFlags.fetchSize, "fetch-size", "n", uploadFlags.fetchSize, "fetch objects in batches of this size when looking for existing objects")
+	uploadCmd.PersistentFlags().StringVar(&uploadFlags.journal, "journal", uploadFlags.journal, "record the progress in this journal (defaults to a new file in ~/.s3/jobs, removed on success)")
+	uploadCmd.PersistentFlags().StringVar(&uploadFlags.resume, "resume", uploadFlags.resume, "resume the interrupted upload recorded in this journal")
+	uploadCmd.PersistentFlags().IntVarP(&uploadFlags.parallel, "parallel", "P", uploadFlags.parallel, "upload files concurrently")
+	uploadCmd.PersistentFlags().IntVar(&uploadFlags.retries, "retries", uploadFlags.retries, "retry failed uploads of files this often")
+	uploadCmd.PersistentFlags().BoolVar(&uploadFlags.noProgress, "no-progress", uploadFlags.noProgress, "show only a summary instead of the progress")
 	rootCmd.AddCommand(uploadCmd)
 }
 
-func up(cmd *cobra.Command, args []string) {
-	bucket := FindBucket(args[0])
+func up(cmd *cobra.Command, args []string) (err error) {
+	ctx := cmd.Context()
+	store, err := FindStore(args[0])
+	if err != nil {
+		return err
+	}
+	if uploadFlags.partSize != "" {
+		partSize, err := s3base.ParseByteSize(uploadFlags.partSize)
+		if err != nil {
+			return err
+		}
+		// only S3 uploads in parts
+		if bucket, ok := store.(s3.S3Bucket); ok {
+			bucket.PartSize = partSize
+			store = bucket
+		}
+	}
 
-	sourceBase := args[1]
-	fileInfo, err := os.Stat(sourceBase)
-	s3base.CheckIfError(1, err)
+	options, err := uploadOptions()
+	if err != nil {
+		return err
+	}
 
 	key := ""
 	if len(args) > 2 {
 		key = args[2]
 	}
 
+	sourceBase := args[1]
+	if sourceBase == "-" {
+		if key == "" {
+			return fmt.Errorf("an object key is required to upload from stdin")
+		}
+		if uploadFlags.dryRun {
+			fmt.Printf("- -> %s\n", key)
+			return nil
+		}
+		ts := newTransfers(ctx, 1, 0, !uploadFlags.noProgress)
+		// stdin can not be read again, hence no retries
+		err := ts.transfer("-", -1, func(t *s3base.Transfer) error {
+			return store.Put(ctx, key, t.Reader(os.Stdin), -1, options)
+		})
+		ts.finish()
+		if err := interrupted(ctx); err != nil {
+			return err
+		}
+		return s3base.WithExitCode(exitUpload, err)
+	}
+
+	template, err := uploadKeyTemplate()
+	if err != nil {
+		return err
+	}
+
+	fileInfo, err := os.Stat(sourceBase)
+	if err != nil {
+		return err
+	}
 	if fileInfo.IsDir() {
 		if !uploadFlags.recursive {
-			log.Fatalf("file %s is a directory (use recursive flag)", sourceBase)
-			return
-		}
-		err := filepath.Walk(sourceBase,
-			func(p string, fi os.FileInfo, err error) error {
-				s3base.CheckIfError(2, err)
-				if !fi.IsDir() {
-					f, err := os.Open(p)
-					s3base.CheckIfError(3, err)
-					defer f.Close()
-					return bucket.Upload(createKey(key, p, sourceBase), f)
+			return fmt.Errorf("file %s is a directory (use recursive flag)", sourceBase)
+		}
+		if uploadFlags.followSymlinks && uploadFlags.storeSymlinks {
+			return fmt.Errorf("symlinks can either be followed or stored")
+		}
+	} else if key == "" {
+		// an explicitly specified key is used as is for single files
+		key, err = createKey(template, key, keyFile{path: sourceBase, base: filepath.Dir(sourceBase), info: fileInfo})
+		if err != nil {
+			return err
+		}
+	}
+
+	u := &uploader{ctx: ctx, store: store, options: options}
+	if uploadFlags.skipExisting != "" {
+		prefix := key
+		if fileInfo.IsDir() {
+			prefix += template.literalPrefix()
+		}
+		u.skipper, err = newUploadSkipper(ctx, store, uploadFlags.skipExisting, prefix, uploadFlags.fetchSize)
+		if err != nil {
+			return s3base.WithExitCode(exitListing, err)
+		}
+	}
+	if uploadFlags.dryRun {
+		// keep the listing in order
+		u.transfers = newTransfers(ctx, 1, 0, false)
+	} else {
+		u.journal, err = startJournal(uploadFlags.resume, uploadFlags.journal, "up", args[0], args)
+		if err != nil {
+			return s3base.WithExitCode(exitJournal, err)
+		}
+		defer func() { err = u.journal.resumeHint(err) }()
+		u.transfers = newTransfers(ctx, uploadFlags.parallel, uploadFlags.retries, !uploadFlags.noProgress)
+	}
+
+	var walkErr error
+	if fileInfo.IsDir() {
+		walker := &uploadWalker{
+			filter:         newUploadFilter(uploadFlags.excludes, uploadFlags.includes),
+			followSymlinks: uploadFlags.followSymlinks,
+			storeSymlinks:  uploadFlags.storeSymlinks,
+			skipHidden:     uploadFlags.skipHidden,
+			visitFile: func(p string, fi os.FileInfo) error {
+				if ctx.Err() != nil {
+					return ctx.Err()
+				}
+				k, err := createKey(template, key, keyFile{path: p, base: sourceBase, info: fi})
+				if err != nil {
+					return err
+				}
+				u.transfers.progress.AddTotal(1, fi.Size())
+				u.transfers.submit(func() error { return u.uploadFile(k, p, fi) })
+				return nil
+			},
+			visitSymlink: func(p string, target string, fi os.FileInfo) error {
+				if ctx.Err() != nil {
+					return ctx.Err()
+				}
+				k, err := createKey(template, key, keyFile{path: p, base: sourceBase, info: fi})
+				if err != nil {
+					return err
 				}
+				u.transfers.progress.AddTotal(1, int64(len(target)))
+				u.transfers.submit(func() error { return u.uploadSymlink(k, p, target, fi) })
 				return nil
-			})
-		s3base.CheckIfError(4, err)
+			},
+		}
+		walkErr = walker.walk(sourceBase)
 	} else {
-		f, err := os.Open(sourceBase)
-		s3base.CheckIfError(5, err)
+		u.transfers.progress.AddTotal(1, fileInfo.Size())
+		u.transfers.submit(func() error { return u.uploadFile(key, sourceBase, fileInfo) })
+	}
+
+	if uploadFlags.dryRun {
+		u.transfers.wait()
+		return s3base.WithExitCode(exitListing, walkErr)
+	}
+	failures := u.transfers.finish()
+	if err := interrupted(ctx); err != nil {
+		return err
+	}
+	if walkErr != nil {
+		return s3base.WithExitCode(exitListing, walkErr)
+	}
+	if failures > 0 {
+		return s3base.WithExitCode(exitUpload, fmt.Errorf("%d file(s) failed to upload", failures))
+	}
+	return s3base.WithExitCode(exitJournal, u.journal.finish())
+}
+
+// uploader holds the state shared by all uploads of a run.
+type uploader struct {
+	ctx       context.Context
+	store     s3.ObjectStore
+	options   s3.S3PutOptions
+	skipper   *uploadSkipper
+	journal   *journal
+	transfers *transfers
+}
+
+func (u *uploader) uploadFile(key string, p string, fi os.FileInfo) error {
+	if u.journal != nil && u.journal.isCompleted(key) {
+		log.Debugf("skipping %s uploaded before", p)
+		u.transfers.progress.Skip(fi.Size())
+		return nil
+	}
+	if u.skipper != nil {
+		unchanged, err := u.skipper.unchanged(key, p, fi)
+		if err != nil {
+			return err
+		}
+		if unchanged {
+			log.Infof("skipping unchanged %s", p)
+			u.transfers.progress.Skip(fi.Size())
+			return nil
+		}
+	}
+	if uploadFlags.dryRun {
+		fmt.Printf("%s -> %s\n", p, key)
+		return nil
+	}
+	return u.transfers.transfer(p, fi.Size(), func(t *s3base.Transfer) error {
+		f, err := os.Open(p)
+		if err != nil {
+			return err
+		}
 		defer f.Close()
-		err = bucket.Upload(createKey(key, sourceBase, filepath.Dir(sourceBase)), f)
-		s3base.CheckIfError(6, err)
+		return u.upload(key, t.Reader(f), fi.Size(), fileUploadOptions(u.options, fi))
+	})
+}
+
+// uploadSymlink stores the target of a symlink as content and metadata of an object.
+func (u *uploader) uploadSymlink(key string, p string, target string, fi os.FileInfo) error {
+	size := int64(len(target))
+	if u.journal != nil && u.journal.isCompleted(key) {
+		u.transfers.progress.Skip(size)
+		return nil
 	}
+	if uploadFlags.dryRun {
+		fmt.Printf("%s -> %s (symlink to %s)\n", p, key, target)
+		return nil
+	}
+	options := withMetadata(fileUploadOptions(u.options, fi), map[string]string{metaSymlink: target})
+	return u.transfers.transfer(p, size, func(t *s3base.Transfer) error {
+		return u.upload(key, t.Reader(strings.NewReader(target)), size, options)
+	})
 }
 
-func createKey(keyPrefix string, source string, sourceBasePath string) string {
-	if keyPrefix == "" || uploadFlags.recursive {
-		a, err := filepath.Abs(source)
-		s3base.CheckIfError(1, err)
-		switch uploadFlags.keyMode {
-		case "b":
-			fallthrough
-		case "B":
-			return keyPrefix + filepath.Base(a)
-		case "A":
-			fallthrough
-		case "a":
-			return keyPrefix + strings.ReplaceAll(a, string(os.PathSeparator), uploadFlags.keyToPathDelimiter)
-		case "R":
-			fallthrough
-		case "r":
-			return keyPrefix + strings.ReplaceAll(strings.TrimPrefix(a, sourceBasePath), string(os.PathSeparator), uploadFlags.keyToPathDelimiter)
-		default:
-			log.Fatalf("invalid key mode %s specified!", uploadFlags.keyMode)
-		}
-	}
-	return keyPrefix
+func (u *uploader) upload(key string, r io.Reader, size int64, options s3.S3PutOptions) error {
+	resumable, ok := u.store.(s3.ResumableStore)
+	if u.journal == nil || !ok {
+		err := u.store.Put(u.ctx, key, r, size, options)
+		if err != nil || u.journal == nil {
+			return err
+		}
+		return u.journal.complete(key)
+	}
+	// the multipart upload of an interrupted transfer is kept to be resumed,
+	// jobs clean aborts it if not
+	err := resumable.UploadResumable(u.ctx, key, r, size, options, u.journal.upload(key), u.journal)
+	if err != nil {
+		return err
+	}
+	return u.journal.complete(key)
+}
+
+func uploadOptions() (s3.S3PutOptions, error) {
+	meta, err := s3base.ParseKeyValues(uploadFlags.meta)
+	if err != nil {
+		return s3.S3PutOptions{}, err
+	}
+	tags, err := parseTags(uploadFlags.tags)
+	if err != nil {
+		return s3.S3PutOptions{}, err
+	}
+	return s3.S3PutOptions{
+		ContentType:        uploadFlags.contentType,
+		CacheControl:       uploadFlags.cacheControl,
+		ContentEncoding:    uploadFlags.contentEncoding,
+		ContentDisposition: uploadFlags.contentDisposition,
+		StorageClass:       uploadFlags.storageClass,
+		Acl:                uploadFlags.acl,
+		Metadata:           meta,
+		Tags:               tags,
+	}, nil
+}
+
+func fileUploadOptions(options s3.S3PutOptions, fi os.FileInfo) s3.S3PutOptions {
+	if !uploadFlags.preserve {
+		return options
+	}
+	return withMetadata(options, fileAttributes(fi))
+}
+
+const defaultKeyTemplate = "{basename}"
+
+func uploadKeyTemplate() (*keyTemplate, error) {
+	template := uploadFlags.keyTemplate
+	if uploadFlags.keyMode != "" {
+		if template != "" {
+			return nil, fmt.Errorf("key mode and key template can not be combined")
+		}
+		t, ok := keyModeTemplates[strings.ToUpper(uploadFlags.keyMode)]
+		if !ok {
+			return nil, fmt.Errorf("invalid key mode %s specified!", uploadFlags.keyMode)
+		}
+		template = t
+	}
+	if template == "" {
+		// the key mode B was the default before templates existed
+		template = defaultKeyTemplate
+	}
+	return parseKeyTemplate(template, uploadFlags.keyToPathDelimiter, time.Now())
+}
+
+func keyVariableUsage() string {
+	names := make([]string, 0, len(keyVariables))
+	for name := range keyVariables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	usage := ""
+	for _, name := range names {
+		usage += "\n  {" + name + "}: " + keyVariables[name]
+	}
+	return usage + "\n"
+}
+
+func createKey(template *keyTemplate, keyPrefix string, file keyFile) (string, error) {
+	key, err := template.render(file)
+	if err != nil {
+		return "", err
+	}
+	return keyPrefix + key, nil
 }
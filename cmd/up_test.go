@@ -0,0 +1,69 @@
+package cmd
+
+import (
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestUploadSkipExistingRequiresValue(t *testing.T) {
+	saved := uploadFlags
+	defer func() { uploadFlags = saved }()
+	err := uploadCmd.ParseFlags([]string{"--skip-existing", "size", "bucket", "dir"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if uploadFlags.skipExisting != skipBySize {
+		t.Errorf("--skip-existing is %q, expected %q", uploadFlags.skipExisting, skipBySize)
+	}
+	if args := uploadCmd.Flags().Args(); !reflect.DeepEqual(args, []string{"bucket", "dir"}) {
+		t.Errorf("arguments are %v, expected [bucket dir]", args)
+	}
+	if err := uploadCmd.ParseFlags([]string{"bucket", "dir", "--skip-existing"}); err == nil {
+		t.Error("--skip-existing without a value was accepted")
+	}
+}
+
+func TestUploadKeyTemplate(t *testing.T) {
+	saved := uploadFlags
+	defer func() { uploadFlags = saved }()
+	inTempDir(t)
+	info, err := os.Stat("dir/sub/file.tar.gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		mode     string
+		template string
+		key      string
+	}{
+		// keys of the basename like the default key mode B before templates
+		{"", "", "file.tar.gz"},
+		{"B", "", "file.tar.gz"},
+		{"r", "", "sub/file.tar.gz"},
+		{"", "{relpath}", "sub/file.tar.gz"},
+		{"", "x/{basename}", "x/file.tar.gz"},
+	}
+	for _, test := range tests {
+		uploadFlags.keyMode = test.mode
+		uploadFlags.keyTemplate = test.template
+		kt, err := uploadKeyTemplate()
+		if err != nil {
+			t.Fatal(err)
+		}
+		key, err := kt.render(keyFile{path: "dir/sub/file.tar.gz", base: "dir", info: info})
+		if err != nil || key != test.key {
+			t.Errorf("key of mode %q and template %q is %s (%v), expected %s", test.mode, test.template, key, err, test.key)
+		}
+	}
+	uploadFlags.keyMode = "B"
+	uploadFlags.keyTemplate = "{relpath}"
+	if _, err := uploadKeyTemplate(); err == nil {
+		t.Error("key mode and template were combined")
+	}
+	uploadFlags.keyMode = "X"
+	uploadFlags.keyTemplate = ""
+	if _, err := uploadKeyTemplate(); err == nil {
+		t.Error("invalid key mode was accepted")
+	}
+}
@@ -0,0 +1,69 @@
+package cmd
+
+import (
+	"path/filepath"
+	s3base "s3cli/base"
+	"strings"
+)
+
+const ignoreFileName = ".s3ignore"
+
+// uploadFilter decides which files of a recursive upload are skipped, based
+// on .s3ignore files and --exclude/--include patterns. Ignore files apply to
+// the directory they are found in and all its subdirectories.
+type uploadFilter struct {
+	ignores  map[string][]s3base.IgnorePattern
+	excludes []s3base.IgnorePattern
+	includes []s3base.IgnorePattern
+}
+
+func newUploadFilter(excludes []string, includes []string) *uploadFilter {
+	return &uploadFilter{
+		ignores:  make(map[string][]s3base.IgnorePattern),
+		excludes: s3base.ParseIgnorePatterns(excludes),
+		includes: s3base.ParseIgnorePatterns(includes),
+	}
+}
+
+// enterDir reads the ignore file of a directory, rel is the slash separated
+// path of the directory relative to the base of the upload.
+func (uf *uploadFilter) enterDir(dir string, rel string) error {
+	patterns, err := s3base.ReadIgnoreFile(filepath.Join(dir, ignoreFileName))
+	if err != nil {
+		return err
+	}
+	if len(patterns) > 0 {
+		uf.ignores[rel] = patterns
+	}
+	return nil
+}
+
+// excluded tests a slash separated path relative to the base of the upload.
+func (uf *uploadFilter) excluded(rel string, isDir bool) bool {
+	if rel == "" {
+		return false
+	}
+	ignored := false
+	// apply ignore files from the base of the upload down to the parent directory
+	segments := strings.Split(rel, "/")
+	for i := range segments {
+		patterns, ok := uf.ignores[strings.Join(segments[:i], "/")]
+		if !ok {
+			continue
+		}
+		if ign, matched := s3base.MatchIgnorePatterns(patterns, strings.Join(segments[i:], "/"), isDir); matched {
+			ignored = ign
+		}
+	}
+	if ignored {
+		return true
+	}
+	if excluded, _ := s3base.MatchIgnorePatterns(uf.excludes, rel, isDir); excluded {
+		return true
+	}
+	if isDir || len(uf.includes) == 0 {
+		return false
+	}
+	included, _ := s3base.MatchIgnorePatterns(uf.includes, rel, isDir)
+	return !included
+}
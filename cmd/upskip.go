@@ -0,0 +1,73 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	s3 "s3cli/s3"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	skipBySize  = "size"
+	skipByETag  = "etag"
+	skipByMtime = "mtime"
+)
+
+// uploadSkipper compares local files with the objects found by a single
+// listing of the destination to skip unchanged files.
+type uploadSkipper struct {
+	store  s3.ObjectStore
+	mode   string
+	remote map[string]s3.S3Item
+}
+
+func newUploadSkipper(ctx context.Context, store s3.ObjectStore, mode string, prefix string, fetchSize int) (*uploadSkipper, error) {
+	switch mode {
+	case skipBySize, skipByETag, skipByMtime:
+	default:
+		return nil, fmt.Errorf("invalid skip mode %s specified!", mode)
+	}
+	us := &uploadSkipper{
+		store:  store,
+		mode:   mode,
+		remote: make(map[string]s3.S3Item),
+	}
+	err := store.List(ctx, prefix, fetchSize, us)
+	if err != nil {
+		return nil, fmt.Errorf("error listing %s: %v", prefix, err)
+	}
+	log.Debugf("%d object(s) found below %s", len(us.remote), prefix)
+	return us, nil
+}
+
+func (us *uploadSkipper) VisitListing(partialResult *s3.S3ListBucketResult) (bool, error) {
+	for _, item := range partialResult.Contents {
+		us.remote[item.Key] = item
+	}
+	return true, nil
+}
+
+// unchanged tests whether the object stored under key is up to date.
+func (us *uploadSkipper) unchanged(key string, p string, fi os.FileInfo) (bool, error) {
+	item, ok := us.remote[key]
+	if !ok || item.Size != fi.Size() {
+		return false, nil
+	}
+	switch us.mode {
+	case skipByMtime:
+		return !item.LastModified.Before(fi.ModTime()), nil
+	case skipByETag:
+		f, err := os.Open(p)
+		if err != nil {
+			return false, err
+		}
+		defer f.Close()
+		if bucket, ok := us.store.(s3.S3Bucket); ok {
+			return bucket.ETagMatches(f, fi.Size(), item.ETag)
+		}
+		return s3.ETagMatches(f, fi.Size(), item.ETag, s3.DefaultPartSize)
+	}
+	return true, nil
+}
@@ -0,0 +1,113 @@
+package cmd
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// uploadWalker traverses the directory tree of a recursive upload in
+// lexical order. Unlike filepath.Walk, symlinks are followed or stored on
+// request and special files like sockets or FIFOs are skipped.
+type uploadWalker struct {
+	filter         *uploadFilter
+	followSymlinks bool
+	storeSymlinks  bool
+	skipHidden     bool
+	// real paths of the directories currently being walked, to detect loops
+	active map[string]bool
+	// visitFile is called for regular files, visitSymlink for symlinks to be stored
+	visitFile    func(p string, fi os.FileInfo) error
+	visitSymlink func(p string, target string, fi os.FileInfo) error
+}
+
+func (w *uploadWalker) walk(base string) error {
+	if w.active == nil {
+		w.active = make(map[string]bool)
+	}
+	return w.walkDir(base, "")
+}
+
+// walkDir visits the entries of a directory, rel is the slash separated path
+// of the directory relative to the base of the upload.
+func (w *uploadWalker) walkDir(dir string, rel string) error {
+	real, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return err
+	}
+	if w.active[real] {
+		log.Warnf("skipping %s: symlink loop back to %s", dir, real)
+		return nil
+	}
+	w.active[real] = true
+	defer delete(w.active, real)
+
+	err = w.filter.enterDir(dir, rel)
+	if err != nil {
+		return err
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		p := filepath.Join(dir, e.Name())
+		r := path.Join(rel, e.Name())
+		if w.skipHidden && strings.HasPrefix(e.Name(), ".") {
+			log.Debugf("skipping hidden %s", p)
+			continue
+		}
+		fi, err := os.Lstat(p)
+		if err != nil {
+			return err
+		}
+
+		if fi.Mode()&os.ModeSymlink != 0 {
+			switch {
+			case w.storeSymlinks:
+				if w.filter.excluded(r, false) {
+					log.Debugf("skipping excluded %s", p)
+					continue
+				}
+				target, err := os.Readlink(p)
+				if err != nil {
+					return err
+				}
+				err = w.visitSymlink(p, target, fi)
+				if err != nil {
+					return err
+				}
+				continue
+			case w.followSymlinks:
+				fi, err = os.Stat(p)
+				if err != nil {
+					log.Warnf("skipping dangling symlink %s: %v", p, err)
+					continue
+				}
+			default:
+				log.Warnf("skipping symlink %s (use --follow-symlinks or --store-symlinks)", p)
+				continue
+			}
+		}
+
+		if w.filter.excluded(r, fi.IsDir()) {
+			log.Debugf("skipping excluded %s", p)
+			continue
+		}
+		switch {
+		case fi.IsDir():
+			err = w.walkDir(p, r)
+		case fi.Mode().IsRegular():
+			err = w.visitFile(p, fi)
+		default:
+			log.Warnf("skipping special file %s (%s)", p, fi.Mode().Type())
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
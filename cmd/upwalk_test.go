@@ -0,0 +1,140 @@
+//go:build !windows
+// +build !windows
+
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"syscall"
+	"testing"
+)
+
+// walkTree builds the tree
+//
+//	.hidden
+//	.s3ignore          ignores *.log and build/
+//	a.txt
+//	build/out.bin
+//	dangling -> missing
+//	fifo
+//	link.txt -> a.txt
+//	linkdir -> sub
+//	sub/.s3ignore      ignores b2.txt
+//	sub/b.txt
+//	sub/b2.txt
+//	sub/c.log
+//	sub/loop -> ..
+//	x.log
+func walkTree(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	files := map[string]string{
+		".hidden":       "",
+		".s3ignore":     "*.log\nbuild/\n",
+		"a.txt":         "",
+		"build/out.bin": "",
+		"sub/.s3ignore": "b2.txt\n",
+		"sub/b.txt":     "",
+		"sub/b2.txt":    "",
+		"sub/c.log":     "",
+		"x.log":         "",
+	}
+	for name, content := range files {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	links := map[string]string{
+		"dangling": "missing",
+		"link.txt": "a.txt",
+		"linkdir":  "sub",
+		"sub/loop": "..",
+	}
+	for name, target := range links {
+		if err := os.Symlink(target, filepath.Join(dir, filepath.FromSlash(name))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := syscall.Mkfifo(filepath.Join(dir, "fifo"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+// walked returns the files and the symlinks visited by the walker relative
+// to the base.
+func walked(t *testing.T, w *uploadWalker, base string) ([]string, []string) {
+	t.Helper()
+	var files, symlinks []string
+	rel := func(p string) string {
+		r, err := filepath.Rel(base, p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return filepath.ToSlash(r)
+	}
+	w.filter = newUploadFilter(nil, nil)
+	w.visitFile = func(p string, fi os.FileInfo) error {
+		files = append(files, rel(p))
+		return nil
+	}
+	w.visitSymlink = func(p string, target string, fi os.FileInfo) error {
+		symlinks = append(symlinks, rel(p)+" -> "+target)
+		return nil
+	}
+	if err := w.walk(base); err != nil {
+		t.Fatal(err)
+	}
+	return files, symlinks
+}
+
+func TestUploadWalker(t *testing.T) {
+	base := walkTree(t)
+	tests := []struct {
+		name     string
+		walker   uploadWalker
+		files    []string
+		symlinks []string
+	}{
+		{
+			name:   "symlinks skipped",
+			walker: uploadWalker{},
+			files:  []string{".hidden", ".s3ignore", "a.txt", "sub/.s3ignore", "sub/b.txt"},
+		},
+		{
+			name:   "hidden files skipped",
+			walker: uploadWalker{skipHidden: true},
+			files:  []string{"a.txt", "sub/b.txt"},
+		},
+		{
+			// the loop back to the base and the dangling symlink are skipped
+			name:   "symlinks followed",
+			walker: uploadWalker{followSymlinks: true, skipHidden: true},
+			files:  []string{"a.txt", "link.txt", "linkdir/b.txt", "sub/b.txt"},
+		},
+		{
+			name:     "symlinks stored",
+			walker:   uploadWalker{storeSymlinks: true, skipHidden: true},
+			files:    []string{"a.txt", "sub/b.txt"},
+			symlinks: []string{"dangling -> missing", "link.txt -> a.txt", "linkdir -> sub", "sub/loop -> .."},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			files, symlinks := walked(t, &test.walker, base)
+			if !reflect.DeepEqual(files, test.files) {
+				t.Errorf("walked files %v, expected %v", files, test.files)
+			}
+			if !reflect.DeepEqual(symlinks, test.symlinks) {
+				t.Errorf("walked symlinks %v, expected %v", symlinks, test.symlinks)
+			}
+		})
+	}
+}
@@ -0,0 +1,75 @@
+package cmd
+
+import (
+	"fmt"
+	s3 "s3cli/s3"
+
+	cobra "github.com/spf13/cobra"
+)
+
+var (
+	versioningCmd = &cobra.Command{
+		Use:   "versioning",
+		Short: "manage the versioning of buckets",
+		Long: `enables or suspends the versioning of a bucket or prints its state. Once
+enabled, the versioning of a bucket can only be suspended, which keeps the
+versions stored before.`,
+	}
+	versioningEnableCmd = &cobra.Command{
+		Use:        "enable [flags] <bucket-name>",
+		Short:      "enable versioning",
+		RunE:       putVersioning(s3.VersioningEnabled),
+		Args:       cobra.ExactArgs(1),
+		ArgAliases: []string{"bucket"},
+	}
+	versioningSuspendCmd = &cobra.Command{
+		Use:        "suspend [flags] <bucket-name>",
+		Short:      "suspend versioning",
+		RunE:       putVersioning(s3.VersioningSuspended),
+		Args:       cobra.ExactArgs(1),
+		ArgAliases: []string{"bucket"},
+	}
+	versioningStatusCmd = &cobra.Command{
+		Use:        "status [flags] <bucket-name>",
+		Short:      "print the state of versioning",
+		Long:       `prints Enabled, Suspended or Disabled if versioning has never been enabled.`,
+		RunE:       versioningStatus,
+		Args:       cobra.ExactArgs(1),
+		ArgAliases: []string{"bucket"},
+	}
+)
+
+func init() {
+	versioningCmd.AddCommand(versioningEnableCmd, versioningSuspendCmd, versioningStatusCmd)
+	rootCmd.AddCommand(versioningCmd)
+}
+
+func putVersioning(status string) func(cmd *cobra.Command, args []string) error {
+	return func(cmd *cobra.Command, args []string) error {
+		bucket, err := FindBucket(args[0])
+		if err != nil {
+			return err
+		}
+		err = bucket.PutVersioning(cmd.Context(), status)
+		if err != nil {
+			return fmt.Errorf("error setting versioning of %s to %s: %w", bucket.Name, status, err)
+		}
+		return nil
+	}
+}
+
+func versioningStatus(cmd *cobra.Command, args []string) error {
+	bucket, err := FindBucket(args[0])
+	if err != nil {
+		return err
+	}
+	status, err := bucket.GetVersioning(cmd.Context())
+	if err != nil {
+		return fmt.Errorf("error reading versioning of %s: %w", bucket.Name, err)
+	}
+	if status == "" {
+		status = "Disabled"
+	}
+	fmt.Println(status)
+	return nil
+}
@@ -0,0 +1,247 @@
+package s3
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// canned ACLs of buckets and objects
+var CannedAcls = []string{
+	"private",
+	"public-read",
+	"public-read-write",
+	"aws-exec-read",
+	"authenticated-read",
+	"bucket-owner-read",
+	"bucket-owner-full-control",
+	"log-delivery-write",
+}
+
+// permissions of grants
+const (
+	PermissionFullControl = "FULL_CONTROL"
+	PermissionRead        = "READ"
+	PermissionWrite       = "WRITE"
+	PermissionReadAcp     = "READ_ACP"
+	PermissionWriteAcp    = "WRITE_ACP"
+)
+
+// grantHeaders are the headers granting the permissions on put.
+var grantHeaders = map[string]string{
+	PermissionFullControl: "X-Amz-Grant-Full-Control",
+	PermissionRead:        "X-Amz-Grant-Read",
+	PermissionWrite:       "X-Amz-Grant-Write",
+	PermissionReadAcp:     "X-Amz-Grant-Read-Acp",
+	PermissionWriteAcp:    "X-Amz-Grant-Write-Acp",
+}
+
+// groups of grantees
+const (
+	GroupAllUsers           = "http://acs.amazonaws.com/groups/global/AllUsers"
+	GroupAuthenticatedUsers = "http://acs.amazonaws.com/groups/global/AuthenticatedUsers"
+	GroupLogDelivery        = "http://acs.amazonaws.com/groups/s3/LogDelivery"
+)
+
+// S3Grantee is a canonical user given by its id, a group given by its URI
+// or a user given by the email address.
+type S3Grantee struct {
+	Type         string `xml:"http://www.w3.org/2001/XMLSchema-instance type,attr"`
+	Id           string `xml:"ID,omitempty"`
+	DisplayName  string `xml:"DisplayName,omitempty"`
+	URI          string `xml:"URI,omitempty"`
+	EmailAddress string `xml:"EmailAddress,omitempty"`
+}
+
+// String formats the grantee like the headers granting permissions.
+func (grantee S3Grantee) String() string {
+	switch {
+	case grantee.URI != "":
+		return fmt.Sprintf(`uri="%s"`, grantee.URI)
+	case grantee.EmailAddress != "":
+		return fmt.Sprintf(`emailAddress="%s"`, grantee.EmailAddress)
+	}
+	return fmt.Sprintf(`id="%s"`, grantee.Id)
+}
+
+type S3Grant struct {
+	Grantee    S3Grantee `xml:"Grantee"`
+	Permission string    `xml:"Permission"`
+}
+
+type S3AccessControlPolicy struct {
+	Owner  S3Owner   `xml:"Owner"`
+	Grants []S3Grant `xml:"AccessControlList>Grant"`
+}
+
+// ParseGrantee parses a grantee as id=..., uri=... or emailAddress=..., the
+// groups can be given by the last element of their URI, i.e. AllUsers.
+func ParseGrantee(s string) (S3Grantee, error) {
+	for _, group := range []string{GroupAllUsers, GroupAuthenticatedUsers, GroupLogDelivery} {
+		if strings.EqualFold(s, group[strings.LastIndex(group, "/")+1:]) {
+			return S3Grantee{Type: "Group", URI: group}, nil
+		}
+	}
+	i := strings.Index(s, "=")
+	if i < 0 {
+		return S3Grantee{}, fmt.Errorf("invalid grantee '%s' (expected i.e. id=<canonical-user-id> or AllUsers)", s)
+	}
+	value := strings.Trim(s[i+1:], `"`)
+	switch strings.ToLower(s[:i]) {
+	case "id":
+		return S3Grantee{Type: "CanonicalUser", Id: value}, nil
+	case "uri":
+		return S3Grantee{Type: "Group", URI: value}, nil
+	case "emailaddress":
+		return S3Grantee{Type: "AmazonCustomerByEmail", EmailAddress: value}, nil
+	}
+	return S3Grantee{}, fmt.Errorf("invalid grantee '%s' - allowed types are: id, uri or emailAddress", s)
+}
+
+// aclHeader sets the canned ACL or the grants, which replace all grants.
+func aclHeader(canned string, grants []S3Grant) (map[string]string, error) {
+	if canned != "" {
+		if len(grants) > 0 {
+			return nil, fmt.Errorf("a canned ACL can not be combined with grants")
+		}
+		for _, c := range CannedAcls {
+			if c == canned {
+				return map[string]string{"X-Amz-Acl": canned}, nil
+			}
+		}
+		return nil, fmt.Errorf("invalid canned ACL %s specified - allowed values are: %s", canned, strings.Join(CannedAcls, ", "))
+	}
+	if len(grants) == 0 {
+		return nil, fmt.Errorf("either a canned ACL or grants are required")
+	}
+	grantees := make(map[string][]string)
+	for _, grant := range grants {
+		if _, ok := grantHeaders[grant.Permission]; !ok {
+			return nil, fmt.Errorf("invalid permission %s specified - allowed values are: %s, %s, %s, %s or %s", grant.Permission, PermissionFullControl, PermissionRead, PermissionWrite, PermissionReadAcp, PermissionWriteAcp)
+		}
+		grantees[grant.Permission] = append(grantees[grant.Permission], grant.Grantee.String())
+	}
+	header := make(map[string]string)
+	for permission, list := range grantees {
+		sort.Strings(list)
+		header[grantHeaders[permission]] = strings.Join(list, ", ")
+	}
+	return header, nil
+}
+
+func (bucket S3Bucket) getAcl(ctx context.Context, resource string) (*S3AccessControlPolicy, error) {
+	reqUrl, err := url.Parse(bucket.Endpoint + "/" + resource + "?acl")
+	if err != nil {
+		return nil, err
+	}
+	resp, err := curl(ctx, bucket, "GET", reqUrl, http.NoBody, nil)
+	if err != nil {
+		return nil, err
+	}
+	var rlt S3AccessControlPolicy
+	err = xml.Unmarshal(resp.Bytes(), &rlt)
+	if err != nil {
+		return nil, err
+	}
+	return &rlt, nil
+}
+
+func (bucket S3Bucket) putAcl(ctx context.Context, resource string, canned string, grants []S3Grant) error {
+	header, err := aclHeader(canned, grants)
+	if err != nil {
+		return err
+	}
+	reqUrl, err := url.Parse(bucket.Endpoint + "/" + resource + "?acl")
+	if err != nil {
+		return err
+	}
+	_, err = curl(ctx, bucket, "PUT", reqUrl, http.NoBody, header)
+	if hasErrorCode(err, "AccessControlListNotSupported") {
+		return fmt.Errorf("the ACLs of the bucket are disabled by its object ownership setting: %w", err)
+	}
+	return err
+}
+
+// https://docs.aws.amazon.com/AmazonS3/latest/API/API_GetBucketAcl.html
+func (bucket S3Bucket) GetBucketAcl(ctx context.Context) (*S3AccessControlPolicy, error) {
+	return bucket.getAcl(ctx, "")
+}
+
+// https://docs.aws.amazon.com/AmazonS3/latest/API/API_PutBucketAcl.html
+//
+// Either the canned ACL or the grants replace all grants of the bucket.
+func (bucket S3Bucket) PutBucketAcl(ctx context.Context, canned string, grants []S3Grant) error {
+	return bucket.putAcl(ctx, "", canned, grants)
+}
+
+// https://docs.aws.amazon.com/AmazonS3/latest/API/API_GetObjectAcl.html
+func (bucket S3Bucket) GetObjectAcl(ctx context.Context, key string) (*S3AccessControlPolicy, error) {
+	return bucket.getAcl(ctx, key)
+}
+
+// https://docs.aws.amazon.com/AmazonS3/latest/API/API_PutObjectAcl.html
+//
+// Either the canned ACL or the grants replace all grants of the object.
+func (bucket S3Bucket) PutObjectAcl(ctx context.Context, key string, canned string, grants []S3Grant) error {
+	return bucket.putAcl(ctx, key, canned, grants)
+}
+
+// S3PublicAccessBlock holds the settings blocking public access, all of
+// them are off for buckets without configuration.
+type S3PublicAccessBlock struct {
+	XMLName               xml.Name `xml:"http://s3.amazonaws.com/doc/2006-03-01/ PublicAccessBlockConfiguration"`
+	BlockPublicAcls       bool     `xml:"BlockPublicAcls"`
+	IgnorePublicAcls      bool     `xml:"IgnorePublicAcls"`
+	BlockPublicPolicy     bool     `xml:"BlockPublicPolicy"`
+	RestrictPublicBuckets bool     `xml:"RestrictPublicBuckets"`
+}
+
+// https://docs.aws.amazon.com/AmazonS3/latest/API/API_GetPublicAccessBlock.html
+func (bucket S3Bucket) GetPublicAccessBlock(ctx context.Context) (*S3PublicAccessBlock, error) {
+	reqUrl, err := url.Parse(bucket.Endpoint + "/?publicAccessBlock")
+	if err != nil {
+		return nil, err
+	}
+	resp, err := curl(ctx, bucket, "GET", reqUrl, http.NoBody, nil)
+	if hasErrorCode(err, "NoSuchPublicAccessBlockConfiguration") {
+		return &S3PublicAccessBlock{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var rlt S3PublicAccessBlock
+	err = xml.Unmarshal(resp.Bytes(), &rlt)
+	if err != nil {
+		return nil, err
+	}
+	return &rlt, nil
+}
+
+// https://docs.aws.amazon.com/AmazonS3/latest/API/API_PutPublicAccessBlock.html
+func (bucket S3Bucket) PutPublicAccessBlock(ctx context.Context, config S3PublicAccessBlock) error {
+	reqUrl, err := url.Parse(bucket.Endpoint + "/?publicAccessBlock")
+	if err != nil {
+		return err
+	}
+	b, err := xml.Marshal(config)
+	if err != nil {
+		return err
+	}
+	_, err = curl(ctx, bucket, "PUT", reqUrl, bytes.NewReader(b), nil)
+	return err
+}
+
+// https://docs.aws.amazon.com/AmazonS3/latest/API/API_DeletePublicAccessBlock.html
+func (bucket S3Bucket) DeletePublicAccessBlock(ctx context.Context) error {
+	reqUrl, err := url.Parse(bucket.Endpoint + "/?publicAccessBlock")
+	if err != nil {
+		return err
+	}
+	_, err = curl(ctx, bucket, "DELETE", reqUrl, http.NoBody, nil)
+	return err
+}
@@ -0,0 +1,182 @@
+package s3
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// states of the versioning of buckets
+const (
+	VersioningEnabled   = "Enabled"
+	VersioningSuspended = "Suspended"
+)
+
+// S3BucketInfo is an entry of the listing of buckets.
+type S3BucketInfo struct {
+	Name         string    `xml:"Name"`
+	CreationDate time.Time `xml:"CreationDate"`
+}
+
+type S3ListAllMyBucketsResult struct {
+	Owner   S3Owner        `xml:"Owner"`
+	Buckets []S3BucketInfo `xml:"Buckets>Bucket"`
+}
+
+// S3CreateBucketOptions configure buckets at their creation.
+type S3CreateBucketOptions struct {
+	// LocationConstraint is the region of the bucket, the region of the
+	// endpoint by default.
+	LocationConstraint string
+	// ObjectLock enables S3 Object Lock, which enables versioning as well.
+	ObjectLock bool
+	Versioning bool
+	Acl        string
+}
+
+type s3CreateBucketConfiguration struct {
+	XMLName            xml.Name `xml:"http://s3.amazonaws.com/doc/2006-03-01/ CreateBucketConfiguration"`
+	LocationConstraint string   `xml:"LocationConstraint"`
+}
+
+type s3VersioningConfiguration struct {
+	XMLName xml.Name `xml:"http://s3.amazonaws.com/doc/2006-03-01/ VersioningConfiguration"`
+	Status  string   `xml:"Status"`
+}
+
+// serviceEndpoint is the endpoint without the bucket, which is the path of
+// path-style endpoints or the leading host label otherwise.
+func (bucket S3Bucket) serviceEndpoint() (*url.URL, error) {
+	u, err := url.Parse(bucket.Endpoint)
+	if err != nil {
+		return nil, err
+	}
+	if strings.Trim(u.Path, "/") != "" {
+		u.Path = ""
+		return u, nil
+	}
+	parts := strings.SplitN(u.Host, ".", 2)
+	if len(parts) < 2 {
+		return nil, fmt.Errorf("endpoint %s names no bucket", bucket.Endpoint)
+	}
+	u.Host = parts[1]
+	return u, nil
+}
+
+// Sibling returns the bucket of the given name at the same service, it is
+// accessed with the credentials of this bucket.
+func (bucket S3Bucket) Sibling(name string) (S3Bucket, error) {
+	if !bucketNamePattern.MatchString(name) {
+		return S3Bucket{}, fmt.Errorf("invalid bucket name %s - allowed are 3 to 63 lowercase letters, digits, dots and hyphens", name)
+	}
+	u, err := url.Parse(bucket.Endpoint)
+	if err != nil {
+		return S3Bucket{}, err
+	}
+	service, err := bucket.serviceEndpoint()
+	if err != nil {
+		return S3Bucket{}, err
+	}
+	if strings.Trim(u.Path, "/") != "" {
+		service.Path = "/" + name
+	} else {
+		service.Host = name + "." + service.Host
+	}
+	sibling := bucket
+	sibling.Name = name
+	sibling.Endpoint = service.String()
+	return sibling, nil
+}
+
+// https://docs.aws.amazon.com/AmazonS3/latest/API/API_ListBuckets.html
+//
+// ListBuckets lists the buckets owned by the credentials of the bucket at
+// its service.
+func (bucket S3Bucket) ListBuckets(ctx context.Context) (*S3ListAllMyBucketsResult, error) {
+	reqUrl, err := bucket.serviceEndpoint()
+	if err != nil {
+		return nil, err
+	}
+	reqUrl.Path = "/"
+	resp, err := curl(ctx, bucket, "GET", reqUrl, http.NoBody, nil)
+	if err != nil {
+		return nil, err
+	}
+	var rlt S3ListAllMyBucketsResult
+	err = xml.Unmarshal(resp.Bytes(), &rlt)
+	if err != nil {
+		return nil, err
+	}
+	return &rlt, nil
+}
+
+// https://docs.aws.amazon.com/AmazonS3/latest/API/API_CreateBucket.html
+//
+// The location constraint is omitted for us-east-1, which does not accept
+// it. Versioning is enabled after the bucket has been created.
+func (bucket S3Bucket) Create(ctx context.Context, options S3CreateBucketOptions) error {
+	reqUrl, err := url.Parse(bucket.Endpoint + "/")
+	if err != nil {
+		return err
+	}
+	header := make(map[string]string)
+	if options.Acl != "" {
+		header["x-amz-acl"] = options.Acl
+	}
+	if options.ObjectLock {
+		header["x-amz-bucket-object-lock-enabled"] = "true"
+	}
+	location := options.LocationConstraint
+	if location == "" {
+		location = bucket.Region
+	}
+	var payload bytes.Buffer
+	if location != "" && location != "us-east-1" {
+		b, err := xml.Marshal(s3CreateBucketConfiguration{LocationConstraint: location})
+		if err != nil {
+			return err
+		}
+		payload.Write(b)
+	}
+	_, err = curl(ctx, bucket, "PUT", reqUrl, &payload, header)
+	if err != nil {
+		return err
+	}
+	if options.Versioning && !options.ObjectLock {
+		return bucket.PutVersioning(ctx, VersioningEnabled)
+	}
+	return nil
+}
+
+// https://docs.aws.amazon.com/AmazonS3/latest/API/API_DeleteBucket.html
+//
+// Only empty buckets can be removed.
+func (bucket S3Bucket) Remove(ctx context.Context) error {
+	reqUrl, err := url.Parse(bucket.Endpoint + "/")
+	if err != nil {
+		return err
+	}
+	_, err = curl(ctx, bucket, "DELETE", reqUrl, http.NoBody, nil)
+	return err
+}
+
+// https://docs.aws.amazon.com/AmazonS3/latest/API/API_PutBucketVersioning.html
+//
+// The status is either VersioningEnabled or VersioningSuspended.
+func (bucket S3Bucket) PutVersioning(ctx context.Context, status string) error {
+	reqUrl, err := url.Parse(bucket.Endpoint + "/?versioning")
+	if err != nil {
+		return err
+	}
+	b, err := xml.Marshal(s3VersioningConfiguration{Status: status})
+	if err != nil {
+		return err
+	}
+	_, err = curl(ctx, bucket, "PUT", reqUrl, bytes.NewReader(b), nil)
+	return err
+}
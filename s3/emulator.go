@@ -0,0 +1,706 @@
+package s3
+
+import (
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Emulator serves the buckets below a directory by a subset of the S3 REST
+// API with path-style addressing, i.e. http://host/bucket/key. Each
+// subdirectory of the root is a bucket whose objects are kept by a
+// FileStore. Unless the access key id is empty, requests have to be signed
+// like by signAwsV4 with the given credentials.
+type Emulator struct {
+	Root        string
+	AccessKeyId string
+	SecretKey   string
+	// Region is expected in the scope of signatures, any region is accepted if empty.
+	Region string
+}
+
+func NewEmulator(root string) *Emulator {
+	return &Emulator{Root: root}
+}
+
+const (
+	// maxClockSkew bounds the deviation of the time of signed requests
+	maxClockSkew = 15 * time.Minute
+)
+
+// responseOverrides are the query parameters of GetObject overriding
+// headers of the response
+var responseOverrides = map[string]string{
+	"response-cache-control":       "Cache-Control",
+	"response-content-disposition": "Content-Disposition",
+	"response-content-encoding":    "Content-Encoding",
+	"response-content-language":    "Content-Language",
+	"response-content-type":        "Content-Type",
+	"response-expires":             "Expires",
+}
+
+var bucketNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9.-]{1,61}[a-z0-9]$`)
+
+// emulatorError is reported to the client as S3 error response.
+type emulatorError struct {
+	status  int
+	code    string
+	message string
+}
+
+func (e *emulatorError) Error() string {
+	return e.code + ": " + e.message
+}
+
+func newEmulatorError(status int, code string, format string, args ...interface{}) *emulatorError {
+	return &emulatorError{status: status, code: code, message: fmt.Sprintf(format, args...)}
+}
+
+type emulatorErrorResponse struct {
+	XMLName   xml.Name `xml:"Error"`
+	Code      string   `xml:"Code"`
+	Message   string   `xml:"Message"`
+	Resource  string   `xml:"Resource"`
+	RequestId string   `xml:"RequestId"`
+}
+
+type emulatorListResult struct {
+	XMLName xml.Name `xml:"http://s3.amazonaws.com/doc/2006-03-01/ ListBucketResult"`
+	S3ListBucketResult
+}
+
+type emulatorDelete struct {
+	Quiet   bool                 `xml:"Quiet"`
+	Objects []s3ObjectIdentifier `xml:"Object"`
+}
+
+type emulatorDeleteResult struct {
+	XMLName xml.Name `xml:"http://s3.amazonaws.com/doc/2006-03-01/ DeleteResult"`
+	S3DeleteResult
+}
+
+type emulatorCopyResult struct {
+	XMLName      xml.Name  `xml:"http://s3.amazonaws.com/doc/2006-03-01/ CopyObjectResult"`
+	ETag         string    `xml:"ETag"`
+	LastModified time.Time `xml:"LastModified"`
+}
+
+// emulatorResponse records the status for the access log and whether an
+// error can still be reported.
+type emulatorResponse struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *emulatorResponse) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *emulatorResponse) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	return r.ResponseWriter.Write(b)
+}
+
+func (em *Emulator) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	requestId := randomHex(8)
+	w.Header().Set("X-Amz-Request-Id", requestId)
+	resp := &emulatorResponse{ResponseWriter: w}
+	err := em.serve(resp, req)
+	if err != nil {
+		if resp.status != 0 {
+			// the response has been started already
+			log.Warnf("%s %s failed: %v", req.Method, req.URL.Path, err)
+		} else {
+			writeEmulatorError(resp, req, requestId, err)
+		}
+	}
+	log.Infof("%s %s %s %d", req.RemoteAddr, req.Method, req.URL.RequestURI(), resp.status)
+}
+
+func writeEmulatorError(w http.ResponseWriter, req *http.Request, requestId string, err error) {
+	var e *emulatorError
+	switch {
+	case errors.As(err, &e):
+	case errors.Is(err, ErrNoSuchKey):
+		e = newEmulatorError(http.StatusNotFound, "NoSuchKey", "the specified key does not exist")
+	case errors.Is(err, errUnsafeKey):
+		e = newEmulatorError(http.StatusBadRequest, "InvalidArgument", "%v", err)
+	default:
+		log.Errorf("%s %s failed: %v", req.Method, req.URL.Path, err)
+		e = newEmulatorError(http.StatusInternalServerError, "InternalError", "%v", err)
+	}
+	if req.Method == "HEAD" {
+		w.WriteHeader(e.status)
+		return
+	}
+	writeXML(w, e.status, emulatorErrorResponse{Code: e.code, Message: e.message, Resource: req.URL.Path, RequestId: requestId})
+}
+
+func writeXML(w http.ResponseWriter, status int, v interface{}) error {
+	body, err := xml.Marshal(v)
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	_, err = w.Write(append([]byte(xml.Header), body...))
+	return err
+}
+
+func (em *Emulator) serve(w http.ResponseWriter, req *http.Request) error {
+	bucket, key := splitBucketPath(req.URL.Path)
+	// uploads of browsers are authorized by the policy of their form
+	form := req.Method == "POST" && key == "" && strings.HasPrefix(req.Header.Get("Content-Type"), "multipart/form-data")
+	if !form {
+		err := em.verify(req)
+		if err != nil {
+			return err
+		}
+	}
+	query := req.URL.Query()
+	switch {
+	case bucket == "" && req.Method == "GET":
+		return em.listBuckets(w)
+	case bucket == "":
+		return notImplemented(req)
+	case key == "" && req.Method == "PUT" && len(query) == 0:
+		return em.createBucket(w, req, bucket)
+	}
+	store, err := em.bucket(bucket)
+	if err != nil {
+		return err
+	}
+	if form {
+		return em.postObject(w, req, bucket, store)
+	}
+	_, uploads := query["uploads"]
+	uploadId := query.Get("uploadId")
+	if key == "" {
+		_, del := query["delete"]
+		_, versions := query["versions"]
+		_, versioning := query["versioning"]
+		_, lifecycle := query["lifecycle"]
+		_, policy := query["policy"]
+		_, publicAccessBlock := query["publicAccessBlock"]
+		_, acl := query["acl"]
+		switch {
+		case req.Method == "GET" && query.Get("list-type") == "2":
+			return em.listObjects(w, req, bucket, store)
+		case req.Method == "GET" && versions:
+			return em.listVersions(w, req, bucket, store)
+		case req.Method == "GET" && versioning:
+			return em.getVersioning(w)
+		case lifecycle:
+			return em.bucketLifecycle(w, req, bucket)
+		case policy:
+			return em.bucketPolicy(w, req, bucket)
+		case publicAccessBlock:
+			return em.bucketPublicAccessBlock(w, req, bucket)
+		case acl:
+			return em.acl(w, req, store, "")
+		case req.Method == "POST" && del:
+			return em.deleteObjects(w, req, store)
+		case req.Method == "DELETE" && len(query) == 0:
+			return em.deleteBucket(w, req, bucket, store)
+		}
+		return notImplemented(req)
+	}
+	if v := query.Get("versionId"); v != "" && v != nullVersionId {
+		return newEmulatorError(http.StatusNotFound, "NoSuchVersion", "the specified version %s does not exist", v)
+	}
+	if _, tagging := query["tagging"]; tagging {
+		return em.objectTagging(w, req, store, key)
+	}
+	if _, acl := query["acl"]; acl {
+		return em.acl(w, req, store, key)
+	}
+	switch {
+	case (req.Method == "GET" || req.Method == "HEAD") && uploadId == "":
+		return em.getObject(w, req, store, key)
+	case req.Method == "PUT" && uploadId != "":
+		return em.uploadPart(w, req, bucket, key, uploadId)
+	case req.Method == "PUT" && req.Header.Get("X-Amz-Copy-Source") != "":
+		return em.copyObject(w, req, store, key)
+	case req.Method == "PUT":
+		return em.putObject(w, req, store, key)
+	case req.Method == "DELETE" && uploadId != "":
+		return em.abortUpload(w, bucket, key, uploadId)
+	case req.Method == "DELETE":
+		err = store.remove(key)
+		if err == nil {
+			w.WriteHeader(http.StatusNoContent)
+		}
+		return err
+	case req.Method == "POST" && uploads:
+		return em.createUpload(w, req, bucket, store, key)
+	case req.Method == "POST" && uploadId != "":
+		return em.completeUpload(w, req, bucket, store, key, uploadId)
+	}
+	return notImplemented(req)
+}
+
+func notImplemented(req *http.Request) error {
+	return newEmulatorError(http.StatusNotImplemented, "NotImplemented", "%s %s is not supported by the emulator", req.Method, req.URL.RequestURI())
+}
+
+// splitBucketPath splits a path-style path into bucket name and key.
+func splitBucketPath(p string) (string, string) {
+	parts := strings.SplitN(strings.TrimPrefix(p, "/"), "/", 2)
+	if len(parts) < 2 {
+		return parts[0], ""
+	}
+	return parts[0], parts[1]
+}
+
+// bucket returns the store of an existing bucket.
+func (em *Emulator) bucket(name string) (*FileStore, error) {
+	if !bucketNamePattern.MatchString(name) {
+		return nil, newEmulatorError(http.StatusBadRequest, "InvalidBucketName", "the specified bucket %s is not valid", name)
+	}
+	p := filepath.Join(em.Root, name)
+	fi, err := os.Stat(p)
+	if err != nil || !fi.IsDir() {
+		return nil, newEmulatorError(http.StatusNotFound, "NoSuchBucket", "the specified bucket %s does not exist", name)
+	}
+	return NewFileStore(p), nil
+}
+
+/*
+ * https://docs.aws.amazon.com/AmazonS3/latest/API/sig-v4-header-based-auth.html
+ *
+ * The request is canonicalized like by signAwsV4, the payload is verified
+ * while it is read.
+ */
+func (em *Emulator) verify(req *http.Request) error {
+	if em.AccessKeyId == "" {
+		return nil
+	}
+	query := req.URL.Query()
+	if query.Get("X-Amz-Algorithm") != "" {
+		return em.verifyPresigned(req, query)
+	}
+	auth := req.Header.Get("Authorization")
+	if auth == "" {
+		return newEmulatorError(http.StatusForbidden, "AccessDenied", "anonymous access is not allowed")
+	}
+	if !strings.HasPrefix(auth, awsV4Algorithm+" ") {
+		return newEmulatorError(http.StatusBadRequest, "InvalidArgument", "only %s authorization is supported", awsV4Algorithm)
+	}
+	fields := make(map[string]string)
+	for _, f := range strings.Split(strings.TrimPrefix(auth, awsV4Algorithm+" "), ",") {
+		kv := strings.SplitN(strings.TrimSpace(f), "=", 2)
+		if len(kv) == 2 {
+			fields[kv[0]] = kv[1]
+		}
+	}
+	now, err := time.Parse(awsV4TimeFormat, req.Header.Get("X-Amz-Date"))
+	if err != nil {
+		return newEmulatorError(http.StatusForbidden, "AccessDenied", "the x-amz-date header is missing or invalid")
+	}
+	if skew := time.Since(now); skew > maxClockSkew || skew < -maxClockSkew {
+		return newEmulatorError(http.StatusForbidden, "RequestTimeTooSkewed", "the difference between the request time and the server's time is too large")
+	}
+	scope, region, err := em.scope(fields["Credential"], now)
+	if err != nil {
+		return err
+	}
+	contentHash := req.Header.Get("X-Amz-Content-Sha256")
+	if contentHash == "" {
+		return newEmulatorError(http.StatusBadRequest, "InvalidRequest", "the x-amz-content-sha256 header is missing")
+	}
+	signature := em.signature(req, query, fields["SignedHeaders"], contentHash, now, scope, region)
+	if !hmac.Equal([]byte(signature), []byte(fields["Signature"])) {
+		return newEmulatorError(http.StatusForbidden, "SignatureDoesNotMatch", "the request signature does not match the signature calculated with the secret key")
+	}
+
+	switch {
+	case contentHash == unsignedPayload:
+		contentHash = ""
+	case strings.HasPrefix(contentHash, "STREAMING-"):
+		return newEmulatorError(http.StatusNotImplemented, "NotImplemented", "chunked payloads are not supported by the emulator")
+	}
+	if req.Body != nil && req.Body != http.NoBody {
+		req.Body = &digestReader{
+			r:            req.Body,
+			sha256:       sha256.New(),
+			md5:          md5.New(),
+			expectSha256: contentHash,
+			expectMD5:    req.Header.Get("Content-MD5"),
+		}
+	}
+	return nil
+}
+
+// https://docs.aws.amazon.com/AmazonS3/latest/API/sigv4-query-string-auth.html
+//
+// The payload of presigned requests is not signed.
+func (em *Emulator) verifyPresigned(req *http.Request, query url.Values) error {
+	if query.Get("X-Amz-Algorithm") != awsV4Algorithm {
+		return newEmulatorError(http.StatusBadRequest, "InvalidArgument", "only %s authorization is supported", awsV4Algorithm)
+	}
+	now, err := time.Parse(awsV4TimeFormat, query.Get("X-Amz-Date"))
+	if err != nil {
+		return newEmulatorError(http.StatusBadRequest, "AuthorizationQueryParametersError", "X-Amz-Date is missing or invalid")
+	}
+	expires, err := strconv.ParseInt(query.Get("X-Amz-Expires"), 10, 64)
+	if err != nil || expires < 1 || time.Duration(expires)*time.Second > MaxPresignExpiry {
+		return newEmulatorError(http.StatusBadRequest, "AuthorizationQueryParametersError", "X-Amz-Expires must be between 1 and %d seconds", int64(MaxPresignExpiry/time.Second))
+	}
+	if time.Since(now) > time.Duration(expires)*time.Second {
+		return newEmulatorError(http.StatusForbidden, "AccessDenied", "request has expired")
+	}
+	if time.Until(now) > maxClockSkew {
+		return newEmulatorError(http.StatusForbidden, "RequestTimeTooSkewed", "the difference between the request time and the server's time is too large")
+	}
+	scope, region, err := em.scope(query.Get("X-Amz-Credential"), now)
+	if err != nil {
+		return err
+	}
+	signed := url.Values{}
+	for k, v := range query {
+		if k != "X-Amz-Signature" {
+			signed[k] = v
+		}
+	}
+	signature := em.signature(req, signed, query.Get("X-Amz-SignedHeaders"), unsignedPayload, now, scope, region)
+	if !hmac.Equal([]byte(signature), []byte(query.Get("X-Amz-Signature"))) {
+		return newEmulatorError(http.StatusForbidden, "SignatureDoesNotMatch", "the request signature does not match the signature calculated with the secret key")
+	}
+	return nil
+}
+
+// scope checks the credential of a signature made at the given time, i.e.
+// AK/20060102/us-east-1/s3/aws4_request, and returns its scope and region.
+func (em *Emulator) scope(credential string, now time.Time) (string, string, error) {
+	parts := strings.Split(credential, "/")
+	if len(parts) != 5 || parts[3] != "s3" || parts[4] != "aws4_request" {
+		return "", "", newEmulatorError(http.StatusBadRequest, "AuthorizationHeaderMalformed", "the credential %s is malformed", credential)
+	}
+	if parts[0] != em.AccessKeyId {
+		return "", "", newEmulatorError(http.StatusForbidden, "InvalidAccessKeyId", "the access key id %s does not exist", parts[0])
+	}
+	if em.Region != "" && parts[2] != em.Region {
+		return "", "", newEmulatorError(http.StatusBadRequest, "AuthorizationHeaderMalformed", "the region %s is wrong; expecting %s", parts[2], em.Region)
+	}
+	if now.Format(awsV4DateFormat) != parts[1] {
+		return "", "", newEmulatorError(http.StatusForbidden, "AccessDenied", "the request date does not match the credential scope")
+	}
+	return strings.Join(parts[1:], "/"), parts[2], nil
+}
+
+// signature signs the request like the client is expected to have done.
+func (em *Emulator) signature(req *http.Request, query url.Values, signedHeaders string, contentHash string, now time.Time, scope string, region string) string {
+	header := make(map[string]string)
+	for _, name := range strings.Split(signedHeaders, ";") {
+		if name == "host" {
+			header[name] = req.Host
+		} else if name != "" {
+			header[name] = strings.TrimSpace(req.Header.Get(name))
+		}
+	}
+	canonical, _ := canonicalRequest(req.Method, req.URL.Path, query, header, contentHash)
+	return signAwsV4Content(signingKey(em.SecretKey, now, region), now, scope, canonical)
+}
+
+// digestReader fails at the end of the payload if it does not match the
+// checksums announced by the client.
+type digestReader struct {
+	r            io.ReadCloser
+	sha256       hash.Hash
+	md5          hash.Hash
+	expectSha256 string
+	expectMD5    string
+}
+
+func (dr *digestReader) Read(b []byte) (int, error) {
+	n, err := dr.r.Read(b)
+	dr.sha256.Write(b[:n])
+	dr.md5.Write(b[:n])
+	if err != io.EOF {
+		return n, err
+	}
+	if dr.expectSha256 != "" && hex.EncodeToString(dr.sha256.Sum(nil)) != dr.expectSha256 {
+		return n, newEmulatorError(http.StatusBadRequest, "XAmzContentSHA256Mismatch", "the provided x-amz-content-sha256 header does not match what was computed")
+	}
+	if dr.expectMD5 != "" && base64.StdEncoding.EncodeToString(dr.md5.Sum(nil)) != dr.expectMD5 {
+		return n, newEmulatorError(http.StatusBadRequest, "BadDigest", "the Content-MD5 you specified did not match what was received")
+	}
+	return n, err
+}
+
+func (dr *digestReader) Close() error {
+	return dr.r.Close()
+}
+
+// https://docs.aws.amazon.com/AmazonS3/latest/API/API_ListObjectsV2.html
+//
+// The continuation token is the last key or common prefix of the previous
+// page.
+func (em *Emulator) listObjects(w http.ResponseWriter, req *http.Request, bucket string, store *FileStore) error {
+	query := req.URL.Query()
+	prefix := query.Get("prefix")
+	delimiter := query.Get("delimiter")
+	maxKeys := defaultFetchSize
+	if s := query.Get("max-keys"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 {
+			return newEmulatorError(http.StatusBadRequest, "InvalidArgument", "invalid max-keys %s", s)
+		}
+		if n < maxKeys {
+			maxKeys = n
+		}
+	}
+	token := query.Get("continuation-token")
+	marker := query.Get("start-after")
+	if token != "" {
+		marker = token
+	}
+	// all keys of a common prefix have been listed with it
+	skipPrefix := token != "" && delimiter != "" && len(token) > len(prefix) && strings.HasSuffix(token, delimiter)
+
+	items, err := store.items(req.Context(), prefix)
+	if err != nil {
+		return err
+	}
+	rlt := S3ListBucketResult{
+		Name:              bucket,
+		Prefix:            prefix,
+		Delimiter:         delimiter,
+		MaxKeys:           maxKeys,
+		ContinuationToken: token,
+		StartAfter:        query.Get("start-after"),
+	}
+	last := ""
+	for _, item := range items {
+		if item.Key <= marker || (skipPrefix && strings.HasPrefix(item.Key, marker)) {
+			continue
+		}
+		commonPrefix := ""
+		if delimiter != "" {
+			if i := strings.Index(item.Key[len(prefix):], delimiter); i >= 0 {
+				commonPrefix = item.Key[:len(prefix)+i+len(delimiter)]
+			}
+		}
+		if commonPrefix != "" && commonPrefix == last {
+			continue
+		}
+		if rlt.KeyCount == maxKeys {
+			rlt.IsTruncated = true
+			break
+		}
+		rlt.KeyCount++
+		if commonPrefix != "" {
+			rlt.CommonPrefixes = append(rlt.CommonPrefixes, S3CommonPrefix{Prefix: commonPrefix})
+			last = commonPrefix
+		} else {
+			rlt.Contents = append(rlt.Contents, item)
+			last = item.Key
+		}
+	}
+	if rlt.IsTruncated {
+		rlt.NextContinuationToken = last
+	}
+	return writeXML(w, http.StatusOK, emulatorListResult{S3ListBucketResult: rlt})
+}
+
+// https://docs.aws.amazon.com/AmazonS3/latest/API/API_GetObject.html
+func (em *Emulator) getObject(w http.ResponseWriter, req *http.Request, store *FileStore, key string) error {
+	ctx := req.Context()
+	obj, err := store.Head(ctx, key)
+	if err != nil {
+		return err
+	}
+	status := http.StatusOK
+	byteRange := req.Header.Get("Range")
+	if byteRange != "" {
+		if _, _, err := parseByteRange(byteRange, obj.Size); err != nil {
+			return newEmulatorError(http.StatusRequestedRangeNotSatisfiable, "InvalidRange", "%v", err)
+		}
+		status = http.StatusPartialContent
+	}
+	options, err := store.putOptions(key)
+	if err != nil {
+		return err
+	}
+	obj, err = store.Get(ctx, key, byteRange)
+	if err != nil {
+		return err
+	}
+	defer obj.Body.Close()
+
+	h := w.Header()
+	for k, v := range options.header() {
+		h.Set(k, v)
+	}
+	h.Del("X-Amz-Acl")
+	h.Del("X-Amz-Tagging")
+	if len(options.Tags) > 0 {
+		h.Set("X-Amz-Tagging-Count", strconv.Itoa(len(options.Tags)))
+	}
+	h.Set("Content-Type", obj.ContentType)
+	h.Set("Content-Length", strconv.FormatInt(obj.Size, 10))
+	h.Set("Last-Modified", obj.LastModified.Format(http.TimeFormat))
+	h.Set("Accept-Ranges", "bytes")
+	if obj.ETag != "" {
+		h.Set("ETag", obj.ETag)
+	}
+	if obj.ContentRange != "" {
+		h.Set("Content-Range", obj.ContentRange)
+	}
+	// i.e. set by presigned URLs
+	for param, name := range responseOverrides {
+		if v := req.URL.Query().Get(param); v != "" {
+			h.Set(name, v)
+		}
+	}
+	w.WriteHeader(status)
+	if req.Method == "HEAD" {
+		return nil
+	}
+	_, err = io.Copy(w, obj.Body)
+	return err
+}
+
+// https://docs.aws.amazon.com/AmazonS3/latest/API/API_PutObject.html
+func (em *Emulator) putObject(w http.ResponseWriter, req *http.Request, store *FileStore, key string) error {
+	err := store.Put(req.Context(), key, req.Body, req.ContentLength, putOptionsOf(req.Header))
+	if err != nil {
+		return err
+	}
+	obj, err := store.Head(req.Context(), key)
+	if err != nil {
+		return err
+	}
+	w.Header().Set("ETag", obj.ETag)
+	w.WriteHeader(http.StatusOK)
+	return nil
+}
+
+// putOptionsOf takes the options of an object from the header of the
+// request storing it, i.e. the inverse of S3PutOptions.header.
+func putOptionsOf(header http.Header) S3PutOptions {
+	options := S3PutOptions{
+		ContentType:        header.Get("Content-Type"),
+		CacheControl:       header.Get("Cache-Control"),
+		ContentEncoding:    header.Get("Content-Encoding"),
+		ContentDisposition: header.Get("Content-Disposition"),
+		StorageClass:       header.Get("X-Amz-Storage-Class"),
+		Acl:                header.Get("X-Amz-Acl"),
+		Metadata:           make(map[string]string),
+	}
+	// the default of S3 instead of sniffing the content
+	if options.ContentType == "" {
+		options.ContentType = "binary/octet-stream"
+	}
+	for k := range header {
+		kl := strings.ToLower(k)
+		if strings.HasPrefix(kl, "x-amz-meta-") {
+			options.Metadata[strings.TrimPrefix(kl, "x-amz-meta-")] = header.Get(k)
+		}
+	}
+	if tagging := header.Get("X-Amz-Tagging"); tagging != "" {
+		options.Tags, _ = decodeTags(tagging)
+	}
+	return options
+}
+
+// https://docs.aws.amazon.com/AmazonS3/latest/API/API_CopyObject.html
+func (em *Emulator) copyObject(w http.ResponseWriter, req *http.Request, store *FileStore, key string) error {
+	source := req.Header.Get("X-Amz-Copy-Source")
+	if i := strings.Index(source, "?"); i >= 0 {
+		return newEmulatorError(http.StatusNotImplemented, "NotImplemented", "copying versions is not supported by the emulator")
+	}
+	source, err := url.PathUnescape(source)
+	if err != nil {
+		return newEmulatorError(http.StatusBadRequest, "InvalidArgument", "invalid copy source %s", source)
+	}
+	sourceBucket, sourceKey := splitBucketPath(source)
+	sourceStore, err := em.bucket(sourceBucket)
+	if err != nil {
+		return err
+	}
+	obj, err := sourceStore.Get(req.Context(), sourceKey, "")
+	if err != nil {
+		return err
+	}
+	defer obj.Body.Close()
+	options, err := sourceStore.putOptions(sourceKey)
+	if err != nil {
+		return err
+	}
+	tags := options.Tags
+	if strings.EqualFold(req.Header.Get("X-Amz-Metadata-Directive"), "REPLACE") {
+		options = putOptionsOf(req.Header)
+	}
+	options.Tags = tags
+	if strings.EqualFold(req.Header.Get("X-Amz-Tagging-Directive"), "REPLACE") {
+		options.Tags = putOptionsOf(req.Header).Tags
+	}
+	p, err := store.path(key)
+	if err != nil {
+		return err
+	}
+	err = store.write(req.Context(), p, obj.Body, options, "")
+	if err != nil {
+		return err
+	}
+	obj, err = store.Head(req.Context(), key)
+	if err != nil {
+		return err
+	}
+	return writeXML(w, http.StatusOK, emulatorCopyResult{ETag: obj.ETag, LastModified: obj.LastModified})
+}
+
+// https://docs.aws.amazon.com/AmazonS3/latest/API/API_DeleteObjects.html
+func (em *Emulator) deleteObjects(w http.ResponseWriter, req *http.Request, store *FileStore) error {
+	body, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		return err
+	}
+	var del emulatorDelete
+	if xml.Unmarshal(body, &del) != nil || len(del.Objects) == 0 || len(del.Objects) > maxDeleteKeys {
+		return newEmulatorError(http.StatusBadRequest, "MalformedXML", "the XML you provided was not well-formed or did not validate against the published schema")
+	}
+	var rlt S3DeleteResult
+	for _, obj := range del.Objects {
+		if obj.VersionId != "" && obj.VersionId != nullVersionId {
+			rlt.Error = append(rlt.Error, S3Deleted{Key: obj.Key, VersionId: obj.VersionId, Code: "NoSuchVersion", Message: "the specified version does not exist"})
+			continue
+		}
+		err := store.remove(obj.Key)
+		if err != nil {
+			rlt.Error = append(rlt.Error, S3Deleted{Key: obj.Key, VersionId: obj.VersionId, Code: "InternalError", Message: err.Error()})
+		} else if !del.Quiet {
+			rlt.Deleted = append(rlt.Deleted, S3Deleted{Key: obj.Key, VersionId: obj.VersionId})
+		}
+	}
+	return writeXML(w, http.StatusOK, emulatorDeleteResult{S3DeleteResult: rlt})
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
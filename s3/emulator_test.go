@@ -0,0 +1,301 @@
+package s3
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// emulatedBucket serves the bucket bkt by an emulator requiring signed
+// requests and returns a client of it.
+func emulatedBucket(t *testing.T) (S3Bucket, *Emulator) {
+	t.Helper()
+	em := NewEmulator(t.TempDir())
+	em.AccessKeyId = "AK"
+	em.SecretKey = "SK"
+	if err := os.Mkdir(filepath.Join(em.Root, "bkt"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(em)
+	t.Cleanup(srv.Close)
+	return S3Bucket{
+		Name:        "bkt",
+		Endpoint:    srv.URL + "/bkt",
+		AccessKeyId: "AK",
+		SecretKey:   "SK",
+		Region:      "us-east-1",
+	}, em
+}
+
+// listDelimited lists the bucket with the delimiter / in pages of maxKeys,
+// the client does not support delimiters, hence the requests are forwarded.
+func listDelimited(t *testing.T, bucket S3Bucket, prefix string, maxKeys string) []S3ListBucketResult {
+	t.Helper()
+	var pages []S3ListBucketResult
+	token := ""
+	for {
+		query := url.Values{"list-type": {"2"}, "prefix": {prefix}, "delimiter": {"/"}, "max-keys": {maxKeys}}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+		resp, err := bucket.Forward(context.Background(), "GET", "", query, nil, nil, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("listing failed with %d: %s", resp.StatusCode, body)
+		}
+		var page S3ListBucketResult
+		if err := xml.Unmarshal(body, &page); err != nil {
+			t.Fatal(err)
+		}
+		pages = append(pages, page)
+		if !page.IsTruncated {
+			return pages
+		}
+		token = page.NextContinuationToken
+	}
+}
+
+func TestEmulatorObjects(t *testing.T) {
+	bucket, _ := emulatedBucket(t)
+	ctx := context.Background()
+	put(t, bucket, "dir/a.txt", "a", S3PutOptions{Metadata: map[string]string{"origin": "test"}})
+
+	obj, content := get(t, bucket, "dir/a.txt", "")
+	if content != "a" || obj.ContentType != "text/plain; charset=utf-8" || obj.Metadata["origin"] != "test" {
+		t.Errorf("got %q of type %s with metadata %v", content, obj.ContentType, obj.Metadata)
+	}
+	head, err := bucket.Head(ctx, "dir/a.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if head.Size != 1 || head.ETag != obj.ETag {
+		t.Errorf("head returned %d bytes with ETag %s, expected 1 byte with ETag %s", head.Size, head.ETag, obj.ETag)
+	}
+	if _, content := get(t, bucket, "dir/a.txt", "bytes=0-0"); content != "a" {
+		t.Errorf("range returned %q", content)
+	}
+
+	err = bucket.Copy(ctx, "dir/a.txt", "copy/a.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	copied, content := get(t, bucket, "copy/a.txt", "")
+	if content != "a" || copied.ETag != obj.ETag || copied.Metadata["origin"] != "test" {
+		t.Errorf("copy has content %q, ETag %s and metadata %v", content, copied.ETag, copied.Metadata)
+	}
+
+	err = bucket.Delete(ctx, deleteResultVisitor(func(rlt *S3DeleteResult) error { return nil }), "dir/a.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = bucket.Head(ctx, "dir/a.txt")
+	if err == nil {
+		t.Error("deleted object is still there")
+	}
+	_, err = bucket.Get(ctx, "dir/a.txt", "")
+	if !hasErrorCode(err, "NoSuchKey") {
+		t.Errorf("getting a deleted object returned %v, expected NoSuchKey", err)
+	}
+}
+
+func TestEmulatorList(t *testing.T) {
+	bucket, _ := emulatedBucket(t)
+	keys := []string{"a/1", "a/2", "a/b/3", "a/c/4", "a/c/5", "a/d", "b/6", "c"}
+	for _, key := range keys {
+		put(t, bucket, key, key, S3PutOptions{})
+	}
+
+	visitor := &collectingVisitor{}
+	err := bucket.List(context.Background(), "", 3, visitor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(visitor.keys, keys) || len(visitor.pages) != 3 {
+		t.Errorf("listing is %v in %d pages, expected %v in 3 pages", visitor.keys, len(visitor.pages), keys)
+	}
+	first := &stoppingVisitor{stopAfter: 1}
+	err = bucket.List(context.Background(), "a/", 2, first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rest := &collectingVisitor{}
+	err = bucket.ListFrom(context.Background(), "a/", first.pages[0].NextContinuationToken, 2, rest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(append(first.keys, rest.keys...), keys[:6]) {
+		t.Errorf("continued listing is %v then %v, expected %v", first.keys, rest.keys, keys[:6])
+	}
+
+	// common prefixes count towards the keys of a page and are not repeated
+	var listed, prefixes []string
+	pages := listDelimited(t, bucket, "a/", "2")
+	for _, page := range pages {
+		for _, item := range page.Contents {
+			listed = append(listed, item.Key)
+		}
+		for _, prefix := range page.CommonPrefixes {
+			prefixes = append(prefixes, prefix.Prefix)
+		}
+	}
+	if !reflect.DeepEqual(listed, []string{"a/1", "a/2", "a/d"}) || !reflect.DeepEqual(prefixes, []string{"a/b/", "a/c/"}) || len(pages) != 3 {
+		t.Errorf("delimited listing is %v with prefixes %v in %d pages, expected [a/1 a/2 a/d] with prefixes [a/b/ a/c/] in 3 pages", listed, prefixes, len(pages))
+	}
+}
+
+func TestEmulatorDeleteObjects(t *testing.T) {
+	bucket, _ := emulatedBucket(t)
+	for _, key := range []string{"a", "b", "c"} {
+		put(t, bucket, key, key, S3PutOptions{})
+	}
+	var deleted []string
+	err := bucket.Delete(context.Background(), deleteResultVisitor(func(rlt *S3DeleteResult) error {
+		for _, d := range rlt.Deleted {
+			deleted = append(deleted, d.Key)
+		}
+		if len(rlt.Error) > 0 {
+			t.Errorf("deletion failed for %v", rlt.Error)
+		}
+		return nil
+	}), "a", "c", "missing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(deleted, []string{"a", "c", "missing"}) {
+		t.Errorf("deleted %v, expected [a c missing]", deleted)
+	}
+	visitor := &collectingVisitor{}
+	if err := bucket.List(context.Background(), "", 10, visitor); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(visitor.keys, []string{"b"}) {
+		t.Errorf("listing after deletion is %v, expected [b]", visitor.keys)
+	}
+}
+
+func TestEmulatorMultipartUpload(t *testing.T) {
+	bucket, _ := emulatedBucket(t)
+	bucket.PartSize = MinPartSize
+	ctx := context.Background()
+	content := make([]byte, 2*MinPartSize+MinPartSize/2)
+	rand.New(rand.NewSource(1)).Read(content)
+
+	err := bucket.Put(ctx, "large.bin", bytes.NewReader(content), int64(len(content)), S3PutOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	obj, got := get(t, bucket, "large.bin", "")
+	if got != string(content) {
+		t.Fatalf("got %d bytes differing from the %d bytes uploaded", len(got), len(content))
+	}
+	if !strings.HasSuffix(strings.Trim(obj.ETag, "\""), "-3") {
+		t.Errorf("ETag %s is not the one of 3 parts", obj.ETag)
+	}
+	ok, err := bucket.ETagMatches(bytes.NewReader(content), int64(len(content)), obj.ETag)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok {
+		t.Errorf("ETag %s does not match the content", obj.ETag)
+	}
+
+	// parts are only assembled if their ETags are the ones of the uploads
+	uploadId, err := bucket.createMultipartUpload(ctx, "other.bin", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	etag, err := bucket.uploadPart(ctx, "other.bin", uploadId, 1, content[:10])
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = bucket.completeMultipartUpload(ctx, "other.bin", uploadId, []S3CompletedPart{{PartNumber: 1, ETag: "\"0123456789abcdef0123456789abcdef\""}})
+	if !hasErrorCode(err, "InvalidPart") {
+		t.Errorf("completing with a wrong ETag returned %v, expected InvalidPart", err)
+	}
+	err = bucket.completeMultipartUpload(ctx, "other.bin", uploadId, []S3CompletedPart{{PartNumber: 1, ETag: etag}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, got := get(t, bucket, "other.bin", ""); got != string(content[:10]) {
+		t.Errorf("completed upload has content %q", got)
+	}
+}
+
+func TestEmulatorRejectsBadSignatures(t *testing.T) {
+	bucket, _ := emulatedBucket(t)
+	put(t, bucket, "a", "a", S3PutOptions{})
+
+	forged := bucket
+	forged.SecretKey = "WRONG"
+	_, err := forged.Get(context.Background(), "a", "")
+	if !hasErrorCode(err, "SignatureDoesNotMatch") {
+		t.Errorf("getting with a wrong secret key returned %v, expected SignatureDoesNotMatch", err)
+	}
+	err = forged.Put(context.Background(), "b", strings.NewReader("b"), 1, S3PutOptions{})
+	if !hasErrorCode(err, "SignatureDoesNotMatch") {
+		t.Errorf("putting with a wrong secret key returned %v, expected SignatureDoesNotMatch", err)
+	}
+	unknown := bucket
+	unknown.AccessKeyId = "OTHER"
+	err = unknown.List(context.Background(), "", 10, &collectingVisitor{})
+	if !hasErrorCode(err, "InvalidAccessKeyId") {
+		t.Errorf("listing with an unknown access key id returned %v, expected InvalidAccessKeyId", err)
+	}
+	if _, err := bucket.Head(context.Background(), "b"); err == nil {
+		t.Error("object put with a wrong signature exists")
+	}
+}
+
+func TestEmulatorUploadSizeHints(t *testing.T) {
+	bucket, _ := emulatedBucket(t)
+	bucket.PartSize = MinPartSize
+	ctx := context.Background()
+	large := make([]byte, MinPartSize+10)
+	rand.New(rand.NewSource(1)).Read(large)
+	tests := []struct {
+		name    string
+		content string
+		size    int64
+		parts   bool
+	}{
+		{"exact size", "0123456789", 10, false},
+		{"empty content", "", 0, false},
+		{"unknown size", "0123456789", -1, false},
+		{"size exceeded", "0123456789", 3, false},
+		{"size not reached", "0123456789", 20, false},
+		{"size exceeded beyond a part", string(large), 10, true},
+		{"unknown size beyond a part", string(large), -1, true},
+	}
+	for i, test := range tests {
+		key := strconv.Itoa(i)
+		err := bucket.Upload(ctx, key, strings.NewReader(test.content), test.size)
+		if err != nil {
+			t.Fatal(err)
+		}
+		obj, got := get(t, bucket, key, "")
+		if got != test.content {
+			t.Errorf("%s: uploaded %d bytes of %d", test.name, len(got), len(test.content))
+		}
+		if parts := strings.Contains(obj.ETag, "-"); parts != test.parts {
+			t.Errorf("%s: ETag %s denoting a multipart upload is %t, expected %t", test.name, obj.ETag, parts, test.parts)
+		}
+	}
+}
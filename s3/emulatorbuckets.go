@@ -0,0 +1,133 @@
+package s3
+
+import (
+	"encoding/xml"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+type emulatorBucketsResult struct {
+	XMLName xml.Name `xml:"http://s3.amazonaws.com/doc/2006-03-01/ ListAllMyBucketsResult"`
+	S3ListAllMyBucketsResult
+}
+
+// https://docs.aws.amazon.com/AmazonS3/latest/API/API_ListBuckets.html
+//
+// The buckets are the directories of the root, their creation date is the
+// time of their last modification.
+func (em *Emulator) listBuckets(w http.ResponseWriter) error {
+	entries, err := ioutil.ReadDir(em.Root)
+	if err != nil {
+		return err
+	}
+	var rlt S3ListAllMyBucketsResult
+	rlt.Owner = S3Owner{Id: em.AccessKeyId, DisplayName: em.AccessKeyId}
+	for _, fi := range entries {
+		if fi.IsDir() && bucketNamePattern.MatchString(fi.Name()) {
+			rlt.Buckets = append(rlt.Buckets, S3BucketInfo{Name: fi.Name(), CreationDate: fi.ModTime().UTC()})
+		}
+	}
+	sort.Slice(rlt.Buckets, func(i, j int) bool { return rlt.Buckets[i].Name < rlt.Buckets[j].Name })
+	return writeXML(w, http.StatusOK, emulatorBucketsResult{S3ListAllMyBucketsResult: rlt})
+}
+
+// https://docs.aws.amazon.com/AmazonS3/latest/API/API_CreateBucket.html
+//
+// The location constraint is accepted whatever its region.
+func (em *Emulator) createBucket(w http.ResponseWriter, req *http.Request, name string) error {
+	if !bucketNamePattern.MatchString(name) {
+		return newEmulatorError(http.StatusBadRequest, "InvalidBucketName", "the specified bucket %s is not valid", name)
+	}
+	if req.Header.Get("X-Amz-Bucket-Object-Lock-Enabled") == "true" {
+		return newEmulatorError(http.StatusNotImplemented, "NotImplemented", "object lock is not supported by the emulator")
+	}
+	var config s3CreateBucketConfiguration
+	b, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		return err
+	}
+	if len(b) > 0 && xml.Unmarshal(b, &config) != nil {
+		return newEmulatorError(http.StatusBadRequest, "MalformedXML", "the XML you provided was not well-formed")
+	}
+	err = os.Mkdir(filepath.Join(em.Root, name), 0755)
+	if os.IsExist(err) {
+		return newEmulatorError(http.StatusConflict, "BucketAlreadyOwnedByYou", "the bucket %s already exists", name)
+	}
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Location", "/"+name)
+	w.WriteHeader(http.StatusOK)
+	return nil
+}
+
+// https://docs.aws.amazon.com/AmazonS3/latest/API/API_DeleteBucket.html
+func (em *Emulator) deleteBucket(w http.ResponseWriter, req *http.Request, name string, store *FileStore) error {
+	items, err := store.items(req.Context(), "")
+	if err != nil {
+		return err
+	}
+	if len(items) > 0 {
+		return newEmulatorError(http.StatusConflict, "BucketNotEmpty", "the bucket %s is not empty", name)
+	}
+	// empty directories might be left behind by deleted objects
+	err = os.RemoveAll(filepath.Join(em.Root, name))
+	if err != nil {
+		return err
+	}
+	for _, p := range []string{em.lifecyclePath(name), em.policyPath(name), em.publicAccessBlockPath(name)} {
+		os.Remove(p)
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+// bucketConfiguration gets, puts or deletes a configuration of a bucket
+// stored as file, puts are checked by validate.
+func (em *Emulator) bucketConfiguration(w http.ResponseWriter, req *http.Request, p string, notFoundCode string, validate func(b []byte) error) error {
+	switch req.Method {
+	case "GET":
+		b, err := ioutil.ReadFile(p)
+		if os.IsNotExist(err) {
+			return newEmulatorError(http.StatusNotFound, notFoundCode, "the configuration does not exist")
+		}
+		if err != nil {
+			return err
+		}
+		if filepath.Ext(p) == ".json" {
+			w.Header().Set("Content-Type", "application/json")
+		} else {
+			w.Header().Set("Content-Type", "application/xml")
+		}
+		_, err = w.Write(b)
+		return err
+	case "PUT":
+		b, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			return err
+		}
+		err = validate(b)
+		if err != nil {
+			return err
+		}
+		err = os.MkdirAll(filepath.Dir(p), 0755)
+		if err == nil {
+			err = ioutil.WriteFile(p, b, 0644)
+		}
+		if err == nil {
+			w.WriteHeader(http.StatusOK)
+		}
+		return err
+	case "DELETE":
+		err := os.Remove(p)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+	return notImplemented(req)
+}
@@ -0,0 +1,30 @@
+package s3
+
+import (
+	"net/http"
+	"path/filepath"
+)
+
+// lifecycleDir holds the lifecycle configurations of the buckets of the
+// emulator, which does not apply them.
+const lifecycleDir = ".lifecycle"
+
+func (em *Emulator) lifecyclePath(bucket string) string {
+	return filepath.Join(em.Root, lifecycleDir, bucket+".xml")
+}
+
+// https://docs.aws.amazon.com/AmazonS3/latest/API/API_GetBucketLifecycleConfiguration.html
+// https://docs.aws.amazon.com/AmazonS3/latest/API/API_PutBucketLifecycleConfiguration.html
+// https://docs.aws.amazon.com/AmazonS3/latest/API/API_DeleteBucketLifecycle.html
+func (em *Emulator) bucketLifecycle(w http.ResponseWriter, req *http.Request, bucket string) error {
+	return em.bucketConfiguration(w, req, em.lifecyclePath(bucket), "NoSuchLifecycleConfiguration", func(b []byte) error {
+		config, err := ParseLifecycleXML(b)
+		if err != nil {
+			return newEmulatorError(http.StatusBadRequest, "MalformedXML", "the XML you provided was not well-formed")
+		}
+		if err := config.Validate(); err != nil {
+			return newEmulatorError(http.StatusBadRequest, "InvalidArgument", "%v", err)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,76 @@
+package s3
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestEmulatorLifecycle(t *testing.T) {
+	bucket, _ := emulatedBucket(t)
+	ctx := context.Background()
+
+	config, err := bucket.GetLifecycle(ctx)
+	if err != nil || len(config.Rules) != 0 {
+		t.Fatalf("lifecycle without configuration is %v (%v), expected no rules", config, err)
+	}
+	configured := S3LifecycleConfiguration{Rules: []S3LifecycleRule{{
+		ID:          "logs",
+		Status:      "Enabled",
+		Prefix:      "logs/",
+		Tags:        map[string]string{"tier": "cold"},
+		Transitions: []S3LifecycleTransition{{Days: 30, StorageClass: "GLACIER"}},
+		Expiration:  &S3LifecycleExpiration{Days: 365},
+	}}}
+	err = bucket.PutLifecycle(ctx, configured)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config, err = bucket.GetLifecycle(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(*config, configured) {
+		t.Errorf("lifecycle is %+v, expected %+v", *config, configured)
+	}
+
+	// the client validates configurations, hence invalid ones are forwarded
+	tests := []struct {
+		body string
+		code string
+	}{
+		{"<LifecycleConfiguration><Rule>", "MalformedXML"},
+		{`<LifecycleConfiguration xmlns="http://s3.amazonaws.com/doc/2006-03-01/"><Rule><Status>Enabled</Status><Filter><Prefix></Prefix></Filter></Rule></LifecycleConfiguration>`, "InvalidArgument"},
+	}
+	for _, test := range tests {
+		resp, err := bucket.Forward(ctx, "PUT", "", url.Values{"lifecycle": {""}}, nil, strings.NewReader(test.body), int64(len(test.body)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != http.StatusBadRequest || !strings.Contains(string(b), "<Code>"+test.code+"</Code>") {
+			t.Errorf("putting %s returned %d: %s, expected %s", test.body, resp.StatusCode, b, test.code)
+		}
+	}
+	config, err = bucket.GetLifecycle(ctx)
+	if err != nil || !reflect.DeepEqual(*config, configured) {
+		t.Errorf("lifecycle after invalid puts is %+v (%v), expected %+v", config, err, configured)
+	}
+
+	err = bucket.DeleteLifecycle(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config, err = bucket.GetLifecycle(ctx)
+	if err != nil || len(config.Rules) != 0 {
+		t.Errorf("deleted lifecycle is %v (%v), expected no rules", config, err)
+	}
+}
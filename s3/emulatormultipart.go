@@ -0,0 +1,196 @@
+package s3
+
+import (
+	"crypto/md5"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// emulatorUploads is the directory below the root of the emulator holding
+// the parts of uploads in progress, it is no valid bucket name.
+const emulatorUploads = ".uploads"
+
+// emulatorUpload is stored as upload.json next to the parts of an upload.
+type emulatorUpload struct {
+	Bucket  string
+	Key     string
+	Options S3PutOptions
+}
+
+type emulatorInitiateResult struct {
+	XMLName xml.Name `xml:"http://s3.amazonaws.com/doc/2006-03-01/ InitiateMultipartUploadResult"`
+	S3InitiateMultipartUploadResult
+}
+
+type emulatorCompleteResult struct {
+	XMLName  xml.Name `xml:"http://s3.amazonaws.com/doc/2006-03-01/ CompleteMultipartUploadResult"`
+	Location string   `xml:"Location"`
+	Bucket   string   `xml:"Bucket"`
+	Key      string   `xml:"Key"`
+	ETag     string   `xml:"ETag"`
+}
+
+// readUpload returns the directory and the description of an upload of key.
+func (em *Emulator) readUpload(bucket string, key string, uploadId string) (string, *emulatorUpload, error) {
+	noSuchUpload := newEmulatorError(http.StatusNotFound, "NoSuchUpload", "the specified upload does not exist")
+	// ids are hex strings, which keeps the paths below the root
+	if uploadId == "" || strings.Trim(uploadId, "0123456789abcdef") != "" {
+		return "", nil, noSuchUpload
+	}
+	dir := filepath.Join(em.Root, emulatorUploads, uploadId)
+	b, err := ioutil.ReadFile(filepath.Join(dir, "upload.json"))
+	if err != nil {
+		return "", nil, noSuchUpload
+	}
+	var upload emulatorUpload
+	err = json.Unmarshal(b, &upload)
+	if err != nil {
+		return "", nil, err
+	}
+	if upload.Bucket != bucket || upload.Key != key {
+		return "", nil, noSuchUpload
+	}
+	return dir, &upload, nil
+}
+
+// https://docs.aws.amazon.com/AmazonS3/latest/API/API_CreateMultipartUpload.html
+func (em *Emulator) createUpload(w http.ResponseWriter, req *http.Request, bucket string, store *FileStore, key string) error {
+	_, err := store.path(key)
+	if err != nil {
+		return err
+	}
+	uploadId := randomHex(16)
+	dir := filepath.Join(em.Root, emulatorUploads, uploadId)
+	b, err := json.Marshal(emulatorUpload{Bucket: bucket, Key: key, Options: putOptionsOf(req.Header)})
+	if err == nil {
+		err = os.MkdirAll(dir, 0755)
+	}
+	if err == nil {
+		err = ioutil.WriteFile(filepath.Join(dir, "upload.json"), b, 0644)
+	}
+	if err != nil {
+		return err
+	}
+	return writeXML(w, http.StatusOK, emulatorInitiateResult{S3InitiateMultipartUploadResult: S3InitiateMultipartUploadResult{
+		Bucket:   bucket,
+		Key:      key,
+		UploadId: uploadId,
+	}})
+}
+
+// https://docs.aws.amazon.com/AmazonS3/latest/API/API_UploadPart.html
+func (em *Emulator) uploadPart(w http.ResponseWriter, req *http.Request, bucket string, key string, uploadId string) error {
+	dir, _, err := em.readUpload(bucket, key, uploadId)
+	if err != nil {
+		return err
+	}
+	number, err := strconv.Atoi(req.URL.Query().Get("partNumber"))
+	if err != nil || number < 1 || number > MaxParts {
+		return newEmulatorError(http.StatusBadRequest, "InvalidArgument", "part number must be an integer between 1 and %d", MaxParts)
+	}
+	f, err := ioutil.TempFile(dir, "part-*"+tempSuffix)
+	if err != nil {
+		return err
+	}
+	hash := md5.New()
+	_, err = io.Copy(io.MultiWriter(f, hash), req.Body)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), filepath.Join(dir, strconv.Itoa(number)))
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	w.Header().Set("ETag", fmt.Sprintf("\"%x\"", hash.Sum(nil)))
+	w.WriteHeader(http.StatusOK)
+	return nil
+}
+
+// https://docs.aws.amazon.com/AmazonS3/latest/API/API_CompleteMultipartUpload.html
+//
+// The ETag of the object is computed like by S3, see ComputeETag.
+func (em *Emulator) completeUpload(w http.ResponseWriter, req *http.Request, bucket string, store *FileStore, key string, uploadId string) error {
+	dir, upload, err := em.readUpload(bucket, key, uploadId)
+	if err != nil {
+		return err
+	}
+	body, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		return err
+	}
+	var complete S3CompleteMultipartUpload
+	if xml.Unmarshal(body, &complete) != nil || len(complete.Parts) == 0 {
+		return newEmulatorError(http.StatusBadRequest, "MalformedXML", "the XML you provided was not well-formed or did not validate against the published schema")
+	}
+
+	readers := make([]io.Reader, 0, len(complete.Parts))
+	sums := md5.New()
+	for i, part := range complete.Parts {
+		if i > 0 && part.PartNumber <= complete.Parts[i-1].PartNumber {
+			return newEmulatorError(http.StatusBadRequest, "InvalidPartOrder", "the list of parts was not in ascending order")
+		}
+		f, err := os.Open(filepath.Join(dir, strconv.Itoa(part.PartNumber)))
+		if err != nil {
+			return newEmulatorError(http.StatusBadRequest, "InvalidPart", "part %d has not been uploaded", part.PartNumber)
+		}
+		defer f.Close()
+		hash := md5.New()
+		size, err := io.Copy(hash, f)
+		if err == nil {
+			_, err = f.Seek(0, io.SeekStart)
+		}
+		if err != nil {
+			return err
+		}
+		if i < len(complete.Parts)-1 && size < MinPartSize {
+			return newEmulatorError(http.StatusBadRequest, "EntityTooSmall", "part %d is smaller than the minimum allowed size", part.PartNumber)
+		}
+		if strings.Trim(part.ETag, "\"") != fmt.Sprintf("%x", hash.Sum(nil)) {
+			return newEmulatorError(http.StatusBadRequest, "InvalidPart", "the ETag of part %d does not match", part.PartNumber)
+		}
+		sums.Write(hash.Sum(nil))
+		readers = append(readers, f)
+	}
+	etag := fmt.Sprintf("\"%x-%d\"", sums.Sum(nil), len(complete.Parts))
+
+	p, err := store.path(key)
+	if err != nil {
+		return err
+	}
+	err = store.write(req.Context(), p, io.MultiReader(readers...), upload.Options, etag)
+	if err != nil {
+		return err
+	}
+	os.RemoveAll(dir)
+	return writeXML(w, http.StatusOK, emulatorCompleteResult{
+		Location: "/" + bucket + "/" + key,
+		Bucket:   bucket,
+		Key:      key,
+		ETag:     etag,
+	})
+}
+
+// https://docs.aws.amazon.com/AmazonS3/latest/API/API_AbortMultipartUpload.html
+func (em *Emulator) abortUpload(w http.ResponseWriter, bucket string, key string, uploadId string) error {
+	dir, _, err := em.readUpload(bucket, key, uploadId)
+	if err != nil {
+		return err
+	}
+	err = os.RemoveAll(dir)
+	if err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
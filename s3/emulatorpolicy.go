@@ -0,0 +1,81 @@
+package s3
+
+import (
+	"encoding/xml"
+	"net/http"
+	"path/filepath"
+)
+
+// policyDir and publicAccessBlockDir hold the policies and the public
+// access blocks of the buckets of the emulator, which does not apply them.
+const (
+	policyDir            = ".policy"
+	publicAccessBlockDir = ".publicaccessblock"
+)
+
+func (em *Emulator) policyPath(bucket string) string {
+	return filepath.Join(em.Root, policyDir, bucket+".json")
+}
+
+func (em *Emulator) publicAccessBlockPath(bucket string) string {
+	return filepath.Join(em.Root, publicAccessBlockDir, bucket+".xml")
+}
+
+// https://docs.aws.amazon.com/AmazonS3/latest/API/API_GetBucketPolicy.html
+// https://docs.aws.amazon.com/AmazonS3/latest/API/API_PutBucketPolicy.html
+// https://docs.aws.amazon.com/AmazonS3/latest/API/API_DeleteBucketPolicy.html
+func (em *Emulator) bucketPolicy(w http.ResponseWriter, req *http.Request, bucket string) error {
+	return em.bucketConfiguration(w, req, em.policyPath(bucket), "NoSuchBucketPolicy", func(b []byte) error {
+		if _, err := ParsePolicy(b); err != nil {
+			return newEmulatorError(http.StatusBadRequest, "MalformedPolicy", "%v", err)
+		}
+		return nil
+	})
+}
+
+// https://docs.aws.amazon.com/AmazonS3/latest/API/API_GetPublicAccessBlock.html
+// https://docs.aws.amazon.com/AmazonS3/latest/API/API_PutPublicAccessBlock.html
+// https://docs.aws.amazon.com/AmazonS3/latest/API/API_DeletePublicAccessBlock.html
+func (em *Emulator) bucketPublicAccessBlock(w http.ResponseWriter, req *http.Request, bucket string) error {
+	return em.bucketConfiguration(w, req, em.publicAccessBlockPath(bucket), "NoSuchPublicAccessBlockConfiguration", func(b []byte) error {
+		var config S3PublicAccessBlock
+		if xml.Unmarshal(b, &config) != nil {
+			return newEmulatorError(http.StatusBadRequest, "MalformedXML", "the XML you provided was not well-formed")
+		}
+		return nil
+	})
+}
+
+type emulatorAccessControlPolicy struct {
+	XMLName xml.Name `xml:"http://s3.amazonaws.com/doc/2006-03-01/ AccessControlPolicy"`
+	S3AccessControlPolicy
+}
+
+// https://docs.aws.amazon.com/AmazonS3/latest/API/API_GetBucketAcl.html
+// https://docs.aws.amazon.com/AmazonS3/latest/API/API_PutBucketAcl.html
+// https://docs.aws.amazon.com/AmazonS3/latest/API/API_GetObjectAcl.html
+// https://docs.aws.amazon.com/AmazonS3/latest/API/API_PutObjectAcl.html
+//
+// Buckets and objects are private, only the private canned ACL is accepted.
+func (em *Emulator) acl(w http.ResponseWriter, req *http.Request, store *FileStore, key string) error {
+	if key != "" {
+		_, err := store.Head(req.Context(), key)
+		if err != nil {
+			return err
+		}
+	}
+	switch {
+	case req.Method == "GET":
+		owner := S3Owner{Id: em.AccessKeyId, DisplayName: em.AccessKeyId}
+		var rlt emulatorAccessControlPolicy
+		rlt.Owner = owner
+		rlt.Grants = []S3Grant{{Grantee: S3Grantee{Type: "CanonicalUser", Id: owner.Id, DisplayName: owner.DisplayName}, Permission: PermissionFullControl}}
+		return writeXML(w, http.StatusOK, rlt)
+	case req.Method == "PUT" && req.Header.Get("X-Amz-Acl") == "private":
+		w.WriteHeader(http.StatusOK)
+		return nil
+	case req.Method == "PUT":
+		return newEmulatorError(http.StatusNotImplemented, "NotImplemented", "only the private ACL is supported by the emulator")
+	}
+	return notImplemented(req)
+}
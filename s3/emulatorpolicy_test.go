@@ -0,0 +1,146 @@
+package s3
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+const denyDeletesPolicy = `{"Version":"2012-10-17","Statement":[{"Effect":"Deny","Principal":"*","Action":"s3:DeleteObject","Resource":"arn:aws:s3:::bkt/*"}]}`
+
+func TestEmulatorPolicy(t *testing.T) {
+	bucket, _ := emulatedBucket(t)
+	ctx := context.Background()
+
+	policy, err := bucket.GetPolicy(ctx)
+	if err != nil || policy != nil {
+		t.Fatalf("policy without configuration is %s (%v), expected none", policy, err)
+	}
+	err = bucket.PutPolicy(ctx, []byte(denyDeletesPolicy))
+	if err != nil {
+		t.Fatal(err)
+	}
+	policy, err = bucket.GetPolicy(ctx)
+	if err != nil || string(policy) != denyDeletesPolicy {
+		t.Errorf("policy is %s (%v), expected %s", policy, err, denyDeletesPolicy)
+	}
+
+	// the client checks policies, hence an invalid one is forwarded
+	body := `{"Version":"2012-10-17","Statement":[{"Effect":"Maybe"}]}`
+	resp, err := bucket.Forward(ctx, "PUT", "", url.Values{"policy": {""}}, nil, strings.NewReader(body), int64(len(body)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusBadRequest || !strings.Contains(string(b), "<Code>MalformedPolicy</Code>") {
+		t.Errorf("putting an invalid policy returned %d: %s, expected MalformedPolicy", resp.StatusCode, b)
+	}
+
+	err = bucket.DeletePolicy(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	policy, err = bucket.GetPolicy(ctx)
+	if err != nil || policy != nil {
+		t.Errorf("deleted policy is %s (%v), expected none", policy, err)
+	}
+}
+
+func TestEmulatorPublicAccessBlock(t *testing.T) {
+	bucket, _ := emulatedBucket(t)
+	ctx := context.Background()
+
+	err := bucket.PutPublicAccessBlock(ctx, S3PublicAccessBlock{BlockPublicAcls: true, RestrictPublicBuckets: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, err := bucket.GetPublicAccessBlock(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !block.BlockPublicAcls || block.IgnorePublicAcls || block.BlockPublicPolicy || !block.RestrictPublicBuckets {
+		t.Errorf("public access block is %+v, expected BlockPublicAcls and RestrictPublicBuckets", block)
+	}
+	err = bucket.DeletePublicAccessBlock(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, err = bucket.GetPublicAccessBlock(ctx)
+	if err != nil || *block != (S3PublicAccessBlock{}) {
+		t.Errorf("deleted public access block is %+v (%v), expected none", block, err)
+	}
+}
+
+func TestEmulatorAcl(t *testing.T) {
+	bucket, em := emulatedBucket(t)
+	ctx := context.Background()
+	put(t, bucket, "a", "a", S3PutOptions{})
+
+	for _, key := range []string{"", "a"} {
+		acl, err := bucket.getAcl(ctx, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if acl.Owner.Id != em.AccessKeyId || len(acl.Grants) != 1 || acl.Grants[0].Grantee.Id != em.AccessKeyId || acl.Grants[0].Permission != PermissionFullControl {
+			t.Errorf("ACL of '%s' is %+v, expected full control of the owner", key, acl)
+		}
+	}
+	if err := bucket.PutBucketAcl(ctx, "private", nil); err != nil {
+		t.Error(err)
+	}
+	if err := bucket.PutObjectAcl(ctx, "a", "private", nil); err != nil {
+		t.Error(err)
+	}
+	err := bucket.PutObjectAcl(ctx, "a", "public-read", nil)
+	if !hasErrorCode(err, "NotImplemented") {
+		t.Errorf("putting a public ACL returned %v, expected NotImplemented", err)
+	}
+	_, err = bucket.GetObjectAcl(ctx, "missing")
+	if !hasErrorCode(err, "NoSuchKey") {
+		t.Errorf("getting the ACL of a missing object returned %v, expected NoSuchKey", err)
+	}
+}
+
+func TestEmulatorRemovesConfigurationsWithBuckets(t *testing.T) {
+	bucket, _ := emulatedBucket(t)
+	ctx := context.Background()
+	err := bucket.PutLifecycle(ctx, S3LifecycleConfiguration{Rules: []S3LifecycleRule{{Status: "Enabled", Expiration: &S3LifecycleExpiration{Days: 1}}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = bucket.PutPublicAccessBlock(ctx, S3PublicAccessBlock{BlockPublicAcls: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = bucket.PutPolicy(ctx, []byte(denyDeletesPolicy))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := bucket.Remove(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := bucket.Create(ctx, S3CreateBucketOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	// buckets created with the name of removed ones start without configurations
+	config, err := bucket.GetLifecycle(ctx)
+	if err != nil || len(config.Rules) != 0 {
+		t.Errorf("lifecycle of the new bucket is %v (%v), expected no rules", config, err)
+	}
+	policy, err := bucket.GetPolicy(ctx)
+	if err != nil || policy != nil {
+		t.Errorf("policy of the new bucket is %s (%v), expected none", policy, err)
+	}
+	block, err := bucket.GetPublicAccessBlock(ctx)
+	if err != nil || *block != (S3PublicAccessBlock{}) {
+		t.Errorf("public access block of the new bucket is %+v (%v), expected none", block, err)
+	}
+}
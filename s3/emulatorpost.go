@@ -0,0 +1,223 @@
+package s3
+
+import (
+	"crypto/hmac"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// maxPostFieldSize bounds the fields of POST forms besides the file.
+const maxPostFieldSize = 64 << 10
+
+type emulatorPostResult struct {
+	XMLName  xml.Name `xml:"PostResponse"`
+	Location string   `xml:"Location"`
+	Bucket   string   `xml:"Bucket"`
+	Key      string   `xml:"Key"`
+	ETag     string   `xml:"ETag"`
+}
+
+// https://docs.aws.amazon.com/AmazonS3/latest/API/RESTObjectPOST.html
+//
+// The upload is authorized by the policy of the form instead of a signed
+// request, see S3Bucket.PresignPost.
+func (em *Emulator) postObject(w http.ResponseWriter, req *http.Request, bucket string, store *FileStore) error {
+	malformed := newEmulatorError(http.StatusBadRequest, "MalformedPOSTRequest", "the body of your POST request is not well-formed multipart/form-data")
+	mr, err := req.MultipartReader()
+	if err != nil {
+		return malformed
+	}
+	// field names are case insensitive
+	fields := make(map[string]string)
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			return newEmulatorError(http.StatusBadRequest, "InvalidArgument", "POST requires exactly one file upload per request")
+		}
+		if err != nil {
+			return malformed
+		}
+		if part.FormName() != "file" {
+			b, err := ioutil.ReadAll(io.LimitReader(part, maxPostFieldSize))
+			if err != nil {
+				return malformed
+			}
+			fields[strings.ToLower(part.FormName())] = string(b)
+			continue
+		}
+		defer part.Close()
+		if fields["key"] == "" {
+			return newEmulatorError(http.StatusBadRequest, "InvalidArgument", "bucket POST must contain a field named 'key'")
+		}
+		fields["key"] = strings.ReplaceAll(fields["key"], "${filename}", part.FileName())
+		limits, err := em.verifyPolicy(fields, bucket)
+		if err != nil {
+			return err
+		}
+		limits.r = part
+		return em.storePosted(w, req, bucket, store, fields, limits)
+	}
+}
+
+func (em *Emulator) storePosted(w http.ResponseWriter, req *http.Request, bucket string, store *FileStore, fields map[string]string, content io.Reader) error {
+	header := make(http.Header)
+	for k, v := range fields {
+		header.Set(k, v)
+	}
+	key := fields["key"]
+	err := store.Put(req.Context(), key, content, -1, putOptionsOf(header))
+	if err != nil {
+		return err
+	}
+	obj, err := store.Head(req.Context(), key)
+	if err != nil {
+		return err
+	}
+	location := "/" + bucket + "/" + key
+	switch fields["success_action_status"] {
+	case "201":
+		return writeXML(w, http.StatusCreated, emulatorPostResult{Location: location, Bucket: bucket, Key: key, ETag: obj.ETag})
+	case "200":
+		w.Header().Set("ETag", obj.ETag)
+		w.Header().Set("Location", location)
+		w.WriteHeader(http.StatusOK)
+	default:
+		w.Header().Set("ETag", obj.ETag)
+		w.Header().Set("Location", location)
+		w.WriteHeader(http.StatusNoContent)
+	}
+	return nil
+}
+
+// postPolicy is the decoded policy document of a POST form.
+type postPolicy struct {
+	Expiration string        `json:"expiration"`
+	Conditions []interface{} `json:"conditions"`
+}
+
+// verifyPolicy checks the signature of the policy and the fields against its
+// conditions, the size of the content is checked while it is read.
+func (em *Emulator) verifyPolicy(fields map[string]string, bucket string) (*sizeLimitReader, error) {
+	limits := &sizeLimitReader{max: -1}
+	if em.AccessKeyId == "" && fields["policy"] == "" {
+		return limits, nil
+	}
+	denied := func(format string, args ...interface{}) error {
+		return newEmulatorError(http.StatusForbidden, "AccessDenied", "Invalid according to Policy: "+format, args...)
+	}
+	if fields["policy"] == "" {
+		return nil, newEmulatorError(http.StatusForbidden, "AccessDenied", "a policy is required for anonymous uploads")
+	}
+	if em.AccessKeyId != "" {
+		if fields["x-amz-algorithm"] != awsV4Algorithm {
+			return nil, newEmulatorError(http.StatusBadRequest, "InvalidArgument", "only %s authorization is supported", awsV4Algorithm)
+		}
+		now, err := time.Parse(awsV4TimeFormat, fields["x-amz-date"])
+		if err != nil {
+			return nil, newEmulatorError(http.StatusBadRequest, "InvalidArgument", "x-amz-date is missing or invalid")
+		}
+		_, region, err := em.scope(fields["x-amz-credential"], now)
+		if err != nil {
+			return nil, err
+		}
+		signature := signAwsV4Policy(signingKey(em.SecretKey, now, region), fields["policy"])
+		if !hmac.Equal([]byte(signature), []byte(fields["x-amz-signature"])) {
+			return nil, newEmulatorError(http.StatusForbidden, "SignatureDoesNotMatch", "the request signature does not match the signature calculated with the secret key")
+		}
+	}
+
+	invalid := newEmulatorError(http.StatusBadRequest, "InvalidPolicyDocument", "the content of the form does not meet the conditions specified in the policy document")
+	document, err := base64.StdEncoding.DecodeString(fields["policy"])
+	if err != nil {
+		return nil, invalid
+	}
+	var policy postPolicy
+	if json.Unmarshal(document, &policy) != nil {
+		return nil, invalid
+	}
+	expiration, err := time.Parse(time.RFC3339, policy.Expiration)
+	if err != nil {
+		return nil, invalid
+	}
+	if time.Now().After(expiration) {
+		return nil, denied("Policy expired.")
+	}
+	value := func(field string) string {
+		if field == "bucket" {
+			return bucket
+		}
+		return fields[field]
+	}
+	covered := map[string]bool{"policy": true, "x-amz-signature": true}
+	for _, c := range policy.Conditions {
+		switch c := c.(type) {
+		case map[string]interface{}:
+			for k, v := range c {
+				field := strings.ToLower(k)
+				if value(field) != fmt.Sprint(v) {
+					return nil, denied("Policy Condition failed: [\"eq\", \"$%s\", \"%v\"]", field, v)
+				}
+				covered[field] = true
+			}
+		case []interface{}:
+			if len(c) != 3 {
+				return nil, invalid
+			}
+			op := strings.ToLower(fmt.Sprint(c[0]))
+			if op == "content-length-range" {
+				min, okMin := c[1].(float64)
+				max, okMax := c[2].(float64)
+				if !okMin || !okMax {
+					return nil, invalid
+				}
+				limits.min, limits.max = int64(min), int64(max)
+				continue
+			}
+			field := strings.ToLower(strings.TrimPrefix(fmt.Sprint(c[1]), "$"))
+			expected := fmt.Sprint(c[2])
+			switch {
+			case op == "eq" && value(field) != expected, op == "starts-with" && !strings.HasPrefix(value(field), expected):
+				return nil, denied("Policy Condition failed: [\"%s\", \"$%s\", \"%s\"]", op, field, expected)
+			case op != "eq" && op != "starts-with":
+				return nil, invalid
+			}
+			covered[field] = true
+		default:
+			return nil, invalid
+		}
+	}
+	for field := range fields {
+		if !covered[field] && !strings.HasPrefix(field, "x-ignore-") {
+			return nil, denied("Extra input fields: %s", field)
+		}
+	}
+	return limits, nil
+}
+
+// sizeLimitReader fails if the content is not within the size range of the
+// policy, a negative maximum denotes no limit.
+type sizeLimitReader struct {
+	r   io.Reader
+	n   int64
+	min int64
+	max int64
+}
+
+func (l *sizeLimitReader) Read(b []byte) (int, error) {
+	n, err := l.r.Read(b)
+	l.n += int64(n)
+	if l.max >= 0 && l.n > l.max {
+		return n, newEmulatorError(http.StatusBadRequest, "EntityTooLarge", "your proposed upload exceeds the maximum allowed size")
+	}
+	if err == io.EOF && l.n < l.min {
+		return n, newEmulatorError(http.StatusBadRequest, "EntityTooSmall", "your proposed upload is smaller than the minimum allowed size")
+	}
+	return n, err
+}
@@ -0,0 +1,120 @@
+package s3
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// postForm uploads the file like a browser submitting the form, the fields
+// override the ones of the form unless empty, which drops them.
+func postForm(t *testing.T, form *S3PostForm, fields map[string]string, filename string, content string) (int, string) {
+	t.Helper()
+	values := make(map[string]string)
+	for k, v := range form.Fields {
+		values[k] = v
+	}
+	for k, v := range fields {
+		if v == "" {
+			delete(values, k)
+		} else {
+			values[k] = v
+		}
+	}
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	for k, v := range values {
+		if err := mw.WriteField(k, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	fw, err := mw.CreateFormFile("file", filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fw.Write([]byte(content))
+	if err := mw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.Post(form.URL, mw.FormDataContentType(), &body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode, string(b)
+}
+
+func TestEmulatorPostObject(t *testing.T) {
+	bucket, _ := emulatedBucket(t)
+	form, err := bucket.PresignPost(S3PostPolicy{
+		KeyPrefix:         "uploads/",
+		MaxSize:           10,
+		ContentTypePrefix: "text/",
+		Expires:           time.Hour,
+	}, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	status, body := postForm(t, form, map[string]string{"Content-Type": "text/plain"}, "a.txt", "a")
+	if status != http.StatusNoContent {
+		t.Fatalf("upload failed with %d: %s", status, body)
+	}
+	obj, content := get(t, bucket, "uploads/a.txt", "")
+	if content != "a" || obj.ContentType != "text/plain" {
+		t.Errorf("uploaded object has content %q of type %s", content, obj.ContentType)
+	}
+	// fields prefixed by x-ignore- need not be covered by the policy
+	status, body = postForm(t, form, map[string]string{"Content-Type": "text/plain", "x-ignore-note": "n"}, "b.txt", "b")
+	if status != http.StatusNoContent {
+		t.Errorf("upload with an ignored field failed with %d: %s", status, body)
+	}
+
+	tests := []struct {
+		name    string
+		fields  map[string]string
+		content string
+		status  int
+		code    string
+	}{
+		{"key outside the prefix", map[string]string{"key": "other/${filename}"}, "a", http.StatusForbidden, "AccessDenied"},
+		{"content type outside the prefix", map[string]string{"Content-Type": "image/png"}, "a", http.StatusForbidden, "AccessDenied"},
+		{"content too large", nil, "01234567890", http.StatusBadRequest, "EntityTooLarge"},
+		{"field not in the policy", map[string]string{"success_action_status": "201"}, "a", http.StatusForbidden, "AccessDenied"},
+		{"tampered signature", map[string]string{"x-amz-signature": strings.Repeat("0", 64)}, "a", http.StatusForbidden, "SignatureDoesNotMatch"},
+		{"missing policy", map[string]string{"policy": ""}, "a", http.StatusForbidden, "AccessDenied"},
+		{"missing key", map[string]string{"key": ""}, "a", http.StatusBadRequest, "InvalidArgument"},
+	}
+	for _, test := range tests {
+		status, body := postForm(t, form, test.fields, "c.txt", test.content)
+		if status != test.status || !strings.Contains(body, "<Code>"+test.code+"</Code>") {
+			t.Errorf("upload with %s returned %d: %s, expected %d with %s", test.name, status, body, test.status, test.code)
+		}
+	}
+	visitor := &collectingVisitor{}
+	if err := bucket.List(context.Background(), "", 10, visitor); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(visitor.keys, []string{"uploads/a.txt", "uploads/b.txt"}) {
+		t.Errorf("bucket holds %v, expected only the accepted uploads", visitor.keys)
+	}
+
+	expired, err := bucket.PresignPost(S3PostPolicy{KeyPrefix: "uploads/", Expires: time.Second}, time.Now().Add(-time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	status, body = postForm(t, expired, nil, "d.txt", "d")
+	if status != http.StatusForbidden || !strings.Contains(body, "Policy expired") {
+		t.Errorf("upload with an expired policy returned %d: %s", status, body)
+	}
+}
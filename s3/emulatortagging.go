@@ -0,0 +1,48 @@
+package s3
+
+import (
+	"io/ioutil"
+	"net/http"
+)
+
+// https://docs.aws.amazon.com/AmazonS3/latest/API/API_GetObjectTagging.html
+// https://docs.aws.amazon.com/AmazonS3/latest/API/API_PutObjectTagging.html
+// https://docs.aws.amazon.com/AmazonS3/latest/API/API_DeleteObjectTagging.html
+func (em *Emulator) objectTagging(w http.ResponseWriter, req *http.Request, store *FileStore, key string) error {
+	switch req.Method {
+	case "GET":
+		_, err := store.Head(req.Context(), key)
+		if err != nil {
+			return err
+		}
+		options, err := store.putOptions(key)
+		if err != nil {
+			return err
+		}
+		return writeXML(w, http.StatusOK, newTagging(options.Tags))
+	case "PUT":
+		b, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			return err
+		}
+		tags, err := unmarshalTagging(b)
+		if err != nil {
+			return newEmulatorError(http.StatusBadRequest, "MalformedXML", "the XML you provided was not well-formed")
+		}
+		if err := ValidateTags(tags); err != nil {
+			return newEmulatorError(http.StatusBadRequest, "InvalidTag", "%v", err)
+		}
+		err = store.putTags(key, tags)
+		if err == nil {
+			w.WriteHeader(http.StatusOK)
+		}
+		return err
+	case "DELETE":
+		err := store.putTags(key, nil)
+		if err == nil {
+			w.WriteHeader(http.StatusNoContent)
+		}
+		return err
+	}
+	return notImplemented(req)
+}
@@ -0,0 +1,76 @@
+package s3
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestEmulatorTagging(t *testing.T) {
+	bucket, _ := emulatedBucket(t)
+	ctx := context.Background()
+	put(t, bucket, "a", "a", S3PutOptions{Tags: map[string]string{"team": "data", "tier": "hot"}})
+
+	tags, err := bucket.GetTags(ctx, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(tags, map[string]string{"team": "data", "tier": "hot"}) {
+		t.Errorf("tags put with the object are %v", tags)
+	}
+	err = bucket.PutTags(ctx, "a", map[string]string{"tier": "cold"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tags, err = bucket.GetTags(ctx, "a")
+	if err != nil || !reflect.DeepEqual(tags, map[string]string{"tier": "cold"}) {
+		t.Errorf("replaced tags are %v (%v), expected map[tier:cold]", tags, err)
+	}
+	// copies keep the tags like the metadata
+	if err := bucket.Copy(ctx, "a", "b"); err != nil {
+		t.Fatal(err)
+	}
+	tags, err = bucket.GetTags(ctx, "b")
+	if err != nil || !reflect.DeepEqual(tags, map[string]string{"tier": "cold"}) {
+		t.Errorf("tags of the copy are %v (%v), expected map[tier:cold]", tags, err)
+	}
+	err = bucket.DeleteTags(ctx, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tags, err = bucket.GetTags(ctx, "a")
+	if err != nil || len(tags) != 0 {
+		t.Errorf("deleted tags are %v (%v), expected none", tags, err)
+	}
+
+	_, err = bucket.GetTags(ctx, "missing")
+	if !hasErrorCode(err, "NoSuchKey") {
+		t.Errorf("getting tags of a missing object returned %v, expected NoSuchKey", err)
+	}
+	// the client refuses invalid tags, hence they are forwarded
+	tests := []struct {
+		body string
+		code string
+	}{
+		{"<Tagging><TagSet><Tag>", "MalformedXML"},
+		{`<Tagging xmlns="http://s3.amazonaws.com/doc/2006-03-01/"><TagSet><Tag><Key>aws:x</Key><Value>v</Value></Tag></TagSet></Tagging>`, "InvalidTag"},
+	}
+	for _, test := range tests {
+		resp, err := bucket.Forward(ctx, "PUT", "a", url.Values{"tagging": {""}}, nil, strings.NewReader(test.body), int64(len(test.body)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != http.StatusBadRequest || !strings.Contains(string(b), "<Code>"+test.code+"</Code>") {
+			t.Errorf("putting %s returned %d: %s, expected %s", test.body, resp.StatusCode, b, test.code)
+		}
+	}
+}
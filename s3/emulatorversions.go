@@ -0,0 +1,78 @@
+package s3
+
+import (
+	"encoding/xml"
+	"net/http"
+	"strconv"
+)
+
+// nullVersionId is the version id of objects stored while the versioning
+// of their bucket has never been enabled.
+const nullVersionId = "null"
+
+type emulatorVersionsResult struct {
+	XMLName xml.Name `xml:"http://s3.amazonaws.com/doc/2006-03-01/ ListVersionsResult"`
+	S3ListVersionsResult
+}
+
+type emulatorVersioningConfiguration struct {
+	XMLName xml.Name `xml:"http://s3.amazonaws.com/doc/2006-03-01/ VersioningConfiguration"`
+}
+
+// https://docs.aws.amazon.com/AmazonS3/latest/API/API_ListObjectVersions.html
+//
+// Buckets of the emulator are not versioned, each object is listed as its
+// only version.
+func (em *Emulator) listVersions(w http.ResponseWriter, req *http.Request, bucket string, store *FileStore) error {
+	query := req.URL.Query()
+	prefix := query.Get("prefix")
+	maxKeys := defaultFetchSize
+	if s := query.Get("max-keys"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 {
+			return newEmulatorError(http.StatusBadRequest, "InvalidArgument", "invalid max-keys %s", s)
+		}
+		if n < maxKeys {
+			maxKeys = n
+		}
+	}
+	marker := query.Get("key-marker")
+	items, err := store.items(req.Context(), prefix)
+	if err != nil {
+		return err
+	}
+	rlt := S3ListVersionsResult{
+		Name:            bucket,
+		Prefix:          prefix,
+		KeyMarker:       marker,
+		VersionIdMarker: query.Get("version-id-marker"),
+		MaxKeys:         maxKeys,
+	}
+	for _, item := range items {
+		if item.Key <= marker {
+			continue
+		}
+		if len(rlt.Versions) == maxKeys {
+			rlt.IsTruncated = true
+			rlt.NextKeyMarker = rlt.Versions[maxKeys-1].Key
+			rlt.NextVersionIdMarker = nullVersionId
+			break
+		}
+		rlt.Versions = append(rlt.Versions, S3ObjectVersion{
+			Key:          item.Key,
+			VersionId:    nullVersionId,
+			IsLatest:     true,
+			LastModified: item.LastModified,
+			ETag:         item.ETag,
+			Size:         item.Size,
+			Owner:        item.Owner,
+			StorageClass: item.StorageClass,
+		})
+	}
+	return writeXML(w, http.StatusOK, emulatorVersionsResult{S3ListVersionsResult: rlt})
+}
+
+// https://docs.aws.amazon.com/AmazonS3/latest/API/API_GetBucketVersioning.html
+func (em *Emulator) getVersioning(w http.ResponseWriter) error {
+	return writeXML(w, http.StatusOK, emulatorVersioningConfiguration{})
+}
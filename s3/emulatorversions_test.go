@@ -0,0 +1,96 @@
+package s3
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+type versionsVisitor func(partialResult *S3ListVersionsResult) (bool, error)
+
+func (visit versionsVisitor) VisitVersions(partialResult *S3ListVersionsResult) (bool, error) {
+	return visit(partialResult)
+}
+
+func TestEmulatorVersions(t *testing.T) {
+	bucket, _ := emulatedBucket(t)
+	ctx := context.Background()
+	for _, key := range []string{"a", "b/c", "b/d", "e"} {
+		put(t, bucket, key, key, S3PutOptions{})
+	}
+
+	status, err := bucket.GetVersioning(ctx)
+	if err != nil || status != "" {
+		t.Errorf("versioning status is %q (%v), expected none", status, err)
+	}
+	err = bucket.PutVersioning(ctx, "Enabled")
+	if !hasErrorCode(err, "NotImplemented") {
+		t.Errorf("enabling versioning returned %v, expected NotImplemented", err)
+	}
+
+	// each object is listed as its only version
+	var versions []string
+	pages := 0
+	err = bucket.ListVersions(ctx, "", 3, versionsVisitor(func(rlt *S3ListVersionsResult) (bool, error) {
+		pages++
+		for _, v := range rlt.Entries() {
+			if !v.IsLatest || v.DeleteMarker {
+				t.Errorf("version %s of %s is not the latest object", v.VersionId, v.Key)
+			}
+			versions = append(versions, v.Key+"@"+v.VersionId)
+		}
+		return true, nil
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(versions, []string{"a@null", "b/c@null", "b/d@null", "e@null"}) || pages != 2 {
+		t.Errorf("versions are %v in %d pages, expected the objects in 2 pages", versions, pages)
+	}
+
+	obj, err := bucket.GetVersion(ctx, "b/c", nullVersionId, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	obj.Body.Close()
+	_, err = bucket.GetVersion(ctx, "b/c", "3HL4kqtJlcpXroDTDmJ", "")
+	if !hasErrorCode(err, "NoSuchVersion") {
+		t.Errorf("getting an unknown version returned %v, expected NoSuchVersion", err)
+	}
+	err = bucket.DeleteVersion(ctx, "b/c", nullVersionId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := bucket.Head(ctx, "b/c"); err == nil {
+		t.Error("deleting the null version kept the object")
+	}
+}
+
+func TestEmulatorDeleteVersions(t *testing.T) {
+	bucket, _ := emulatedBucket(t)
+	put(t, bucket, "a", "a", S3PutOptions{})
+	put(t, bucket, "b", "b", S3PutOptions{})
+	var deleted, failed []string
+	err := bucket.DeleteVersions(context.Background(), deleteResultVisitor(func(rlt *S3DeleteResult) error {
+		for _, d := range rlt.Deleted {
+			deleted = append(deleted, d.Key+"@"+d.VersionId)
+		}
+		for _, e := range rlt.Error {
+			failed = append(failed, e.Key+"@"+e.VersionId+" "+e.Code)
+		}
+		return nil
+	}), S3ObjectVersion{Key: "a", VersionId: nullVersionId}, S3ObjectVersion{Key: "b", VersionId: "3HL4kqtJlcpXroDTDmJ"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(deleted, []string{"a@null"}) || !reflect.DeepEqual(failed, []string{"b@3HL4kqtJlcpXroDTDmJ NoSuchVersion"}) {
+		t.Errorf("deleted %v and failed %v, expected to delete a@null and fail for the unknown version of b", deleted, failed)
+	}
+	visitor := &collectingVisitor{}
+	if err := bucket.List(context.Background(), "", 10, visitor); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(visitor.keys, []string{"b"}) {
+		t.Errorf("listing after deletion is %v, expected [b]", visitor.keys)
+	}
+}
@@ -0,0 +1,87 @@
+package s3
+
+import (
+	"crypto/md5"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// ComputeETag computes the ETag of content uploaded in parts of partSize
+// bytes. Content fitting into a single part results in its MD5 checksum,
+// multipart uploads in the MD5 checksum of the parts' checksums followed
+// by the number of parts.
+func ComputeETag(content io.Reader, size int64, partSize int64) (string, error) {
+	if size <= partSize {
+		hash := md5.New()
+		if _, err := io.Copy(hash, content); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("%x", hash.Sum(nil)), nil
+	}
+	sums := md5.New()
+	parts := 0
+	for {
+		hash := md5.New()
+		n, err := io.CopyN(hash, content, partSize)
+		if err != nil && err != io.EOF {
+			return "", err
+		}
+		if n == 0 {
+			break
+		}
+		sums.Write(hash.Sum(nil))
+		parts++
+		if n < partSize {
+			break
+		}
+	}
+	return fmt.Sprintf("%x-%d", sums.Sum(nil), parts), nil
+}
+
+// ETagMatches tests whether local content corresponds to the ETag of an
+// object. The part size of multipart uploads is not known, hence the part
+// size of this bucket and the smallest whole number of MiB resulting in the
+// same number of parts are tried.
+func (bucket S3Bucket) ETagMatches(content io.ReadSeeker, size int64, etag string) (bool, error) {
+	return ETagMatches(content, size, etag, bucket.partSize(size))
+}
+
+// ETagMatches tests whether local content corresponds to the ETag of an
+// object like S3Bucket.ETagMatches, partSize is tried first for multipart
+// uploads.
+func ETagMatches(content io.ReadSeeker, size int64, etag string, partSize int64) (bool, error) {
+	etag = strings.ToLower(strings.Trim(etag, "\""))
+	i := strings.Index(etag, "-")
+	if i < 0 {
+		sum, err := ComputeETag(content, size, size)
+		return sum == etag, err
+	}
+	parts, err := strconv.ParseInt(etag[i+1:], 10, 64)
+	if err != nil || parts < 1 {
+		return false, nil
+	}
+	candidates := []int64{partSize}
+	const mib = int64(1 << 20)
+	derived := ((size+parts-1)/parts + mib - 1) / mib * mib
+	if derived != candidates[0] {
+		candidates = append(candidates, derived)
+	}
+	for _, partSize := range candidates {
+		if (size+partSize-1)/partSize != parts {
+			continue
+		}
+		if _, err := content.Seek(0, io.SeekStart); err != nil {
+			return false, err
+		}
+		sum, err := ComputeETag(content, size, partSize)
+		if err != nil {
+			return false, err
+		}
+		if sum == etag {
+			return true, nil
+		}
+	}
+	return false, nil
+}
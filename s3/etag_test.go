@@ -0,0 +1,130 @@
+package s3
+
+import (
+	"bytes"
+	"crypto/md5"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// multipartETag computes the ETag S3 reports for content uploaded in parts
+// of partSize bytes.
+func multipartETag(content []byte, partSize int) string {
+	var sums []byte
+	parts := 0
+	for i := 0; i < len(content); i += partSize {
+		end := i + partSize
+		if end > len(content) {
+			end = len(content)
+		}
+		sum := md5.Sum(content[i:end])
+		sums = append(sums, sum[:]...)
+		parts++
+	}
+	return fmt.Sprintf("\"%x-%d\"", md5.Sum(sums), parts)
+}
+
+// testContent returns size bytes which differ from part to part.
+func testContent(size int) []byte {
+	content := make([]byte, size)
+	for i := range content {
+		content[i] = byte(i / 1021)
+	}
+	return content
+}
+
+func TestETagMatchesSinglePart(t *testing.T) {
+	content := []byte("hello world")
+	sum := fmt.Sprintf("%x", md5.Sum(content))
+	tests := []struct {
+		etag    string
+		matches bool
+	}{
+		{`"` + sum + `"`, true},
+		{sum, true},
+		{`"` + strings.ToUpper(sum) + `"`, true},
+		{fmt.Sprintf(`"%x"`, md5.Sum([]byte("hello World"))), false},
+		// SSE-KMS and SSE-C encrypted objects have ETags other than the MD5 sum
+		{`"4e1e1f26c4bb4a5d8e7e6f3a7b6c5d4e"`, false},
+		{`""`, false},
+	}
+	for _, test := range tests {
+		ok, err := ETagMatches(bytes.NewReader(content), int64(len(content)), test.etag, DefaultPartSize)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ok != test.matches {
+			t.Errorf("ETag %s matches is %t, expected %t", test.etag, ok, test.matches)
+		}
+	}
+}
+
+func TestETagMatchesMultipart(t *testing.T) {
+	const mib = 1 << 20
+	bucket := S3Bucket{PartSize: MinPartSize}
+	tests := []struct {
+		name     string
+		size     int
+		partSize int
+		matches  bool
+	}{
+		{"parts of the bucket", 12 * mib, int(MinPartSize), true},
+		{"last part complete", 10 * mib, int(MinPartSize), true},
+		{"last part of one byte", 10*mib + 1, int(MinPartSize), true},
+		{"derived part size", 10*mib + 1, 6 * mib, true},
+		{"derived part size with partial part", 20*mib - 3, 7 * mib, true},
+		// only the smallest part size in MiB is derived
+		{"larger part size", 10*mib + 1, 8 * mib, false},
+		{"part size other than whole MiB", 10*mib + 1, 6*mib + 1, false},
+	}
+	for _, test := range tests {
+		content := testContent(test.size)
+		etag := multipartETag(content, test.partSize)
+		ok, err := bucket.ETagMatches(bytes.NewReader(content), int64(len(content)), etag)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ok != test.matches {
+			t.Errorf("%s: ETag %s matches is %t, expected %t", test.name, etag, ok, test.matches)
+		}
+	}
+
+	// content differing only in a later part
+	content := testContent(12 * mib)
+	etag := multipartETag(content, int(MinPartSize))
+	content[len(content)-1]++
+	if ok, err := bucket.ETagMatches(bytes.NewReader(content), int64(len(content)), etag); ok || err != nil {
+		t.Errorf("ETag of other content matches is %t (%v)", ok, err)
+	}
+	// the number of parts does not fit the size
+	invalid := []string{
+		strings.Replace(etag, "-3", "-4", 1),
+		strings.Replace(etag, "-3", "-0", 1),
+		strings.Replace(etag, "-3", "-x", 1),
+		strings.Replace(etag, "-3", "-", 1),
+	}
+	content[len(content)-1]--
+	for _, etag := range invalid {
+		if ok, err := bucket.ETagMatches(bytes.NewReader(content), int64(len(content)), etag); ok || err != nil {
+			t.Errorf("ETag %s matches is %t (%v)", etag, ok, err)
+		}
+	}
+}
+
+func TestComputeETag(t *testing.T) {
+	content := testContent(3*1021 + 5)
+	for _, partSize := range []int{1021, 2000, len(content) - 1} {
+		sum, err := ComputeETag(bytes.NewReader(content), int64(len(content)), int64(partSize))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected := strings.Trim(multipartETag(content, partSize), `"`); sum != expected {
+			t.Errorf("ETag of parts of %d bytes is %s, expected %s", partSize, sum, expected)
+		}
+	}
+	sum, err := ComputeETag(bytes.NewReader(content), int64(len(content)), int64(len(content)))
+	if err != nil || sum != fmt.Sprintf("%x", md5.Sum(content)) {
+		t.Errorf("ETag of a single part is %s (%v), expected the MD5 sum", sum, err)
+	}
+}
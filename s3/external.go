@@ -1,15 +1,16 @@
 package s3
 
 import (
+	"bufio"
 	"bytes"
+	"context"
 	"encoding/xml"
 	"fmt"
 	"io"
-	"io/fs"
-	"io/ioutil"
+	"mime"
 	"net/http"
 	"net/url"
-	"os"
+	"path"
 	"strconv"
 	"strings"
 	"time"
@@ -21,8 +22,100 @@ type S3Bucket struct {
 	SecretKey   string
 	AccessKeyId string
 	Region      string
+	PartSize    int64
+	Defaults    S3PutOptions `mapstructure:"defaults"`
+	// LimitRate is the bandwidth limit like 20MiB/s, it takes effect by Throttle.
+	LimitRate string
+	// MaxRequestsPerSecond takes effect by Throttle as well.
+	MaxRequestsPerSecond float64
+	// Throttle is shared by all copies of the bucket, nil means unlimited.
+	Throttle *Throttle `mapstructure:"-"`
 }
 
+// S3PutOptions control the headers sent along with uploaded objects.
+//
+// The keys of the fields are the ones of the defaults of buckets in the
+// configuration.
+type S3PutOptions struct {
+	ContentType        string            `mapstructure:"contenttype"`
+	CacheControl       string            `mapstructure:"cachecontrol"`
+	ContentEncoding    string            `mapstructure:"contentencoding"`
+	ContentDisposition string            `mapstructure:"contentdisposition"`
+	StorageClass       string            `mapstructure:"storageclass"`
+	Acl                string            `mapstructure:"acl"`
+	Metadata           map[string]string `mapstructure:"metadata"`
+	// Tags are the tags of the objects, see S3Bucket.PutTags.
+	Tags map[string]string `mapstructure:"tags"`
+}
+
+// WithDefaults returns a copy of the options with unset values taken from defaults.
+func (options S3PutOptions) WithDefaults(defaults S3PutOptions) S3PutOptions {
+	rlt := options
+	for _, v := range []struct {
+		value    *string
+		fallback string
+	}{
+		{&rlt.ContentType, defaults.ContentType},
+		{&rlt.CacheControl, defaults.CacheControl},
+		{&rlt.ContentEncoding, defaults.ContentEncoding},
+		{&rlt.ContentDisposition, defaults.ContentDisposition},
+		{&rlt.StorageClass, defaults.StorageClass},
+		{&rlt.Acl, defaults.Acl},
+	} {
+		if *v.value == "" {
+			*v.value = v.fallback
+		}
+	}
+	rlt.Metadata = make(map[string]string)
+	for k, v := range defaults.Metadata {
+		rlt.Metadata[strings.ToLower(k)] = v
+	}
+	for k, v := range options.Metadata {
+		rlt.Metadata[strings.ToLower(k)] = v
+	}
+	if len(defaults.Tags) > 0 || len(options.Tags) > 0 {
+		rlt.Tags = make(map[string]string)
+		for k, v := range defaults.Tags {
+			rlt.Tags[k] = v
+		}
+		for k, v := range options.Tags {
+			rlt.Tags[k] = v
+		}
+	}
+	return rlt
+}
+
+func (options S3PutOptions) header() map[string]string {
+	header := make(map[string]string)
+	for k, v := range map[string]string{
+		"Content-Type":        options.ContentType,
+		"Cache-Control":       options.CacheControl,
+		"Content-Encoding":    options.ContentEncoding,
+		"Content-Disposition": options.ContentDisposition,
+		"X-Amz-Storage-Class": options.StorageClass,
+		"X-Amz-Acl":           options.Acl,
+	} {
+		if v != "" {
+			header[k] = v
+		}
+	}
+	for k, v := range options.Metadata {
+		header["X-Amz-Meta-"+strings.ToLower(k)] = v
+	}
+	if len(options.Tags) > 0 {
+		header["X-Amz-Tagging"] = encodeTags(options.Tags)
+	}
+	return header
+}
+
+const (
+	DefaultPartSize = int64(8 << 20)
+	MinPartSize     = int64(5 << 20)
+	MaxParts        = 10000
+	// maxDeleteKeys is the maximum number of objects deleted by one request
+	maxDeleteKeys = 1000
+)
+
 type S3Owner struct {
 	Id          string `xml:"ID"`
 	DisplayName string `xml:"DisplayName"`
@@ -44,10 +137,17 @@ type S3ListBucketResult struct {
 	MaxKeys               int      `xml:"MaxKeys"`
 	EncodingType          string   `xml:"EncodingType"`
 	KeyCount              int      `xml:"KeyCount"`
+	IsTruncated           bool     `xml:"IsTruncated"`
 	ContinuationToken     string   `xml:"ContinuationToken"`
 	NextContinuationToken string   `xml:"NextContinuationToken"`
 	StartAfter            string   `xml:"StartAfter"`
 	Contents              []S3Item `xml:"Contents"`
+	// CommonPrefixes are only present for listings with a delimiter
+	CommonPrefixes []S3CommonPrefix `xml:"CommonPrefixes"`
+}
+
+type S3CommonPrefix struct {
+	Prefix string `xml:"Prefix"`
 }
 
 type S3ListBucketResultVisitor interface {
@@ -56,10 +156,64 @@ type S3ListBucketResultVisitor interface {
 
 //#######
 
+type S3Object struct {
+	Key             string
+	Size            int64
+	ContentType     string
+	ContentEncoding string
+	ContentRange    string
+	ETag            string
+	LastModified    time.Time
+	VersionId       string
+	Metadata        map[string]string
+	Body            io.ReadCloser
+}
+
+func newS3Object(key string, resp *http.Response) *S3Object {
+	obj := &S3Object{
+		Key:             key,
+		Size:            resp.ContentLength,
+		ContentType:     resp.Header.Get("Content-Type"),
+		ContentEncoding: resp.Header.Get("Content-Encoding"),
+		ContentRange:    resp.Header.Get("Content-Range"),
+		ETag:            resp.Header.Get("ETag"),
+		VersionId:       resp.Header.Get("X-Amz-Version-Id"),
+		Metadata:        make(map[string]string),
+		Body:            resp.Body,
+	}
+	if t, err := http.ParseTime(resp.Header.Get("Last-Modified")); err == nil {
+		obj.LastModified = t
+	}
+	for k := range resp.Header {
+		kl := strings.ToLower(k)
+		if strings.HasPrefix(kl, "x-amz-meta-") {
+			obj.Metadata[strings.TrimPrefix(kl, "x-amz-meta-")] = resp.Header.Get(k)
+		}
+	}
+	return obj
+}
+
+// ByteRange formats a HTTP range of the bytes from start to end (both inclusive),
+// a negative end denotes the range up to the end of the object.
+func ByteRange(start int64, end int64) string {
+	if end < 0 {
+		return fmt.Sprintf("bytes=%d-", start)
+	}
+	return fmt.Sprintf("bytes=%d-%d", start, end)
+}
+
+// SuffixByteRange formats a HTTP range of the last n bytes.
+func SuffixByteRange(n int64) string {
+	return fmt.Sprintf("bytes=-%d", n)
+}
+
+//#######
+
 type S3Deleted struct {
-	Key     string `xml:"Key"`
-	Code    string `xml:"Code"`
-	Message string `xml:"Message"`
+	Key       string `xml:"Key"`
+	VersionId string `xml:"VersionId,omitempty"`
+	Code      string `xml:"Code"`
+	Message   string `xml:"Message"`
 }
 
 type S3DeleteResult struct {
@@ -71,27 +225,37 @@ type S3DeleteResultVisitor interface {
 	VisitDeletion(partialResult *S3DeleteResult) error
 }
 
-//#######
-
 // https://docs.aws.amazon.com/AmazonS3/latest/API/API_ListObjectsV2.html
-func (bucket S3Bucket) List(prefix string, fetchSize int, visitor S3ListBucketResultVisitor) error {
+func (bucket S3Bucket) List(ctx context.Context, prefix string, fetchSize int, visitor S3ListBucketResultVisitor) error {
+	return bucket.ListFrom(ctx, prefix, "", fetchSize, visitor)
+}
+
+// ListFrom continues a listing at the continuation token of a previously
+// visited partial result, an empty token starts at the beginning.
+func (bucket S3Bucket) ListFrom(ctx context.Context, prefix string, continuationToken string, fetchSize int, visitor S3ListBucketResultVisitor) error {
 	query := "list-type=2&fetch-owner=true&max-keys=" + strconv.Itoa(fetchSize)
 	if prefix != "" {
 		query += "&prefix=" + url.QueryEscape(prefix)
 	}
+	if continuationToken != "" {
+		query += "&continuation-token=" + url.QueryEscape(continuationToken)
+	}
 
-	var rlt S3ListBucketResult
 	reqUrl, err := url.Parse(bucket.Endpoint + "/?" + query)
 	if err != nil {
 		return err
 	}
 	for {
 
-		resp, err := curl(bucket, "GET", reqUrl, http.NoBody)
+		resp, err := curl(ctx, bucket, "GET", reqUrl, http.NoBody, nil)
+		if err != nil {
+			return err
+		}
+		var rlt S3ListBucketResult
+		err = xml.Unmarshal(resp.Bytes(), &rlt)
 		if err != nil {
 			return err
 		}
-		xml.Unmarshal(resp.Bytes(), &rlt)
 		b, err := visitor.VisitListing(&rlt)
 		if err != nil {
 			return err
@@ -99,69 +263,253 @@ func (bucket S3Bucket) List(prefix string, fetchSize int, visitor S3ListBucketRe
 		if !b {
 			return nil
 		}
-		if rlt.KeyCount != rlt.MaxKeys {
+		if !rlt.IsTruncated || rlt.NextContinuationToken == "" {
 			return nil
 		}
 		tmp := reqUrl.Query()
-		tmp.Set("start-after", rlt.Contents[len(rlt.Contents)-1].Key)
+		tmp.Set("continuation-token", rlt.NextContinuationToken)
 		reqUrl.RawQuery = tmp.Encode()
 	}
 }
 
 // https://docs.aws.amazon.com/AmazonS3/latest/API/API_GetObject.html
-func (bucket S3Bucket) Download(key string, targetPath string) error {
+//
+// The caller is responsible for closing the body of the returned object,
+// byteRange is passed as Range header unless it is empty.
+func (bucket S3Bucket) Get(ctx context.Context, key string, byteRange string) (*S3Object, error) {
+	return bucket.GetVersion(ctx, key, "", byteRange)
+}
+
+// https://docs.aws.amazon.com/AmazonS3/latest/API/API_HeadObject.html
+func (bucket S3Bucket) Head(ctx context.Context, key string) (*S3Object, error) {
 	reqUrl, err := url.Parse(bucket.Endpoint + "/" + key)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := send(ctx, bucket, "HEAD", reqUrl, http.NoBody, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+	obj := newS3Object(key, resp)
+	obj.Body = nil
+	return obj, nil
+}
+
+// https://docs.aws.amazon.com/AmazonS3/latest/API/API_CopyObject.html
+//
+// The copy keeps the header information and the metadata of the source.
+func (bucket S3Bucket) Copy(ctx context.Context, sourceKey string, targetKey string) error {
+	reqUrl, err := url.Parse(bucket.Endpoint + "/" + targetKey)
 	if err != nil {
 		return err
 	}
-	resp, err := curl(bucket, "GET", reqUrl, http.NoBody)
+	source := &url.URL{Path: "/" + bucket.bucketName() + "/" + sourceKey}
+	resp, err := curl(ctx, bucket, "PUT", reqUrl, http.NoBody, map[string]string{"X-Amz-Copy-Source": source.EscapedPath()})
 	if err != nil {
 		return err
 	}
-	return ioutil.WriteFile(targetPath, resp.Bytes(), fs.ModePerm)
+	// errors might be reported after the response status has been sent
+	var rlt S3Error
+	if xml.Unmarshal(resp.Bytes(), &rlt) == nil && rlt.Code != "" {
+		return fmt.Errorf("copying %s to %s failed: %s -> %s", sourceKey, targetKey, rlt.Code, rlt.Message)
+	}
+	return nil
+}
+
+// bucketName derives the name of the bucket from the endpoint, which is its
+// path for path-style endpoints or the leading host label otherwise.
+func (bucket S3Bucket) bucketName() string {
+	u, err := url.Parse(bucket.Endpoint)
+	if err != nil {
+		return bucket.Name
+	}
+	if p := strings.Trim(u.Path, "/"); p != "" {
+		return strings.SplitN(p, "/", 2)[0]
+	}
+	return strings.SplitN(u.Hostname(), ".", 2)[0]
 }
 
 // https://docs.aws.amazon.com/AmazonS3/latest/API/API_DeleteObjects.html
-func (bucket S3Bucket) Delete(visitor S3DeleteResultVisitor, keys ...string) error {
-	var payload string
-	payload = "<Delete>"
+//
+// The keys are deleted in batches of at most 1000, the maximum of a request,
+// the result of each batch is passed to the visitor.
+func (bucket S3Bucket) Delete(ctx context.Context, visitor S3DeleteResultVisitor, keys ...string) error {
+	objects := make([]s3ObjectIdentifier, 0, len(keys))
 	for _, key := range keys {
-		payload += fmt.Sprintf("<Object><Key>%s</Key></Object>", key)
+		objects = append(objects, s3ObjectIdentifier{Key: key})
 	}
-	payload += "</Delete>"
+	return bucket.deleteObjects(ctx, visitor, objects)
+}
 
+// s3ObjectIdentifier is an object of DeleteObjects, its latest version
+// unless the version id is given.
+type s3ObjectIdentifier struct {
+	Key       string `xml:"Key"`
+	VersionId string `xml:"VersionId,omitempty"`
+}
+
+func (bucket S3Bucket) deleteObjects(ctx context.Context, visitor S3DeleteResultVisitor, objects []s3ObjectIdentifier) error {
 	reqUrl, err := url.Parse(bucket.Endpoint + "/?delete")
 	if err != nil {
 		return err
 	}
-	resp, err := curl(bucket, "POST", reqUrl, strings.NewReader(payload))
-	if err != nil {
-		return err
+	for len(objects) > 0 {
+		n := len(objects)
+		if n > maxDeleteKeys {
+			n = maxDeleteKeys
+		}
+		payload, err := xml.Marshal(struct {
+			XMLName xml.Name             `xml:"Delete"`
+			Objects []s3ObjectIdentifier `xml:"Object"`
+		}{Objects: objects[:n]})
+		if err != nil {
+			return err
+		}
+		objects = objects[n:]
+
+		resp, err := curl(ctx, bucket, "POST", reqUrl, bytes.NewReader(payload), nil)
+		if err != nil {
+			return err
+		}
+		var rlt S3DeleteResult
+		xml.Unmarshal(resp.Bytes(), &rlt)
+		err = visitor.VisitDeletion(&rlt)
+		if err != nil {
+			return err
+		}
 	}
-	var rlt S3DeleteResult
-	xml.Unmarshal(resp.Bytes(), &rlt)
-	return visitor.VisitDeletion(&rlt)
+	return nil
 }
 
-// https://docs.aws.amazon.com/AmazonS3/latest/API/API_PutObject.html
-func (bucket S3Bucket) Upload(key string, file *os.File) error {
-	filepath := file.Name()
-	fi, err := file.Stat()
+// Forward sends the request of another client for a key of the bucket (the
+// bucket itself if empty) signed with the credentials of the bucket, i.e. to
+// proxy it. The payload is streamed without being signed and the response is
+// returned whatever its status, the caller is responsible for closing its body.
+func (bucket S3Bucket) Forward(ctx context.Context, method string, key string, query url.Values, header http.Header, body io.Reader, size int64) (*http.Response, error) {
+	reqUrl, err := url.Parse(bucket.Endpoint + "/" + key)
+	if err != nil {
+		return nil, err
+	}
+	reqUrl.RawQuery = query.Encode()
+	req, err := http.NewRequestWithContext(ctx, method, reqUrl.String(), body)
 	if err != nil {
-		return fmt.Errorf("can not read file at %s: %s", filepath, err.Error())
+		return nil, err
+	}
+	req.ContentLength = size
+	if size == 0 {
+		req.Body = http.NoBody
 	}
-	if fi.IsDir() {
-		return fmt.Errorf("file %s is a directory", filepath)
+	for k, v := range header {
+		req.Header[k] = v
 	}
+	req.Header.Set("User-Agent", "s3 cli")
+	return sendStreaming(ctx, bucket, req)
+}
 
-	reqUrl, err := url.Parse(bucket.Endpoint + "/" + key)
-	if err != nil {
+// https://docs.aws.amazon.com/AmazonS3/latest/API/API_PutObject.html
+//
+// size is a hint of the number of bytes provided by the reader, a negative
+// size denotes an unknown size. Content exceeding the part size is sent as
+// multipart upload, hence at most one part is held in memory at a time.
+// Unless specified, the content type is derived from the key's extension or
+// the leading content.
+func (bucket S3Bucket) Put(ctx context.Context, key string, reader io.Reader, size int64, options S3PutOptions) error {
+	return bucket.UploadResumable(ctx, key, reader, size, options, nil, nil)
+}
+
+// Upload uploads like Put with the defaults of the bucket only.
+func (bucket S3Bucket) Upload(ctx context.Context, key string, reader io.Reader, size int64) error {
+	return bucket.Put(ctx, key, reader, size, S3PutOptions{})
+}
+
+// UploadResumable uploads like Put, but resumes the multipart upload
+// described by upload if any and reports the progress of multipart uploads
+// to the visitor. Parts of a resumed upload are only sent again if their
+// content differs. If a visitor is present, multipart uploads are not
+// aborted on failure, as the visitor is expected to keep them for resuming.
+func (bucket S3Bucket) UploadResumable(ctx context.Context, key string, reader io.Reader, size int64, options S3PutOptions, upload *S3MultipartUpload, visitor S3MultipartVisitor) error {
+	options = options.WithDefaults(bucket.Defaults)
+	partSize := bucket.partSize(size)
+	if upload != nil && upload.UploadId != "" && upload.PartSize != partSize {
+		// parts of a different size can not be reused
+		bucket.discardMultipartUpload(ctx, upload)
+	}
+	r := bufio.NewReader(reader)
+	bufSize := partSize
+	if size >= 0 && size < partSize {
+		// small content is not given a whole part, the additional byte
+		// tells whether the size is exceeded
+		bufSize = size + 1
+	}
+	buf := make([]byte, bufSize)
+	n, err := io.ReadFull(r, buf)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
 		return err
 	}
-	b, err := io.ReadAll(file)
+	if int64(n) == bufSize && bufSize < partSize {
+		// the content exceeds its size, i.e. of a growing file
+		buf = append(buf, make([]byte, partSize-bufSize)...)
+		m, err := io.ReadFull(r, buf[n:])
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return err
+		}
+		n += m
+	}
+	if options.ContentType == "" {
+		options.ContentType = DetectContentType(key, buf[:n])
+	}
+	single := int64(n) < partSize
+	if !single {
+		_, err = r.Peek(1)
+		single = err == io.EOF
+	}
+	if single {
+		if upload != nil && upload.UploadId != "" {
+			bucket.discardMultipartUpload(ctx, upload)
+		}
+		return bucket.put(ctx, key, buf[:n], options.header())
+	}
+	if upload == nil {
+		upload = &S3MultipartUpload{}
+	}
+	upload.Key = key
+	upload.PartSize = partSize
+	return bucket.uploadMultipart(ctx, upload, r, buf, options.header(), visitor)
+}
+
+// DetectContentType determines the media type by the extension of the key,
+// falling back to sniffing the leading content.
+func DetectContentType(key string, content []byte) string {
+	if ct := mime.TypeByExtension(path.Ext(key)); ct != "" {
+		return ct
+	}
+	if len(content) > 512 {
+		content = content[:512]
+	}
+	return http.DetectContentType(content)
+}
+
+func (bucket S3Bucket) partSize(size int64) int64 {
+	partSize := bucket.PartSize
+	if partSize <= 0 {
+		partSize = DefaultPartSize
+	}
+	if partSize < MinPartSize {
+		partSize = MinPartSize
+	}
+	// grow parts for large content of known size to stay within the part limit
+	for size > 0 && size/partSize >= MaxParts {
+		partSize *= 2
+	}
+	return partSize
+}
+
+func (bucket S3Bucket) put(ctx context.Context, key string, content []byte, header map[string]string) error {
+	reqUrl, err := url.Parse(bucket.Endpoint + "/" + key)
 	if err != nil {
 		return err
 	}
-	_, err = curl(bucket, "PUT", reqUrl, bytes.NewReader(b))
+	_, err = curl(ctx, bucket, "PUT", reqUrl, bytes.NewReader(content), header)
 	return err
 }
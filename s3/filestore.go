@@ -0,0 +1,362 @@
+package s3
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	// metaSuffix denotes the files next to stored objects holding their
+	// header information
+	metaSuffix = ".s3meta"
+	tempSuffix = ".s3tmp"
+)
+
+// FileStore keeps objects as files below a root directory, the keys' slashes
+// separate directories. Header information and user metadata are stored in
+// a JSON file next to each object, named like the object with suffix .s3meta.
+// Keys like a and a/b can not coexist, a is either a file or a directory,
+// hence storing the second one fails.
+type FileStore struct {
+	Root     string
+	Defaults S3PutOptions
+}
+
+// errUnsafeKey is returned for keys which do not map to a file below the root.
+var errUnsafeKey = errors.New("can not be stored in a directory")
+
+type fileMeta struct {
+	ETag    string
+	Options S3PutOptions
+}
+
+func NewFileStore(root string) *FileStore {
+	return &FileStore{Root: root}
+}
+
+// path maps a key to the path of its file, keys which can not be mapped to
+// a file below the root are refused.
+func (store *FileStore) path(key string) (string, error) {
+	if key == "" || strings.ContainsRune(key, 0) || strings.HasSuffix(key, metaSuffix) || strings.HasSuffix(key, tempSuffix) {
+		return "", fmt.Errorf("key %q %w", key, errUnsafeKey)
+	}
+	if !safeSegments(key) {
+		return "", fmt.Errorf("key %q %w", key, errUnsafeKey)
+	}
+	return filepath.Join(store.Root, filepath.FromSlash(key)), nil
+}
+
+// safeSegments tells whether each segment of the slash separated path names
+// a file within its directory.
+func safeSegments(s string) bool {
+	for _, seg := range strings.Split(s, "/") {
+		if seg == "" || seg == "." || seg == ".." || strings.ContainsRune(seg, os.PathSeparator) || filepath.VolumeName(seg) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+func (store *FileStore) List(ctx context.Context, prefix string, fetchSize int, visitor S3ListBucketResultVisitor) error {
+	return store.ListFrom(ctx, prefix, "", fetchSize, visitor)
+}
+
+func (store *FileStore) ListFrom(ctx context.Context, prefix string, continuationToken string, fetchSize int, visitor S3ListBucketResultVisitor) error {
+	items, err := store.items(ctx, prefix)
+	if err != nil {
+		return err
+	}
+	return visitItems(items, prefix, continuationToken, fetchSize, visitor)
+}
+
+// items returns all objects with the prefix sorted by key.
+func (store *FileStore) items(ctx context.Context, prefix string) ([]S3Item, error) {
+	// only the directory holding all keys with the prefix is walked
+	start := store.Root
+	items := make([]S3Item, 0)
+	if i := strings.LastIndex(prefix, "/"); i >= 0 {
+		// no stored key starts with segments refused by path, which must
+		// not lead the walk out of the root either
+		if !safeSegments(prefix[:i]) {
+			return items, nil
+		}
+		start = filepath.Join(store.Root, filepath.FromSlash(prefix[:i]))
+	}
+	err := filepath.Walk(start, func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if !fi.Mode().IsRegular() || strings.HasSuffix(p, metaSuffix) || strings.HasSuffix(p, tempSuffix) {
+			return nil
+		}
+		rel, err := filepath.Rel(store.Root, p)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+		if !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+		meta := store.readMeta(p)
+		items = append(items, S3Item{
+			Key:          key,
+			LastModified: fi.ModTime().UTC(),
+			ETag:         meta.ETag,
+			Size:         fi.Size(),
+			StorageClass: "STANDARD",
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	// keys are ordered differently than walked paths, i.e. a/b and a-c
+	sort.Slice(items, func(i, j int) bool { return items[i].Key < items[j].Key })
+	return items, nil
+}
+
+// readMeta reads the header information of an object, it is empty for
+// files which have not been stored by this store.
+func (store *FileStore) readMeta(p string) fileMeta {
+	var meta fileMeta
+	b, err := ioutil.ReadFile(p + metaSuffix)
+	if err == nil {
+		json.Unmarshal(b, &meta)
+	}
+	return meta
+}
+
+func (store *FileStore) open(key string) (*os.File, *S3Object, error) {
+	p, err := store.path(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	f, err := os.Open(p)
+	if os.IsNotExist(err) {
+		return nil, nil, fmt.Errorf("%s: %w", key, ErrNoSuchKey)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	fi, err := f.Stat()
+	if err == nil && !fi.Mode().IsRegular() {
+		err = fmt.Errorf("%s: %w", key, ErrNoSuchKey)
+	}
+	if err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	meta := store.readMeta(p)
+	obj := &S3Object{
+		Key:             key,
+		Size:            fi.Size(),
+		ContentType:     meta.Options.ContentType,
+		ContentEncoding: meta.Options.ContentEncoding,
+		ETag:            meta.ETag,
+		LastModified:    fi.ModTime().UTC(),
+		Metadata:        make(map[string]string),
+	}
+	for k, v := range meta.Options.Metadata {
+		obj.Metadata[k] = v
+	}
+	if obj.ContentType == "" {
+		obj.ContentType = DetectContentType(key, nil)
+	}
+	return f, obj, nil
+}
+
+func (store *FileStore) Head(ctx context.Context, key string) (*S3Object, error) {
+	f, obj, err := store.open(key)
+	if err != nil {
+		return nil, err
+	}
+	f.Close()
+	return obj, nil
+}
+
+func (store *FileStore) Get(ctx context.Context, key string, byteRange string) (*S3Object, error) {
+	f, obj, err := store.open(key)
+	if err != nil {
+		return nil, err
+	}
+	obj.Body = f
+	if byteRange == "" {
+		return obj, nil
+	}
+	start, end, err := parseByteRange(byteRange, obj.Size)
+	if err == nil {
+		_, err = f.Seek(start, io.SeekStart)
+	}
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	obj.ContentRange = contentRange(start, end, obj.Size)
+	obj.Size = end - start + 1
+	obj.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.LimitReader(f, obj.Size), f}
+	return obj, nil
+}
+
+// Put writes the content to a temporary file first, which replaces the
+// object once it is complete.
+func (store *FileStore) Put(ctx context.Context, key string, reader io.Reader, size int64, options S3PutOptions) error {
+	p, err := store.path(key)
+	if err != nil {
+		return err
+	}
+	options = options.WithDefaults(store.Defaults)
+	head := make([]byte, 512)
+	n, err := io.ReadFull(reader, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return err
+	}
+	if options.ContentType == "" {
+		options.ContentType = DetectContentType(key, head[:n])
+	}
+	return store.write(ctx, p, io.MultiReader(bytes.NewReader(head[:n]), reader), options, "")
+}
+
+// putOptions returns the header information an object has been stored with.
+func (store *FileStore) putOptions(key string) (S3PutOptions, error) {
+	p, err := store.path(key)
+	if err != nil {
+		return S3PutOptions{}, err
+	}
+	return store.readMeta(p).Options, nil
+}
+
+// putTags replaces the tags of an object.
+func (store *FileStore) putTags(key string, tags map[string]string) error {
+	f, _, err := store.open(key)
+	if err != nil {
+		return err
+	}
+	f.Close()
+	p, _ := store.path(key)
+	meta := store.readMeta(p)
+	meta.Options.Tags = tags
+	b, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(p+metaSuffix, b, 0644)
+}
+
+// write stores the content under the path p, the ETag is the MD5 checksum
+// of the content unless specified.
+func (store *FileStore) write(ctx context.Context, p string, reader io.Reader, options S3PutOptions, etag string) error {
+	err := os.MkdirAll(filepath.Dir(p), 0755)
+	if err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(filepath.Dir(p), "."+filepath.Base(p)+".*"+tempSuffix)
+	if err != nil {
+		return err
+	}
+	hash := md5.New()
+	_, err = io.Copy(io.MultiWriter(f, hash), &contextReader{ctx: ctx, r: reader})
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Chmod(f.Name(), 0644)
+	}
+	var meta []byte
+	if err == nil {
+		if etag == "" {
+			etag = fmt.Sprintf("\"%x\"", hash.Sum(nil))
+		}
+		meta, err = json.Marshal(fileMeta{ETag: etag, Options: options})
+	}
+	if err == nil {
+		err = ioutil.WriteFile(p+metaSuffix, meta, 0644)
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), p)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
+
+// contextReader stops reading once the context is done.
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (cr *contextReader) Read(b []byte) (int, error) {
+	if err := cr.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return cr.r.Read(b)
+}
+
+// Delete removes objects and the directories becoming empty thereby.
+func (store *FileStore) Delete(ctx context.Context, visitor S3DeleteResultVisitor, keys ...string) error {
+	var rlt S3DeleteResult
+	for _, key := range keys {
+		err := store.remove(key)
+		if err != nil {
+			rlt.Error = append(rlt.Error, S3Deleted{Key: key, Code: "InternalError", Message: err.Error()})
+			continue
+		}
+		rlt.Deleted = append(rlt.Deleted, S3Deleted{Key: key})
+	}
+	return visitor.VisitDeletion(&rlt)
+}
+
+func (store *FileStore) remove(key string) error {
+	p, err := store.path(key)
+	if err != nil {
+		return err
+	}
+	// deleting missing objects succeeds like with S3
+	if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := os.Remove(p + metaSuffix); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	root := filepath.Clean(store.Root)
+	for dir := filepath.Dir(p); dir != root && strings.HasPrefix(dir, root); dir = filepath.Dir(dir) {
+		if os.Remove(dir) != nil {
+			break
+		}
+	}
+	return nil
+}
+
+func (store *FileStore) Copy(ctx context.Context, sourceKey string, targetKey string) error {
+	p, err := store.path(targetKey)
+	if err != nil {
+		return err
+	}
+	f, _, err := store.open(sourceKey)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	meta := store.readMeta(f.Name())
+	return store.write(ctx, p, f, meta.Options, "")
+}
@@ -0,0 +1,68 @@
+package s3
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// collectingVisitor gathers the keys and the pages of listings.
+type collectingVisitor struct {
+	keys  []string
+	pages []*S3ListBucketResult
+}
+
+func (cv *collectingVisitor) VisitListing(partialResult *S3ListBucketResult) (bool, error) {
+	cv.pages = append(cv.pages, partialResult)
+	for _, item := range partialResult.Contents {
+		cv.keys = append(cv.keys, item.Key)
+	}
+	return true, nil
+}
+
+func writeFile(t *testing.T, p string, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(p, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFileStoreListStaysBelowRoot(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "secret", "passwd.txt"), "secret")
+	writeFile(t, filepath.Join(dir, "data", "bucket", "a.txt"), "a")
+	store := NewFileStore(filepath.Join(dir, "data", "bucket"))
+
+	for _, prefix := range []string{"../../secret/", "../", "./", "a/../../", "/", "//secret/", ".."} {
+		visitor := &collectingVisitor{}
+		err := store.List(context.Background(), prefix, 100, visitor)
+		if err != nil {
+			t.Fatalf("listing %q failed: %v", prefix, err)
+		}
+		if len(visitor.keys) != 0 {
+			t.Errorf("listing %q returned %v, expected no keys", prefix, visitor.keys)
+		}
+	}
+	visitor := &collectingVisitor{}
+	if err := store.List(context.Background(), "", 100, visitor); err != nil {
+		t.Fatal(err)
+	}
+	if len(visitor.keys) != 1 || visitor.keys[0] != "a.txt" {
+		t.Errorf("listing the bucket returned %v, expected [a.txt]", visitor.keys)
+	}
+}
+
+func TestFileStoreKeyAndPrefixCanNotCoexist(t *testing.T) {
+	store := NewFileStore(t.TempDir())
+	put(t, store, "a", "a", S3PutOptions{})
+	err := store.Put(context.Background(), "a/b", strings.NewReader("b"), 1, S3PutOptions{})
+	if err == nil {
+		t.Error("storing a/b next to a succeeded")
+	}
+}
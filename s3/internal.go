@@ -2,14 +2,17 @@ package s3
 
 import (
 	"bytes"
+	"context"
 	"crypto/hmac"
 	"crypto/md5"
 	"crypto/sha256"
 	"encoding/base64"
+	"encoding/xml"
 	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"net"
 	"net/http"
 	"net/url"
 	"sort"
@@ -18,44 +21,119 @@ import (
 	"time"
 )
 
-func curl(bucket S3Bucket, method string, reqUrl *url.URL, payload io.Reader) (*bytes.Buffer, error) {
+// responses are streamed, hence only connecting and waiting for the
+// response header are bounded in time
+var httpClient = &http.Client{
+	Transport: &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           (&net.Dialer{Timeout: time.Second * time.Duration(10)}).DialContext,
+		TLSHandshakeTimeout:   time.Second * time.Duration(10),
+		ResponseHeaderTimeout: time.Second * time.Duration(10),
+	},
+}
+
+// cleanupContext bounds requests cleaning up after failures, they are sent
+// even if the failed operation has been cancelled.
+func cleanupContext() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), 30*time.Second)
+}
+
+func curl(ctx context.Context, bucket S3Bucket, method string, reqUrl *url.URL, payload io.Reader, extraHeader map[string]string) (*bytes.Buffer, error) {
+	resp, err := send(ctx, bucket, method, reqUrl, payload, extraHeader)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	buf := new(bytes.Buffer)
+	_, err = buf.ReadFrom(resp.Body)
+	return buf, err
+}
+
+func send(ctx context.Context, bucket S3Bucket, method string, reqUrl *url.URL, payload io.Reader, extraHeader map[string]string) (*http.Response, error) {
 	/*
 	 * perform http request
 	 *
 	 */
-	req, err := http.NewRequest(method, reqUrl.String(), payload)
+	req, err := http.NewRequestWithContext(ctx, method, reqUrl.String(), payload)
 	if err != nil {
 		return nil, err
 	}
-	client := &http.Client{
-		Timeout: time.Second * time.Duration(10),
+	// write header to request, x-amz-* headers need to be present before signing
+	req.Header.Set("User-Agent", "s3 cli")
+	req.Header.Set("Accept", "*/*")
+	req.Header.Set("Accept-Encoding", "gzip, deflate, br")
+	req.Header.Set("Connection", "keep-alive")
+	for k, v := range extraHeader {
+		req.Header.Set(k, v)
+	}
+	// signed once throttled, as requests signed long before are refused
+	err = bucket.Throttle.waitForRequest(ctx)
+	if err != nil {
+		return nil, err
 	}
 	header, err := signAwsV4(bucket, req, time.Now().UTC())
 	if err != nil {
 		return nil, err
 	}
-	// write header to request
-	req.Header.Set("User-Agent", "s3 cli")
-	req.Header.Set("Accept", "*/*")
-	req.Header.Set("Accept-Encoding", "gzip, deflate, br")
-	req.Header.Set("Connection", "keep-alive")
 	for k, v := range header {
 		req.Header.Set(k, v)
 	}
-
-	resp, err := client.Do(req)
+	if req.Body != nil && req.Body != http.NoBody {
+		req.Body = bucket.Throttle.readCloser(ctx, req.Body)
+	}
+	resp, err := httpClient.Do(req)
 	if err != nil {
 		return nil, err
 	}
+	resp.Body = bucket.Throttle.readCloser(ctx, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		defer resp.Body.Close()
+		buf := new(bytes.Buffer)
+		buf.ReadFrom(resp.Body)
+		return nil, &responseError{status: resp.StatusCode, body: buf.String()}
+	}
+	return resp, nil
+}
 
-	defer resp.Body.Close()
-	buf := new(bytes.Buffer)
-	buf.ReadFrom(resp.Body)
-	err = nil
-	if resp.StatusCode != 200 {
-		err = errors.New("http response was: " + strconv.Itoa(resp.StatusCode) + " / " + buf.String())
+// responseError is returned for responses of failed requests.
+type responseError struct {
+	status int
+	body   string
+}
+
+func (e *responseError) Error() string {
+	return "http response was: " + strconv.Itoa(e.status) + " / " + e.body
+}
+
+// hasErrorCode tells whether the request failed with the S3 error code.
+func hasErrorCode(err error, code string) bool {
+	var e *responseError
+	if !errors.As(err, &e) {
+		return false
 	}
-	return buf, err
+	var rlt S3Error
+	return xml.Unmarshal([]byte(e.body), &rlt) == nil && rlt.Code == code
+}
+
+// sendStreaming sends a request whose payload is streamed unsigned, the
+// response is returned whatever its status.
+func sendStreaming(ctx context.Context, bucket S3Bucket, req *http.Request) (*http.Response, error) {
+	err := bucket.Throttle.waitForRequest(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range signAwsV4Payload(bucket, req, time.Now().UTC(), unsignedPayload) {
+		req.Header.Set(k, v)
+	}
+	if req.Body != nil && req.Body != http.NoBody {
+		req.Body = bucket.Throttle.readCloser(ctx, req.Body)
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = bucket.Throttle.readCloser(ctx, resp.Body)
+	return resp, nil
 }
 
 /*
@@ -64,9 +142,6 @@ func curl(bucket S3Bucket, method string, reqUrl *url.URL, payload io.Reader) (*
  *
  */
 func signAwsV4(b S3Bucket, req *http.Request, now time.Time) (map[string]string, error) {
-	header := make(map[string]string)
-	header["X-Amz-Date"] = now.Format("20060102T150405Z")
-
 	/*
 	 * read payload content
 	 *
@@ -85,63 +160,116 @@ func signAwsV4(b S3Bucket, req *http.Request, now time.Time) (map[string]string,
 
 	hash := sha256.New()
 	hash.Write(content)
-	contentHash := fmt.Sprintf("%x", hash.Sum(nil))
-	header["X-Amz-Content-Sha256"] = contentHash
+	header := signAwsV4Payload(b, req, now, fmt.Sprintf("%x", hash.Sum(nil)))
 
 	/*
-	 * compute signing content
+	 * create MD5 checksum of content
 	 *
 	 */
+	hash = md5.New()
+	hash.Write([]byte(content))
+	header["Content-MD5"] = base64.StdEncoding.EncodeToString(hash.Sum(nil))
+
+	return header, nil
+}
+
+// signAwsV4Payload signs a request whose payload is described by its hash,
+// which is unsignedPayload for payloads streamed without being read before.
+func signAwsV4Payload(b S3Bucket, req *http.Request, now time.Time, contentHash string) map[string]string {
+	header := make(map[string]string)
+	for k := range req.Header {
+		if strings.HasPrefix(strings.ToLower(k), "x-amz-") {
+			header[k] = strings.TrimSpace(req.Header.Get(k))
+		}
+	}
+	header["X-Amz-Date"] = now.Format(awsV4TimeFormat)
+	header["X-Amz-Content-Sha256"] = contentHash
+
+	canonicalHeader := map[string]string{"host": req.URL.Host}
+	for k, v := range header {
+		canonicalHeader[k] = v
+	}
+	canonical, signedHeaders := canonicalRequest(req.Method, req.URL.Path, req.URL.Query(), canonicalHeader, contentHash)
+	scope := credentialScope(now, b.Region)
+	signature := signAwsV4Content(signingKey(b.SecretKey, now, b.Region), now, scope, canonical)
+	header["Authorization"] = awsV4Algorithm + " Credential=" + b.AccessKeyId + "/" + scope + ", SignedHeaders=" + signedHeaders + ", Signature=" + signature
+	return header
+}
+
+const (
+	awsV4Algorithm  = "AWS4-HMAC-SHA256"
+	awsV4TimeFormat = "20060102T150405Z"
+	awsV4DateFormat = "20060102"
+	unsignedPayload = "UNSIGNED-PAYLOAD"
+)
+
+// canonicalRequest builds the canonical form of a request signed by
+// signAwsV4 and the list of its signed headers, header holds the names and
+// values of all headers to sign, i.e. host and the x-amz-* headers.
+func canonicalRequest(method string, path string, query url.Values, header map[string]string, contentHash string) (string, string) {
 	// HTTPMethod
-	canonicalRequest := strings.ToUpper(req.Method)
+	canonical := strings.ToUpper(method)
 	// CanonicalURI
-	canonicalRequest += "\n" + strings.ReplaceAll(req.URL.Path, "=", "%3D")
+	canonical += "\n" + uriEncodePath(path)
 	// CanonicalQueryString
-	query := req.URL.Query()
-	if len(query) == 0 {
-		canonicalRequest += "\n"
-	} else {
-		canonicalRequest += "\n" + query.Encode()
-	}
+	canonical += "\n" + canonicalQuery(query)
 	// CanonicalHeaders
-	signedHeaders := "host"
-	canonicalRequest += "\n" + "host:" + req.URL.Host
 	keys := make([]string, 0, len(header))
 	for k := range header {
 		keys = append(keys, k)
 	}
-	sort.Strings(keys)
+	// headers are ordered by their lower case names
+	sort.Slice(keys, func(i, j int) bool { return strings.ToLower(keys[i]) < strings.ToLower(keys[j]) })
+	signedHeaders := make([]string, 0, len(keys))
 	for _, k := range keys {
 		kl := strings.ToLower(k)
-		if strings.HasPrefix(kl, "x-amz-") {
-			signedHeaders += ";" + kl
-			canonicalRequest += "\n" + kl + ":" + header[k]
-		}
+		signedHeaders = append(signedHeaders, kl)
+		canonical += "\n" + kl + ":" + header[k]
 	}
-	canonicalRequest += "\n"
+	canonical += "\n"
 	// SignedHeaders
-	canonicalRequest += "\n" + signedHeaders
+	canonical += "\n" + strings.Join(signedHeaders, ";")
 	// HashedPayload
-	canonicalRequest += "\n" + contentHash
+	canonical += "\n" + contentHash
+	return canonical, strings.Join(signedHeaders, ";")
+}
 
-	signingContent := "AWS4-HMAC-SHA256"
-	signingContent += "\n" + now.Format("20060102T150405Z")
-	scope := now.Format("20060102") + "/" + b.Region + "/s3/aws4_request"
-	signingContent += "\n" + scope
-	hash = sha256.New()
-	hash.Write([]byte(canonicalRequest))
-	signingContent += "\n" + fmt.Sprintf("%x", hash.Sum(nil))
+// canonicalQuery encodes the query sorted by key and with spaces as %20.
+func canonicalQuery(query url.Values) string {
+	// url.Values.Encode escapes a literal plus, which is left for spaces
+	return strings.ReplaceAll(query.Encode(), "+", "%20")
+}
 
-	/*
-	 * compute signing key
-	 *
-	 */
-	mac := hmac.New(sha256.New, []byte("AWS4"+b.SecretKey))
-	mac.Write([]byte(now.Format("20060102")))
+// uriEncodePath escapes all bytes of a path except slashes and the
+// unreserved characters of RFC 3986.
+func uriEncodePath(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9', c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/':
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func credentialScope(now time.Time, region string) string {
+	return now.Format(awsV4DateFormat) + "/" + region + "/s3/aws4_request"
+}
+
+// signingKey derives the key signing all requests of a day in a region.
+func signingKey(secretKey string, now time.Time, region string) []byte {
+	mac := hmac.New(sha256.New, []byte("AWS4"+secretKey))
+	mac.Write([]byte(now.Format(awsV4DateFormat)))
 	dateKey := mac.Sum(nil)
 
 	mac = hmac.New(sha256.New, dateKey)
-	mac.Write([]byte(b.Region))
+	mac.Write([]byte(region))
 	dateRegionKey := mac.Sum(nil)
 
 	mac = hmac.New(sha256.New, dateRegionKey)
@@ -150,24 +278,18 @@ func signAwsV4(b S3Bucket, req *http.Request, now time.Time) (map[string]string,
 
 	mac = hmac.New(sha256.New, dateRegionServiceKey)
 	mac.Write([]byte("aws4_request"))
-	signingKey := mac.Sum(nil)
-
-	/*
-	 * create signature
-	 *
-	 */
-	mac = hmac.New(sha256.New, []byte(signingKey))
-	mac.Write([]byte(signingContent))
-	signature := fmt.Sprintf("%x", mac.Sum(nil))
-	header["Authorization"] = "AWS4-HMAC-SHA256 Credential=" + b.AccessKeyId + "/" + scope + ", SignedHeaders=" + signedHeaders + ", Signature=" + signature
+	return mac.Sum(nil)
+}
 
-	/*
-	 * create MD5 checksum of content
-	 *
-	 */
-	hash = md5.New()
-	hash.Write([]byte(content))
-	header["Content-MD5"] = base64.StdEncoding.EncodeToString(hash.Sum(nil))
+// signAwsV4Content signs the string to sign derived from a canonical request.
+func signAwsV4Content(key []byte, now time.Time, scope string, canonical string) string {
+	signingContent := awsV4Algorithm
+	signingContent += "\n" + now.Format(awsV4TimeFormat)
+	signingContent += "\n" + scope
+	hash := sha256.Sum256([]byte(canonical))
+	signingContent += "\n" + fmt.Sprintf("%x", hash)
 
-	return header, nil
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(signingContent))
+	return fmt.Sprintf("%x", mac.Sum(nil))
 }
@@ -0,0 +1,482 @@
+package s3
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// S3LifecycleConfiguration holds the lifecycle rules of a bucket in a form
+// friendlier than the XML of S3, i.e. for YAML and JSON files.
+type S3LifecycleConfiguration struct {
+	Rules []S3LifecycleRule `json:"rules" yaml:"rules"`
+}
+
+// S3LifecycleRule applies its actions to the objects matching all of its
+// filters: the prefix, the tags and the size range, whose bounds are
+// exclusive.
+type S3LifecycleRule struct {
+	ID string `json:"id,omitempty" yaml:"id,omitempty"`
+	// Status is either Enabled or Disabled, Enabled if empty.
+	Status string            `json:"status,omitempty" yaml:"status,omitempty"`
+	Prefix string            `json:"prefix,omitempty" yaml:"prefix,omitempty"`
+	Tags   map[string]string `json:"tags,omitempty" yaml:"tags,omitempty"`
+	// ObjectSizeGreaterThan and ObjectSizeLessThan bound the size of the objects if positive.
+	ObjectSizeGreaterThan int64 `json:"objectSizeGreaterThan,omitempty" yaml:"objectSizeGreaterThan,omitempty"`
+	ObjectSizeLessThan    int64 `json:"objectSizeLessThan,omitempty" yaml:"objectSizeLessThan,omitempty"`
+
+	Transitions                    []S3LifecycleTransition           `json:"transitions,omitempty" yaml:"transitions,omitempty"`
+	Expiration                     *S3LifecycleExpiration            `json:"expiration,omitempty" yaml:"expiration,omitempty"`
+	NoncurrentVersionTransitions   []S3NoncurrentVersionTransition   `json:"noncurrentVersionTransitions,omitempty" yaml:"noncurrentVersionTransitions,omitempty"`
+	NoncurrentVersionExpiration    *S3NoncurrentVersionExpiration    `json:"noncurrentVersionExpiration,omitempty" yaml:"noncurrentVersionExpiration,omitempty"`
+	AbortIncompleteMultipartUpload *S3AbortIncompleteMultipartUpload `json:"abortIncompleteMultipartUpload,omitempty" yaml:"abortIncompleteMultipartUpload,omitempty"`
+}
+
+// S3LifecycleTransition moves objects to the storage class after a number
+// of days since their creation or at a date like 2027-01-01.
+type S3LifecycleTransition struct {
+	Days         int    `xml:"Days,omitempty" json:"days,omitempty" yaml:"days,omitempty"`
+	Date         string `xml:"Date,omitempty" json:"date,omitempty" yaml:"date,omitempty"`
+	StorageClass string `xml:"StorageClass" json:"storageClass" yaml:"storageClass"`
+}
+
+// S3LifecycleExpiration deletes objects after a number of days since their
+// creation or at a date, or it removes delete markers without versions.
+type S3LifecycleExpiration struct {
+	Days                      int    `xml:"Days,omitempty" json:"days,omitempty" yaml:"days,omitempty"`
+	Date                      string `xml:"Date,omitempty" json:"date,omitempty" yaml:"date,omitempty"`
+	ExpiredObjectDeleteMarker bool   `xml:"ExpiredObjectDeleteMarker,omitempty" json:"expiredObjectDeleteMarker,omitempty" yaml:"expiredObjectDeleteMarker,omitempty"`
+}
+
+// S3NoncurrentVersionTransition moves versions to the storage class a
+// number of days after they became noncurrent, keeping the newest ones.
+type S3NoncurrentVersionTransition struct {
+	NoncurrentDays          int    `xml:"NoncurrentDays" json:"noncurrentDays" yaml:"noncurrentDays"`
+	NewerNoncurrentVersions int    `xml:"NewerNoncurrentVersions,omitempty" json:"newerNoncurrentVersions,omitempty" yaml:"newerNoncurrentVersions,omitempty"`
+	StorageClass            string `xml:"StorageClass" json:"storageClass" yaml:"storageClass"`
+}
+
+// S3NoncurrentVersionExpiration deletes versions a number of days after
+// they became noncurrent, keeping the newest ones.
+type S3NoncurrentVersionExpiration struct {
+	NoncurrentDays          int `xml:"NoncurrentDays" json:"noncurrentDays" yaml:"noncurrentDays"`
+	NewerNoncurrentVersions int `xml:"NewerNoncurrentVersions,omitempty" json:"newerNoncurrentVersions,omitempty" yaml:"newerNoncurrentVersions,omitempty"`
+}
+
+type S3AbortIncompleteMultipartUpload struct {
+	DaysAfterInitiation int `xml:"DaysAfterInitiation" json:"daysAfterInitiation" yaml:"daysAfterInitiation"`
+}
+
+// states of lifecycle rules
+const (
+	LifecycleEnabled  = "Enabled"
+	LifecycleDisabled = "Disabled"
+)
+
+const maxLifecycleRules = 1000
+
+// transitionOrder ranks the storage classes objects can be transitioned to,
+// objects can only be moved to classes of a higher rank.
+var transitionOrder = map[string]int{
+	"STANDARD_IA":         1,
+	"INTELLIGENT_TIERING": 1,
+	"ONEZONE_IA":          2,
+	"GLACIER_IR":          3,
+	"GLACIER":             4,
+	"DEEP_ARCHIVE":        5,
+}
+
+// minTransitionDays are the minimum days of transitions to the classes
+// whose objects are charged for at least 30 days.
+var minTransitionDays = map[string]int{
+	"STANDARD_IA": 30,
+	"ONEZONE_IA":  30,
+}
+
+// ParseLifecycleDate parses dates of lifecycle rules, which are midnight UTC
+// given as 2027-01-01 or in ISO 8601.
+func ParseLifecycleDate(s string) (time.Time, error) {
+	t, err := time.Parse("2006-01-02", s)
+	if err != nil {
+		t, err = time.Parse(time.RFC3339, s)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid date '%s' (expected i.e. 2027-01-01)", s)
+		}
+	}
+	if !t.Equal(t.UTC().Truncate(24 * time.Hour)) {
+		return time.Time{}, fmt.Errorf("date '%s' is not midnight UTC", s)
+	}
+	return t.UTC(), nil
+}
+
+// WithDefaults enables the rules without status.
+func (config S3LifecycleConfiguration) WithDefaults() S3LifecycleConfiguration {
+	rules := make([]S3LifecycleRule, len(config.Rules))
+	for i, rule := range config.Rules {
+		if rule.Status == "" {
+			rule.Status = LifecycleEnabled
+		}
+		rules[i] = rule
+	}
+	return S3LifecycleConfiguration{Rules: rules}
+}
+
+// Validate checks the rules like S3 does before accepting them, all
+// problems are reported at once.
+func (config S3LifecycleConfiguration) Validate() error {
+	var problems []string
+	if len(config.Rules) == 0 {
+		problems = append(problems, "at least one rule is required")
+	}
+	if len(config.Rules) > maxLifecycleRules {
+		problems = append(problems, fmt.Sprintf("%d rules exceed the maximum of %d rules", len(config.Rules), maxLifecycleRules))
+	}
+	ids := make(map[string]bool)
+	for i, rule := range config.Rules {
+		name := fmt.Sprintf("rule %d", i+1)
+		if rule.ID != "" {
+			name = fmt.Sprintf("rule '%s'", rule.ID)
+			if ids[rule.ID] {
+				problems = append(problems, name+": the id is not unique")
+			}
+			ids[rule.ID] = true
+		}
+		for _, p := range rule.problems() {
+			problems = append(problems, name+": "+p)
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid lifecycle configuration:\n  %s", strings.Join(problems, "\n  "))
+	}
+	return nil
+}
+
+func (rule S3LifecycleRule) problems() []string {
+	var problems []string
+	add := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+	date := func(s string) {
+		if _, err := ParseLifecycleDate(s); err != nil {
+			add("%v", err)
+		}
+	}
+
+	if len(rule.ID) > 255 {
+		add("the id exceeds 255 characters")
+	}
+	if rule.Status != "" && rule.Status != LifecycleEnabled && rule.Status != LifecycleDisabled {
+		add("invalid status '%s' - allowed values are: %s or %s", rule.Status, LifecycleEnabled, LifecycleDisabled)
+	}
+	for k, v := range rule.Tags {
+		if k == "" || len([]rune(k)) > MaxTagKeyLength || len([]rune(v)) > MaxTagValueLength {
+			add("invalid tag filter '%s=%s'", k, v)
+		}
+	}
+	if rule.ObjectSizeGreaterThan < 0 || rule.ObjectSizeLessThan < 0 {
+		add("object sizes must not be negative")
+	}
+	if rule.ObjectSizeLessThan > 0 && rule.ObjectSizeGreaterThan >= rule.ObjectSizeLessThan {
+		add("the size range from %d to %d is empty", rule.ObjectSizeGreaterThan, rule.ObjectSizeLessThan)
+	}
+	if len(rule.Transitions) == 0 && rule.Expiration == nil && len(rule.NoncurrentVersionTransitions) == 0 && rule.NoncurrentVersionExpiration == nil && rule.AbortIncompleteMultipartUpload == nil {
+		add("at least one action is required")
+	}
+
+	// transitions have to move objects down to cheaper classes over time
+	transitions := append([]S3LifecycleTransition{}, rule.Transitions...)
+	byDays := true
+	for _, t := range transitions {
+		_, ok := transitionOrder[t.StorageClass]
+		switch {
+		case !ok:
+			add("invalid storage class '%s' of transition", t.StorageClass)
+		case (t.Days > 0) == (t.Date != ""):
+			add("transition to %s requires either days or a date", t.StorageClass)
+		case t.Date != "":
+			byDays = false
+			date(t.Date)
+		case t.Days < minTransitionDays[t.StorageClass]:
+			add("transition to %s requires at least %d days", t.StorageClass, minTransitionDays[t.StorageClass])
+		}
+	}
+	if byDays {
+		sort.SliceStable(transitions, func(i, j int) bool { return transitions[i].Days < transitions[j].Days })
+		for i := 1; i < len(transitions); i++ {
+			a, b := transitions[i-1], transitions[i]
+			if a.Days == b.Days {
+				add("transitions to %s and %s are both after %d days", a.StorageClass, b.StorageClass, a.Days)
+			} else if transitionOrder[a.StorageClass] >= transitionOrder[b.StorageClass] {
+				add("transition to %s after %d days can not follow the transition to %s", b.StorageClass, b.Days, a.StorageClass)
+			}
+		}
+	}
+
+	if e := rule.Expiration; e != nil {
+		n := 0
+		for _, set := range []bool{e.Days != 0, e.Date != "", e.ExpiredObjectDeleteMarker} {
+			if set {
+				n++
+			}
+		}
+		switch {
+		case n != 1:
+			add("expiration requires exactly one of days, date or expiredObjectDeleteMarker")
+		case e.Days < 0:
+			add("expiration days must be positive")
+		case e.Date != "":
+			date(e.Date)
+		case e.ExpiredObjectDeleteMarker && len(rule.Tags) > 0:
+			add("expiredObjectDeleteMarker can not be combined with a tag filter")
+		}
+		for _, t := range rule.Transitions {
+			if e.Days > 0 && t.Days >= e.Days {
+				add("transition to %s after %d days is not before the expiration after %d days", t.StorageClass, t.Days, e.Days)
+			}
+		}
+	}
+
+	for _, t := range rule.NoncurrentVersionTransitions {
+		if _, ok := transitionOrder[t.StorageClass]; !ok {
+			add("invalid storage class '%s' of noncurrent version transition", t.StorageClass)
+		}
+		if t.NoncurrentDays < minTransitionDays[t.StorageClass] || t.NoncurrentDays < 0 {
+			add("noncurrent version transition to %s requires at least %d days", t.StorageClass, minTransitionDays[t.StorageClass])
+		}
+		if t.NewerNoncurrentVersions < 0 || t.NewerNoncurrentVersions > 100 {
+			add("newerNoncurrentVersions must be 1 to 100")
+		}
+	}
+	if e := rule.NoncurrentVersionExpiration; e != nil {
+		if e.NoncurrentDays <= 0 {
+			add("noncurrent version expiration days must be positive")
+		}
+		if e.NewerNoncurrentVersions < 0 || e.NewerNoncurrentVersions > 100 {
+			add("newerNoncurrentVersions must be 1 to 100")
+		}
+	}
+	if a := rule.AbortIncompleteMultipartUpload; a != nil {
+		if a.DaysAfterInitiation <= 0 {
+			add("days after initiation of incomplete multipart uploads must be positive")
+		}
+		if len(rule.Tags) > 0 {
+			add("aborting incomplete multipart uploads can not be combined with a tag filter")
+		}
+	}
+	return problems
+}
+
+// s3LifecycleXML is the lifecycle configuration as exchanged with S3.
+type s3LifecycleXML struct {
+	XMLName xml.Name             `xml:"http://s3.amazonaws.com/doc/2006-03-01/ LifecycleConfiguration"`
+	Rules   []s3LifecycleRuleXML `xml:"Rule"`
+}
+
+type s3LifecycleRuleXML struct {
+	ID     string            `xml:"ID,omitempty"`
+	Filter s3LifecycleFilter `xml:"Filter"`
+	// Prefix is the filter of rules of the deprecated format without filter.
+	Prefix                         *string                           `xml:"Prefix"`
+	Status                         string                            `xml:"Status"`
+	Transitions                    []S3LifecycleTransition           `xml:"Transition"`
+	Expiration                     *S3LifecycleExpiration            `xml:"Expiration"`
+	NoncurrentVersionTransitions   []S3NoncurrentVersionTransition   `xml:"NoncurrentVersionTransition"`
+	NoncurrentVersionExpiration    *S3NoncurrentVersionExpiration    `xml:"NoncurrentVersionExpiration"`
+	AbortIncompleteMultipartUpload *S3AbortIncompleteMultipartUpload `xml:"AbortIncompleteMultipartUpload"`
+}
+
+// s3LifecycleFilter holds a single condition or the conditions combined by And.
+type s3LifecycleFilter struct {
+	Prefix                *string               `xml:"Prefix"`
+	Tag                   *S3Tag                `xml:"Tag"`
+	ObjectSizeGreaterThan int64                 `xml:"ObjectSizeGreaterThan,omitempty"`
+	ObjectSizeLessThan    int64                 `xml:"ObjectSizeLessThan,omitempty"`
+	And                   *s3LifecycleFilterAnd `xml:"And"`
+}
+
+type s3LifecycleFilterAnd struct {
+	Prefix                string  `xml:"Prefix,omitempty"`
+	Tags                  []S3Tag `xml:"Tag"`
+	ObjectSizeGreaterThan int64   `xml:"ObjectSizeGreaterThan,omitempty"`
+	ObjectSizeLessThan    int64   `xml:"ObjectSizeLessThan,omitempty"`
+}
+
+// lifecycleXMLDate formats dates of rules like S3, i.e. 2027-01-01T00:00:00.000Z.
+func lifecycleXMLDate(s string) string {
+	t, err := ParseLifecycleDate(s)
+	if err != nil {
+		return s
+	}
+	return t.Format("2006-01-02T15:04:05.000Z")
+}
+
+// lifecycleDate is the inverse of lifecycleXMLDate.
+func lifecycleDate(s string) string {
+	t, err := ParseLifecycleDate(s)
+	if err != nil {
+		return s
+	}
+	return t.Format("2006-01-02")
+}
+
+// ParseLifecycleXML reads a lifecycle configuration in the XML format of S3.
+func ParseLifecycleXML(b []byte) (*S3LifecycleConfiguration, error) {
+	var x s3LifecycleXML
+	err := xml.Unmarshal(b, &x)
+	if err != nil {
+		return nil, err
+	}
+	config := &S3LifecycleConfiguration{Rules: make([]S3LifecycleRule, 0, len(x.Rules))}
+	for _, r := range x.Rules {
+		rule := S3LifecycleRule{
+			ID:                             r.ID,
+			Status:                         r.Status,
+			Transitions:                    r.Transitions,
+			Expiration:                     r.Expiration,
+			NoncurrentVersionTransitions:   r.NoncurrentVersionTransitions,
+			NoncurrentVersionExpiration:    r.NoncurrentVersionExpiration,
+			AbortIncompleteMultipartUpload: r.AbortIncompleteMultipartUpload,
+		}
+		f := r.Filter
+		tags := []S3Tag{}
+		switch {
+		case r.Prefix != nil:
+			rule.Prefix = *r.Prefix
+		case f.And != nil:
+			rule.Prefix = f.And.Prefix
+			tags = f.And.Tags
+			rule.ObjectSizeGreaterThan = f.And.ObjectSizeGreaterThan
+			rule.ObjectSizeLessThan = f.And.ObjectSizeLessThan
+		default:
+			if f.Prefix != nil {
+				rule.Prefix = *f.Prefix
+			}
+			if f.Tag != nil {
+				tags = append(tags, *f.Tag)
+			}
+			rule.ObjectSizeGreaterThan = f.ObjectSizeGreaterThan
+			rule.ObjectSizeLessThan = f.ObjectSizeLessThan
+		}
+		if len(tags) > 0 {
+			rule.Tags = make(map[string]string)
+			for _, tag := range tags {
+				rule.Tags[tag.Key] = tag.Value
+			}
+		}
+		for i, t := range rule.Transitions {
+			rule.Transitions[i].Date = lifecycleDate(t.Date)
+		}
+		if e := rule.Expiration; e != nil {
+			e.Date = lifecycleDate(e.Date)
+		}
+		config.Rules = append(config.Rules, rule)
+	}
+	return config, nil
+}
+
+// XML formats the lifecycle configuration in the XML format of S3.
+func (config S3LifecycleConfiguration) XML() ([]byte, error) {
+	var x s3LifecycleXML
+	for _, rule := range config.Rules {
+		r := s3LifecycleRuleXML{
+			ID:                             rule.ID,
+			Status:                         rule.Status,
+			NoncurrentVersionTransitions:   rule.NoncurrentVersionTransitions,
+			NoncurrentVersionExpiration:    rule.NoncurrentVersionExpiration,
+			AbortIncompleteMultipartUpload: rule.AbortIncompleteMultipartUpload,
+		}
+		if r.Status == "" {
+			r.Status = LifecycleEnabled
+		}
+		for _, t := range rule.Transitions {
+			t.Date = lifecycleXMLDate(t.Date)
+			r.Transitions = append(r.Transitions, t)
+		}
+		if rule.Expiration != nil {
+			e := *rule.Expiration
+			e.Date = lifecycleXMLDate(e.Date)
+			r.Expiration = &e
+		}
+		tags := newTagging(rule.Tags).TagSet
+		conditions := len(tags)
+		for _, set := range []bool{rule.Prefix != "", rule.ObjectSizeGreaterThan > 0, rule.ObjectSizeLessThan > 0} {
+			if set {
+				conditions++
+			}
+		}
+		if conditions > 1 {
+			r.Filter.And = &s3LifecycleFilterAnd{
+				Prefix:                rule.Prefix,
+				Tags:                  tags,
+				ObjectSizeGreaterThan: rule.ObjectSizeGreaterThan,
+				ObjectSizeLessThan:    rule.ObjectSizeLessThan,
+			}
+		} else {
+			if rule.Prefix != "" {
+				prefix := rule.Prefix
+				r.Filter.Prefix = &prefix
+			}
+			if len(tags) > 0 {
+				r.Filter.Tag = &tags[0]
+			}
+			r.Filter.ObjectSizeGreaterThan = rule.ObjectSizeGreaterThan
+			r.Filter.ObjectSizeLessThan = rule.ObjectSizeLessThan
+		}
+		x.Rules = append(x.Rules, r)
+	}
+	return xml.Marshal(x)
+}
+
+// https://docs.aws.amazon.com/AmazonS3/latest/API/API_GetBucketLifecycleConfiguration.html
+//
+// The configuration has no rules if none has been put.
+func (bucket S3Bucket) GetLifecycle(ctx context.Context) (*S3LifecycleConfiguration, error) {
+	reqUrl, err := url.Parse(bucket.Endpoint + "/?lifecycle")
+	if err != nil {
+		return nil, err
+	}
+	resp, err := curl(ctx, bucket, "GET", reqUrl, http.NoBody, nil)
+	if hasErrorCode(err, "NoSuchLifecycleConfiguration") {
+		return &S3LifecycleConfiguration{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return ParseLifecycleXML(resp.Bytes())
+}
+
+// https://docs.aws.amazon.com/AmazonS3/latest/API/API_PutBucketLifecycleConfiguration.html
+//
+// The configuration replaces the rules of the bucket.
+func (bucket S3Bucket) PutLifecycle(ctx context.Context, config S3LifecycleConfiguration) error {
+	err := config.Validate()
+	if err != nil {
+		return err
+	}
+	reqUrl, err := url.Parse(bucket.Endpoint + "/?lifecycle")
+	if err != nil {
+		return err
+	}
+	b, err := config.XML()
+	if err != nil {
+		return err
+	}
+	_, err = curl(ctx, bucket, "PUT", reqUrl, bytes.NewReader(b), nil)
+	return err
+}
+
+// https://docs.aws.amazon.com/AmazonS3/latest/API/API_DeleteBucketLifecycle.html
+func (bucket S3Bucket) DeleteLifecycle(ctx context.Context) error {
+	reqUrl, err := url.Parse(bucket.Endpoint + "/?lifecycle")
+	if err != nil {
+		return err
+	}
+	_, err = curl(ctx, bucket, "DELETE", reqUrl, http.NoBody, nil)
+	return err
+}
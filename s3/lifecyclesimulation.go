@@ -0,0 +1,142 @@
+package s3
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// actions of lifecycle rules on current objects
+const (
+	LifecycleTransition = "transition"
+	LifecycleExpiration = "expiration"
+)
+
+// S3LifecycleAction is an action a lifecycle rule takes on an object at a
+// date, the storage class is the target of transitions.
+type S3LifecycleAction struct {
+	Rule         string
+	Action       string
+	StorageClass string
+	Date         time.Time
+}
+
+// Matches tells whether the filters of the rule select the object.
+func (rule S3LifecycleRule) Matches(item S3Item, tags map[string]string) bool {
+	if !strings.HasPrefix(item.Key, rule.Prefix) {
+		return false
+	}
+	if rule.ObjectSizeGreaterThan > 0 && item.Size <= rule.ObjectSizeGreaterThan {
+		return false
+	}
+	if rule.ObjectSizeLessThan > 0 && item.Size >= rule.ObjectSizeLessThan {
+		return false
+	}
+	for k, v := range rule.Tags {
+		if value, ok := tags[k]; !ok || value != v {
+			return false
+		}
+	}
+	return true
+}
+
+// Prefix returns the longest prefix common to the enabled rules, the
+// objects of other keys are not affected by the configuration.
+func (config S3LifecycleConfiguration) Prefix() string {
+	prefix := ""
+	first := true
+	for _, rule := range config.Rules {
+		if rule.Status == LifecycleDisabled {
+			continue
+		}
+		if first {
+			prefix = rule.Prefix
+			first = false
+			continue
+		}
+		n := 0
+		for n < len(prefix) && n < len(rule.Prefix) && prefix[n] == rule.Prefix[n] {
+			n++
+		}
+		prefix = prefix[:n]
+	}
+	return prefix
+}
+
+// lifecycleActionDate is the date of an action on an object created at the
+// time. S3 counts days from the creation and rounds up to the next midnight
+// UTC, actions at dates are taken on objects created later the next day.
+func lifecycleActionDate(created time.Time, days int, date string) time.Time {
+	if date == "" {
+		t := created.UTC().AddDate(0, 0, days)
+		if midnight := t.Truncate(24 * time.Hour); !midnight.Equal(t) {
+			return midnight.Add(24 * time.Hour)
+		}
+		return t
+	}
+	// the rules have been validated before
+	t, _ := ParseLifecycleDate(date)
+	if created.After(t) {
+		return created.UTC().Truncate(24 * time.Hour).Add(24 * time.Hour)
+	}
+	return t
+}
+
+// Actions returns the actions the enabled rules take on a current object
+// in the order of their dates: the transitions to colder storage classes up
+// to its expiration. Expirations win over transitions of the same day and
+// of several transitions of a day the one to the coldest class is taken.
+//
+// Rules on noncurrent versions, delete markers and multipart uploads do not
+// act on current objects and are ignored.
+func (config S3LifecycleConfiguration) Actions(item S3Item, tags map[string]string) []S3LifecycleAction {
+	var candidates []S3LifecycleAction
+	for i, rule := range config.Rules {
+		if rule.Status == LifecycleDisabled || !rule.Matches(item, tags) {
+			continue
+		}
+		name := rule.ID
+		if name == "" {
+			name = fmt.Sprintf("#%d", i+1)
+		}
+		for _, t := range rule.Transitions {
+			candidates = append(candidates, S3LifecycleAction{
+				Rule:         name,
+				Action:       LifecycleTransition,
+				StorageClass: t.StorageClass,
+				Date:         lifecycleActionDate(item.LastModified, t.Days, t.Date),
+			})
+		}
+		if e := rule.Expiration; e != nil && (e.Days > 0 || e.Date != "") {
+			candidates = append(candidates, S3LifecycleAction{
+				Rule:   name,
+				Action: LifecycleExpiration,
+				Date:   lifecycleActionDate(item.LastModified, e.Days, e.Date),
+			})
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+		if !a.Date.Equal(b.Date) {
+			return a.Date.Before(b.Date)
+		}
+		if a.Action != b.Action {
+			return a.Action == LifecycleExpiration
+		}
+		return transitionOrder[a.StorageClass] > transitionOrder[b.StorageClass]
+	})
+	var actions []S3LifecycleAction
+	// objects of classes not ranked, i.e. STANDARD, can move to any class
+	rank := transitionOrder[item.StorageClass]
+	for _, action := range candidates {
+		if action.Action == LifecycleExpiration {
+			return append(actions, action)
+		}
+		if transitionOrder[action.StorageClass] > rank {
+			rank = transitionOrder[action.StorageClass]
+			actions = append(actions, action)
+		}
+	}
+	return actions
+}
@@ -0,0 +1,156 @@
+package s3
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemoryStore keeps objects in memory, it is meant for tests.
+type MemoryStore struct {
+	Defaults S3PutOptions
+	mu       sync.RWMutex
+	objects  map[string]*memoryObject
+}
+
+type memoryObject struct {
+	item    S3Item
+	options S3PutOptions
+	content []byte
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{objects: make(map[string]*memoryObject)}
+}
+
+func (store *MemoryStore) List(ctx context.Context, prefix string, fetchSize int, visitor S3ListBucketResultVisitor) error {
+	return store.ListFrom(ctx, prefix, "", fetchSize, visitor)
+}
+
+func (store *MemoryStore) ListFrom(ctx context.Context, prefix string, continuationToken string, fetchSize int, visitor S3ListBucketResultVisitor) error {
+	store.mu.RLock()
+	items := make([]S3Item, 0)
+	for key, obj := range store.objects {
+		if strings.HasPrefix(key, prefix) {
+			items = append(items, obj.item)
+		}
+	}
+	store.mu.RUnlock()
+	sort.Slice(items, func(i, j int) bool { return items[i].Key < items[j].Key })
+	return visitItems(items, prefix, continuationToken, fetchSize, visitor)
+}
+
+func (store *MemoryStore) lookup(key string) (*memoryObject, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+	obj, ok := store.objects[key]
+	if !ok {
+		return nil, fmt.Errorf("%s: %w", key, ErrNoSuchKey)
+	}
+	return obj, nil
+}
+
+func (store *MemoryStore) Head(ctx context.Context, key string) (*S3Object, error) {
+	obj, err := store.lookup(key)
+	if err != nil {
+		return nil, err
+	}
+	return obj.object(), nil
+}
+
+func (store *MemoryStore) Get(ctx context.Context, key string, byteRange string) (*S3Object, error) {
+	obj, err := store.lookup(key)
+	if err != nil {
+		return nil, err
+	}
+	rlt := obj.object()
+	content := obj.content
+	if byteRange != "" {
+		start, end, err := parseByteRange(byteRange, int64(len(content)))
+		if err != nil {
+			return nil, err
+		}
+		content = content[start : end+1]
+		rlt.Size = int64(len(content))
+		rlt.ContentRange = contentRange(start, end, obj.item.Size)
+	}
+	rlt.Body = ioutil.NopCloser(bytes.NewReader(content))
+	return rlt, nil
+}
+
+func (obj *memoryObject) object() *S3Object {
+	metadata := make(map[string]string)
+	for k, v := range obj.options.Metadata {
+		metadata[k] = v
+	}
+	return &S3Object{
+		Key:             obj.item.Key,
+		Size:            obj.item.Size,
+		ContentType:     obj.options.ContentType,
+		ContentEncoding: obj.options.ContentEncoding,
+		ETag:            obj.item.ETag,
+		LastModified:    obj.item.LastModified,
+		Metadata:        metadata,
+	}
+}
+
+// Put reads the whole content into memory, size is ignored.
+func (store *MemoryStore) Put(ctx context.Context, key string, reader io.Reader, size int64, options S3PutOptions) error {
+	content, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return err
+	}
+	options = options.WithDefaults(store.Defaults)
+	if options.ContentType == "" {
+		options.ContentType = DetectContentType(key, content)
+	}
+	store.store(key, content, options)
+	return nil
+}
+
+func (store *MemoryStore) store(key string, content []byte, options S3PutOptions) {
+	obj := &memoryObject{
+		item: S3Item{
+			Key:          key,
+			LastModified: time.Now().UTC(),
+			ETag:         md5ETag(content),
+			Size:         int64(len(content)),
+			StorageClass: options.StorageClass,
+		},
+		options: options,
+		content: content,
+	}
+	if obj.item.StorageClass == "" {
+		obj.item.StorageClass = "STANDARD"
+	}
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	store.objects[key] = obj
+}
+
+func (store *MemoryStore) Delete(ctx context.Context, visitor S3DeleteResultVisitor, keys ...string) error {
+	var rlt S3DeleteResult
+	store.mu.Lock()
+	for _, key := range keys {
+		delete(store.objects, key)
+		rlt.Deleted = append(rlt.Deleted, S3Deleted{Key: key})
+	}
+	store.mu.Unlock()
+	return visitor.VisitDeletion(&rlt)
+}
+
+func (store *MemoryStore) Copy(ctx context.Context, sourceKey string, targetKey string) error {
+	obj, err := store.lookup(sourceKey)
+	if err != nil {
+		return err
+	}
+	// contents are never modified, hence they can be shared
+	store.store(targetKey, obj.content, obj.options)
+	return nil
+}
@@ -0,0 +1,211 @@
+package s3
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	log "github.com/sirupsen/logrus"
+)
+
+type S3InitiateMultipartUploadResult struct {
+	Bucket   string `xml:"Bucket"`
+	Key      string `xml:"Key"`
+	UploadId string `xml:"UploadId"`
+}
+
+type S3CompletedPart struct {
+	PartNumber int    `xml:"PartNumber"`
+	ETag       string `xml:"ETag"`
+}
+
+type S3CompleteMultipartUpload struct {
+	XMLName xml.Name          `xml:"CompleteMultipartUpload"`
+	Parts   []S3CompletedPart `xml:"Part"`
+}
+
+type S3Error struct {
+	Code    string `xml:"Code"`
+	Message string `xml:"Message"`
+}
+
+// S3MultipartUpload is the state of a multipart upload in progress.
+type S3MultipartUpload struct {
+	Key      string
+	UploadId string
+	PartSize int64
+	Parts    []S3CompletedPart
+}
+
+// S3MultipartVisitor is notified whenever a multipart upload has been
+// created or one of its parts has been uploaded.
+type S3MultipartVisitor interface {
+	VisitUpload(upload *S3MultipartUpload) error
+}
+
+//#######
+
+// https://docs.aws.amazon.com/AmazonS3/latest/userguide/mpuoverview.html
+//
+// buf holds the first part and is reused for all following parts.
+func (bucket S3Bucket) uploadMultipart(ctx context.Context, upload *S3MultipartUpload, reader io.Reader, buf []byte, header map[string]string, visitor S3MultipartVisitor) error {
+	if upload.UploadId == "" {
+		uploadId, err := bucket.createMultipartUpload(ctx, upload.Key, header)
+		if err != nil {
+			return err
+		}
+		upload.UploadId = uploadId
+		upload.Parts = nil
+		if visitor != nil {
+			err = visitor.VisitUpload(upload)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	err := bucket.uploadParts(ctx, upload, reader, buf, visitor)
+	if err == nil {
+		err = bucket.completeMultipartUpload(ctx, upload.Key, upload.UploadId, upload.Parts)
+	}
+	if err != nil && visitor == nil {
+		cleanupCtx, cancel := cleanupContext()
+		defer cancel()
+		if aerr := bucket.abortMultipartUpload(cleanupCtx, upload.Key, upload.UploadId); aerr != nil {
+			return fmt.Errorf("%s (aborting upload %s failed: %s)", err.Error(), upload.UploadId, aerr.Error())
+		}
+	}
+	return err
+}
+
+func (bucket S3Bucket) uploadParts(ctx context.Context, upload *S3MultipartUpload, reader io.Reader, buf []byte, visitor S3MultipartVisitor) error {
+	done := upload.Parts
+	upload.Parts = make([]S3CompletedPart, 0, len(done))
+	n := len(buf)
+	for n > 0 {
+		number := len(upload.Parts) + 1
+		if number > MaxParts {
+			return fmt.Errorf("content of %s exceeds %d parts of %d bytes (increase the part size)", upload.Key, MaxParts, len(buf))
+		}
+		if number <= len(done) && done[number-1].PartNumber == number && partMatches(buf[:n], done[number-1].ETag) {
+			upload.Parts = append(upload.Parts, done[number-1])
+		} else {
+			etag, err := bucket.uploadPart(ctx, upload.Key, upload.UploadId, number, buf[:n])
+			if err != nil {
+				return err
+			}
+			upload.Parts = append(upload.Parts, S3CompletedPart{PartNumber: number, ETag: etag})
+			if visitor != nil {
+				err = visitor.VisitUpload(upload)
+				if err != nil {
+					return err
+				}
+			}
+		}
+
+		var err error
+		n, err = io.ReadFull(reader, buf)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return err
+		}
+	}
+	return nil
+}
+
+// partMatches tests whether a part has been uploaded with the given content.
+func partMatches(content []byte, etag string) bool {
+	return fmt.Sprintf("\"%x\"", md5.Sum(content)) == etag || fmt.Sprintf("%x", md5.Sum(content)) == etag
+}
+
+// discardMultipartUpload aborts an upload which can not be resumed.
+func (bucket S3Bucket) discardMultipartUpload(ctx context.Context, upload *S3MultipartUpload) {
+	if err := bucket.abortMultipartUpload(ctx, upload.Key, upload.UploadId); err != nil {
+		log.Warnf("aborting upload %s of %s failed: %v", upload.UploadId, upload.Key, err)
+	}
+	upload.UploadId = ""
+	upload.Parts = nil
+}
+
+// AbortUpload aborts a multipart upload, i.e. one which is not going to be resumed.
+func (bucket S3Bucket) AbortUpload(ctx context.Context, upload *S3MultipartUpload) error {
+	return bucket.abortMultipartUpload(ctx, upload.Key, upload.UploadId)
+}
+
+func (bucket S3Bucket) multipartUrl(key string, query url.Values) (*url.URL, error) {
+	return url.Parse(bucket.Endpoint + "/" + key + "?" + query.Encode())
+}
+
+// https://docs.aws.amazon.com/AmazonS3/latest/API/API_CreateMultipartUpload.html
+func (bucket S3Bucket) createMultipartUpload(ctx context.Context, key string, header map[string]string) (string, error) {
+	reqUrl, err := url.Parse(bucket.Endpoint + "/" + key + "?uploads")
+	if err != nil {
+		return "", err
+	}
+	resp, err := curl(ctx, bucket, "POST", reqUrl, http.NoBody, header)
+	if err != nil {
+		return "", err
+	}
+	var rlt S3InitiateMultipartUploadResult
+	err = xml.Unmarshal(resp.Bytes(), &rlt)
+	if err != nil {
+		return "", err
+	}
+	if rlt.UploadId == "" {
+		return "", fmt.Errorf("no upload id received for %s", key)
+	}
+	return rlt.UploadId, nil
+}
+
+// https://docs.aws.amazon.com/AmazonS3/latest/API/API_UploadPart.html
+func (bucket S3Bucket) uploadPart(ctx context.Context, key string, uploadId string, partNumber int, content []byte) (string, error) {
+	reqUrl, err := bucket.multipartUrl(key, url.Values{
+		"partNumber": {strconv.Itoa(partNumber)},
+		"uploadId":   {uploadId},
+	})
+	if err != nil {
+		return "", err
+	}
+	resp, err := send(ctx, bucket, "PUT", reqUrl, bytes.NewReader(content), nil)
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+	return resp.Header.Get("ETag"), nil
+}
+
+// https://docs.aws.amazon.com/AmazonS3/latest/API/API_CompleteMultipartUpload.html
+func (bucket S3Bucket) completeMultipartUpload(ctx context.Context, key string, uploadId string, parts []S3CompletedPart) error {
+	payload, err := xml.Marshal(S3CompleteMultipartUpload{Parts: parts})
+	if err != nil {
+		return err
+	}
+	reqUrl, err := bucket.multipartUrl(key, url.Values{"uploadId": {uploadId}})
+	if err != nil {
+		return err
+	}
+	resp, err := curl(ctx, bucket, "POST", reqUrl, bytes.NewReader(payload), nil)
+	if err != nil {
+		return err
+	}
+	// errors might be reported after the response status has been sent
+	var rlt S3Error
+	if xml.Unmarshal(resp.Bytes(), &rlt) == nil && rlt.Code != "" {
+		return fmt.Errorf("completing upload of %s failed: %s -> %s", key, rlt.Code, rlt.Message)
+	}
+	return nil
+}
+
+// https://docs.aws.amazon.com/AmazonS3/latest/API/API_AbortMultipartUpload.html
+func (bucket S3Bucket) abortMultipartUpload(ctx context.Context, key string, uploadId string) error {
+	reqUrl, err := bucket.multipartUrl(key, url.Values{"uploadId": {uploadId}})
+	if err != nil {
+		return err
+	}
+	_, err = curl(ctx, bucket, "DELETE", reqUrl, http.NoBody, nil)
+	return err
+}
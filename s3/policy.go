@@ -0,0 +1,333 @@
+package s3
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// versions of the policy language
+const (
+	PolicyVersion       = "2012-10-17"
+	PolicyVersionLegacy = "2008-10-17"
+)
+
+// maxPolicySize is the maximum size of bucket policies in bytes.
+const maxPolicySize = 20 * 1024
+
+// S3Policy is a bucket policy, the statements are kept as they are written
+// except that single values are turned into lists.
+type S3Policy struct {
+	Version   string           `json:"Version,omitempty"`
+	Id        string           `json:"Id,omitempty"`
+	Statement policyStatements `json:"Statement"`
+}
+
+type S3PolicyStatement struct {
+	Sid          string                            `json:"Sid,omitempty"`
+	Effect       string                            `json:"Effect"`
+	Principal    json.RawMessage                   `json:"Principal,omitempty"`
+	NotPrincipal json.RawMessage                   `json:"NotPrincipal,omitempty"`
+	Action       policyStrings                     `json:"Action,omitempty"`
+	NotAction    policyStrings                     `json:"NotAction,omitempty"`
+	Resource     policyStrings                     `json:"Resource,omitempty"`
+	NotResource  policyStrings                     `json:"NotResource,omitempty"`
+	Condition    map[string]map[string]interface{} `json:"Condition,omitempty"`
+}
+
+// policyStrings are a string or a list of strings.
+type policyStrings []string
+
+func (ps *policyStrings) UnmarshalJSON(b []byte) error {
+	var s string
+	if json.Unmarshal(b, &s) == nil {
+		*ps = policyStrings{s}
+		return nil
+	}
+	var list []string
+	err := json.Unmarshal(b, &list)
+	if err != nil {
+		return fmt.Errorf("expected a string or a list of strings instead of %s", b)
+	}
+	*ps = list
+	return nil
+}
+
+// policyStatements are a statement or a list of statements.
+type policyStatements []S3PolicyStatement
+
+func (ps *policyStatements) UnmarshalJSON(b []byte) error {
+	if bytes.HasPrefix(bytes.TrimSpace(b), []byte("{")) {
+		var statement S3PolicyStatement
+		err := strictUnmarshalJSON(b, &statement)
+		*ps = policyStatements{statement}
+		return err
+	}
+	var list []S3PolicyStatement
+	err := strictUnmarshalJSON(b, &list)
+	*ps = list
+	return err
+}
+
+func strictUnmarshalJSON(b []byte, v interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(b))
+	decoder.DisallowUnknownFields()
+	return decoder.Decode(v)
+}
+
+var policyResourcePattern = regexp.MustCompile(`^arn:aws[a-z-]*:s3:::[^/]+(/.*)?$`)
+
+// s3Actions are the actions of bucket policies, their patterns have to
+// match at least one of them.
+var s3Actions = []string{
+	"s3:AbortMultipartUpload",
+	"s3:BypassGovernanceRetention",
+	"s3:CreateBucket",
+	"s3:DeleteBucket",
+	"s3:DeleteBucketOwnershipControls",
+	"s3:DeleteBucketPolicy",
+	"s3:DeleteBucketWebsite",
+	"s3:DeleteObject",
+	"s3:DeleteObjectTagging",
+	"s3:DeleteObjectVersion",
+	"s3:DeleteObjectVersionTagging",
+	"s3:GetAccelerateConfiguration",
+	"s3:GetAnalyticsConfiguration",
+	"s3:GetBucketAcl",
+	"s3:GetBucketCORS",
+	"s3:GetBucketLocation",
+	"s3:GetBucketLogging",
+	"s3:GetBucketNotification",
+	"s3:GetBucketObjectLockConfiguration",
+	"s3:GetBucketOwnershipControls",
+	"s3:GetBucketPolicy",
+	"s3:GetBucketPolicyStatus",
+	"s3:GetBucketPublicAccessBlock",
+	"s3:GetBucketRequestPayment",
+	"s3:GetBucketTagging",
+	"s3:GetBucketVersioning",
+	"s3:GetBucketWebsite",
+	"s3:GetEncryptionConfiguration",
+	"s3:GetIntelligentTieringConfiguration",
+	"s3:GetInventoryConfiguration",
+	"s3:GetLifecycleConfiguration",
+	"s3:GetMetricsConfiguration",
+	"s3:GetObject",
+	"s3:GetObjectAcl",
+	"s3:GetObjectAttributes",
+	"s3:GetObjectLegalHold",
+	"s3:GetObjectRetention",
+	"s3:GetObjectTagging",
+	"s3:GetObjectTorrent",
+	"s3:GetObjectVersion",
+	"s3:GetObjectVersionAcl",
+	"s3:GetObjectVersionAttributes",
+	"s3:GetObjectVersionForReplication",
+	"s3:GetObjectVersionTagging",
+	"s3:GetObjectVersionTorrent",
+	"s3:GetReplicationConfiguration",
+	"s3:ListBucket",
+	"s3:ListBucketMultipartUploads",
+	"s3:ListBucketVersions",
+	"s3:ListMultipartUploadParts",
+	"s3:ObjectOwnerOverrideToBucketOwner",
+	"s3:PutAccelerateConfiguration",
+	"s3:PutAnalyticsConfiguration",
+	"s3:PutBucketAcl",
+	"s3:PutBucketCORS",
+	"s3:PutBucketLogging",
+	"s3:PutBucketNotification",
+	"s3:PutBucketObjectLockConfiguration",
+	"s3:PutBucketOwnershipControls",
+	"s3:PutBucketPolicy",
+	"s3:PutBucketPublicAccessBlock",
+	"s3:PutBucketRequestPayment",
+	"s3:PutBucketTagging",
+	"s3:PutBucketVersioning",
+	"s3:PutBucketWebsite",
+	"s3:PutEncryptionConfiguration",
+	"s3:PutIntelligentTieringConfiguration",
+	"s3:PutInventoryConfiguration",
+	"s3:PutLifecycleConfiguration",
+	"s3:PutMetricsConfiguration",
+	"s3:PutObject",
+	"s3:PutObjectAcl",
+	"s3:PutObjectLegalHold",
+	"s3:PutObjectRetention",
+	"s3:PutObjectTagging",
+	"s3:PutObjectVersionAcl",
+	"s3:PutObjectVersionTagging",
+	"s3:PutReplicationConfiguration",
+	"s3:ReplicateDelete",
+	"s3:ReplicateObject",
+	"s3:ReplicateTags",
+	"s3:RestoreObject",
+}
+
+// knownAction tells whether the action or the pattern of actions refers
+// to an action of S3, the names are case insensitive.
+func knownAction(action string) bool {
+	pattern := strings.ToLower(action)
+	if pattern == "*" {
+		return true
+	}
+	for _, a := range s3Actions {
+		// ? and * are the only special characters of actions
+		if ok, _ := path.Match(pattern, strings.ToLower(a)); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// ParsePolicy parses a bucket policy and checks it like S3 does before
+// accepting it, all problems are reported at once.
+func ParsePolicy(b []byte) (*S3Policy, error) {
+	if len(b) > maxPolicySize {
+		return nil, fmt.Errorf("the policy of %d bytes exceeds the maximum of %d bytes", len(b), maxPolicySize)
+	}
+	var policy S3Policy
+	err := strictUnmarshalJSON(b, &policy)
+	if err != nil {
+		return nil, fmt.Errorf("invalid policy: %v", err)
+	}
+	var problems []string
+	add := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+	if policy.Version != "" && policy.Version != PolicyVersion && policy.Version != PolicyVersionLegacy {
+		add("invalid version '%s' - allowed values are: %s or %s", policy.Version, PolicyVersion, PolicyVersionLegacy)
+	}
+	if len(policy.Statement) == 0 {
+		add("at least one statement is required")
+	}
+	sids := make(map[string]bool)
+	for i, statement := range policy.Statement {
+		name := statement.name(i)
+		if statement.Sid != "" {
+			if sids[statement.Sid] {
+				add("%s: the sid is not unique", name)
+			}
+			sids[statement.Sid] = true
+		}
+		if statement.Effect != "Allow" && statement.Effect != "Deny" {
+			add("%s: invalid effect '%s' - allowed values are: Allow or Deny", name, statement.Effect)
+		}
+		if (statement.Principal == nil) == (statement.NotPrincipal == nil) {
+			add("%s: requires either a principal or a not principal", name)
+		}
+		if (statement.Action == nil) == (statement.NotAction == nil) {
+			add("%s: requires either actions or not actions", name)
+		}
+		if (statement.Resource == nil) == (statement.NotResource == nil) {
+			add("%s: requires either resources or not resources", name)
+		}
+		for _, resource := range append(append(policyStrings{}, statement.Resource...), statement.NotResource...) {
+			if resource != "*" && !policyResourcePattern.MatchString(resource) {
+				add("%s: invalid resource '%s' (expected i.e. arn:aws:s3:::bucket/*)", name, resource)
+			}
+		}
+	}
+	if len(problems) > 0 {
+		return nil, fmt.Errorf("invalid policy:\n  %s", strings.Join(problems, "\n  "))
+	}
+	return &policy, nil
+}
+
+func (statement S3PolicyStatement) name(i int) string {
+	if statement.Sid != "" {
+		return fmt.Sprintf("statement '%s'", statement.Sid)
+	}
+	return fmt.Sprintf("statement %d", i+1)
+}
+
+// public tells whether the statement allows anyone, that is the principal
+// is * or {"AWS": "*"}.
+func (statement S3PolicyStatement) public() bool {
+	if statement.Effect != "Allow" || statement.Principal == nil {
+		return false
+	}
+	var s string
+	if json.Unmarshal(statement.Principal, &s) == nil {
+		return s == "*"
+	}
+	var principals map[string]policyStrings
+	if json.Unmarshal(statement.Principal, &principals) != nil {
+		return false
+	}
+	for _, p := range principals["AWS"] {
+		if p == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// Warnings lists what is accepted by S3 but most likely a mistake: access
+// for anyone without conditions and actions unknown to S3.
+func (policy S3Policy) Warnings() []string {
+	var warnings []string
+	for i, statement := range policy.Statement {
+		name := statement.name(i)
+		if statement.public() && len(statement.Condition) == 0 {
+			warnings = append(warnings, fmt.Sprintf("%s allows anyone without conditions", name))
+		}
+		for _, action := range append(append(policyStrings{}, statement.Action...), statement.NotAction...) {
+			if !knownAction(action) {
+				warnings = append(warnings, fmt.Sprintf("%s: unknown action '%s'", name, action))
+			}
+		}
+	}
+	return warnings
+}
+
+// https://docs.aws.amazon.com/AmazonS3/latest/API/API_GetBucketPolicy.html
+//
+// The policy is nil if the bucket has none.
+func (bucket S3Bucket) GetPolicy(ctx context.Context) ([]byte, error) {
+	reqUrl, err := url.Parse(bucket.Endpoint + "/?policy")
+	if err != nil {
+		return nil, err
+	}
+	resp, err := curl(ctx, bucket, "GET", reqUrl, http.NoBody, nil)
+	if hasErrorCode(err, "NoSuchBucketPolicy") {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return resp.Bytes(), nil
+}
+
+// https://docs.aws.amazon.com/AmazonS3/latest/API/API_PutBucketPolicy.html
+//
+// The policy replaces the one of the bucket.
+func (bucket S3Bucket) PutPolicy(ctx context.Context, policy []byte) error {
+	_, err := ParsePolicy(policy)
+	if err != nil {
+		return err
+	}
+	reqUrl, err := url.Parse(bucket.Endpoint + "/?policy")
+	if err != nil {
+		return err
+	}
+	header := map[string]string{"Content-Type": "application/json"}
+	_, err = curl(ctx, bucket, "PUT", reqUrl, bytes.NewReader(policy), header)
+	return err
+}
+
+// https://docs.aws.amazon.com/AmazonS3/latest/API/API_DeleteBucketPolicy.html
+func (bucket S3Bucket) DeletePolicy(ctx context.Context) error {
+	reqUrl, err := url.Parse(bucket.Endpoint + "/?policy")
+	if err != nil {
+		return err
+	}
+	_, err = curl(ctx, bucket, "DELETE", reqUrl, http.NoBody, nil)
+	return err
+}
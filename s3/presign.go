@@ -0,0 +1,121 @@
+package s3
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// MaxPresignExpiry is the longest validity of presigned URLs accepted by S3.
+const MaxPresignExpiry = 7 * 24 * time.Hour
+
+// https://docs.aws.amazon.com/AmazonS3/latest/API/sigv4-query-string-auth.html
+//
+// Presign returns a URL which grants the method on the key to anyone
+// holding it until it expires. The query, i.e. response-content-disposition,
+// is signed as well. The payload of uploads is not signed.
+func (bucket S3Bucket) Presign(method string, key string, query url.Values, expires time.Duration, now time.Time) (string, error) {
+	if expires < time.Second || expires > MaxPresignExpiry {
+		return "", fmt.Errorf("expiry %v is out of range - allowed are 1s to %v", expires, MaxPresignExpiry)
+	}
+	reqUrl, err := url.Parse(bucket.Endpoint + "/" + key)
+	if err != nil {
+		return "", err
+	}
+	now = now.UTC()
+	scope := credentialScope(now, bucket.Region)
+	signed := url.Values{}
+	for k, v := range query {
+		signed[k] = v
+	}
+	signed.Set("X-Amz-Algorithm", awsV4Algorithm)
+	signed.Set("X-Amz-Credential", bucket.AccessKeyId+"/"+scope)
+	signed.Set("X-Amz-Date", now.Format(awsV4TimeFormat))
+	signed.Set("X-Amz-Expires", strconv.FormatInt(int64(expires/time.Second), 10))
+	signed.Set("X-Amz-SignedHeaders", "host")
+	canonical, _ := canonicalRequest(method, reqUrl.Path, signed, map[string]string{"host": reqUrl.Host}, unsignedPayload)
+	signed.Set("X-Amz-Signature", signAwsV4Content(signingKey(bucket.SecretKey, now, bucket.Region), now, scope, canonical))
+	reqUrl.RawQuery = canonicalQuery(signed)
+	return reqUrl.String(), nil
+}
+
+// S3PostPolicy restricts the uploads of a presigned POST form.
+type S3PostPolicy struct {
+	// KeyPrefix is required for keys, the form appends ${filename} to it,
+	// which is replaced by the name of the uploaded file.
+	KeyPrefix string
+	// MinSize and MaxSize bound the size of uploads if MaxSize is positive.
+	MinSize int64
+	MaxSize int64
+	// ContentTypePrefix is required for the content type unless empty.
+	ContentTypePrefix string
+	Expires           time.Duration
+}
+
+// S3PostForm is the target and the fields of an HTML form uploading to a
+// bucket, the file has to follow the fields as the last one named file.
+type S3PostForm struct {
+	URL    string            `json:"url"`
+	Fields map[string]string `json:"fields"`
+}
+
+// https://docs.aws.amazon.com/AmazonS3/latest/API/sigv4-HTTPPOSTConstructPolicy.html
+//
+// PresignPost returns a form for browsers uploading to the bucket as long as
+// the uploads satisfy the policy. The Content-Type field holds the required
+// prefix of the content type, which is to be completed.
+func (bucket S3Bucket) PresignPost(policy S3PostPolicy, now time.Time) (*S3PostForm, error) {
+	if policy.Expires < time.Second || policy.Expires > MaxPresignExpiry {
+		return nil, fmt.Errorf("expiry %v is out of range - allowed are 1s to %v", policy.Expires, MaxPresignExpiry)
+	}
+	if policy.MaxSize > 0 && policy.MinSize > policy.MaxSize {
+		return nil, fmt.Errorf("minimum size %d exceeds maximum size %d", policy.MinSize, policy.MaxSize)
+	}
+	now = now.UTC()
+	credential := bucket.AccessKeyId + "/" + credentialScope(now, bucket.Region)
+	date := now.Format(awsV4TimeFormat)
+	conditions := []interface{}{
+		map[string]string{"bucket": bucket.bucketName()},
+		[]interface{}{"starts-with", "$key", policy.KeyPrefix},
+		map[string]string{"x-amz-algorithm": awsV4Algorithm},
+		map[string]string{"x-amz-credential": credential},
+		map[string]string{"x-amz-date": date},
+	}
+	fields := map[string]string{
+		"key":              policy.KeyPrefix + "${filename}",
+		"x-amz-algorithm":  awsV4Algorithm,
+		"x-amz-credential": credential,
+		"x-amz-date":       date,
+	}
+	if policy.MaxSize > 0 {
+		conditions = append(conditions, []interface{}{"content-length-range", policy.MinSize, policy.MaxSize})
+	}
+	if policy.ContentTypePrefix != "" {
+		conditions = append(conditions, []interface{}{"starts-with", "$Content-Type", policy.ContentTypePrefix})
+		fields["Content-Type"] = policy.ContentTypePrefix
+	}
+	document, err := json.Marshal(map[string]interface{}{
+		"expiration": now.Add(policy.Expires).Format(postPolicyTimeFormat),
+		"conditions": conditions,
+	})
+	if err != nil {
+		return nil, err
+	}
+	fields["policy"] = base64.StdEncoding.EncodeToString(document)
+	fields["x-amz-signature"] = signAwsV4Policy(signingKey(bucket.SecretKey, now, bucket.Region), fields["policy"])
+	return &S3PostForm{URL: bucket.Endpoint + "/", Fields: fields}, nil
+}
+
+const postPolicyTimeFormat = "2006-01-02T15:04:05.000Z"
+
+// signAwsV4Policy signs the base64 encoded policy of a POST form.
+func signAwsV4Policy(key []byte, policy string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(policy))
+	return fmt.Sprintf("%x", mac.Sum(nil))
+}
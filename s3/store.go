@@ -0,0 +1,122 @@
+package s3
+
+import (
+	"context"
+	"crypto/md5"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ObjectStore is implemented by S3 buckets and by the storage backends
+// standing in for them, i.e. in tests.
+type ObjectStore interface {
+	List(ctx context.Context, prefix string, fetchSize int, visitor S3ListBucketResultVisitor) error
+	// ListFrom continues a listing at the continuation token of a previously
+	// visited partial result, an empty token starts at the beginning.
+	ListFrom(ctx context.Context, prefix string, continuationToken string, fetchSize int, visitor S3ListBucketResultVisitor) error
+	// Head returns the header information of an object without its body.
+	Head(ctx context.Context, key string) (*S3Object, error)
+	Get(ctx context.Context, key string, byteRange string) (*S3Object, error)
+	Put(ctx context.Context, key string, reader io.Reader, size int64, options S3PutOptions) error
+	Delete(ctx context.Context, visitor S3DeleteResultVisitor, keys ...string) error
+	Copy(ctx context.Context, sourceKey string, targetKey string) error
+}
+
+// ResumableStore is implemented by stores whose multipart uploads can be
+// resumed, see S3Bucket.UploadResumable.
+type ResumableStore interface {
+	UploadResumable(ctx context.Context, key string, reader io.Reader, size int64, options S3PutOptions, upload *S3MultipartUpload, visitor S3MultipartVisitor) error
+	AbortUpload(ctx context.Context, upload *S3MultipartUpload) error
+}
+
+var (
+	_ ObjectStore    = S3Bucket{}
+	_ ResumableStore = S3Bucket{}
+	_ ObjectStore    = &MemoryStore{}
+	_ ObjectStore    = &FileStore{}
+)
+
+// ErrNoSuchKey is returned by the local stores for missing objects.
+var ErrNoSuchKey = errors.New("no such key")
+
+const defaultFetchSize = 1000
+
+// visitItems passes items sorted by key to the visitor in pages of fetchSize,
+// the continuation token of a page is the last key visited before.
+func visitItems(items []S3Item, prefix string, continuationToken string, fetchSize int, visitor S3ListBucketResultVisitor) error {
+	if fetchSize <= 0 {
+		fetchSize = defaultFetchSize
+	}
+	start := sort.Search(len(items), func(i int) bool { return items[i].Key > continuationToken })
+	for {
+		end := start + fetchSize
+		if end > len(items) {
+			end = len(items)
+		}
+		rlt := S3ListBucketResult{
+			Prefix:            prefix,
+			MaxKeys:           fetchSize,
+			KeyCount:          end - start,
+			IsTruncated:       end < len(items),
+			ContinuationToken: continuationToken,
+			Contents:          items[start:end],
+		}
+		if rlt.IsTruncated {
+			rlt.NextContinuationToken = items[end-1].Key
+		}
+		b, err := visitor.VisitListing(&rlt)
+		if err != nil || !b || !rlt.IsTruncated {
+			return err
+		}
+		continuationToken = rlt.NextContinuationToken
+		start = end
+	}
+}
+
+// parseByteRange resolves a HTTP range of the bytes of an object of the
+// given size to the first and the last byte (both inclusive).
+func parseByteRange(byteRange string, size int64) (int64, int64, error) {
+	spec := strings.TrimPrefix(byteRange, "bytes=")
+	parts := strings.SplitN(spec, "-", 2)
+	if spec == byteRange || len(parts) != 2 || strings.Contains(spec, ",") {
+		return 0, 0, fmt.Errorf("unsupported range '%s'", byteRange)
+	}
+	if parts[0] == "" {
+		n, err := strconv.ParseInt(parts[1], 10, 64)
+		if err != nil || n <= 0 {
+			return 0, 0, fmt.Errorf("invalid range '%s'", byteRange)
+		}
+		if n > size {
+			n = size
+		}
+		return size - n, size - 1, nil
+	}
+	start, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil || start < 0 || start >= size {
+		return 0, 0, fmt.Errorf("range '%s' not satisfiable", byteRange)
+	}
+	end := size - 1
+	if parts[1] != "" {
+		end, err = strconv.ParseInt(parts[1], 10, 64)
+		if err != nil || end < start {
+			return 0, 0, fmt.Errorf("invalid range '%s'", byteRange)
+		}
+		if end >= size {
+			end = size - 1
+		}
+	}
+	return start, end, nil
+}
+
+// contentRange formats the Content-Range of a partial object.
+func contentRange(start int64, end int64, size int64) string {
+	return fmt.Sprintf("bytes %d-%d/%d", start, end, size)
+}
+
+func md5ETag(content []byte) string {
+	return fmt.Sprintf("\"%x\"", md5.Sum(content))
+}
@@ -0,0 +1,181 @@
+package s3
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// localStores returns the stores standing in for buckets, each empty.
+func localStores(t *testing.T) map[string]ObjectStore {
+	return map[string]ObjectStore{
+		"memory": NewMemoryStore(),
+		"file":   NewFileStore(t.TempDir()),
+	}
+}
+
+func put(t *testing.T, store ObjectStore, key string, content string, options S3PutOptions) {
+	t.Helper()
+	err := store.Put(context.Background(), key, strings.NewReader(content), int64(len(content)), options)
+	if err != nil {
+		t.Fatalf("putting %s failed: %v", key, err)
+	}
+}
+
+func get(t *testing.T, store ObjectStore, key string, byteRange string) (*S3Object, string) {
+	t.Helper()
+	obj, err := store.Get(context.Background(), key, byteRange)
+	if err != nil {
+		t.Fatalf("getting %s failed: %v", key, err)
+	}
+	defer obj.Body.Close()
+	b, err := ioutil.ReadAll(obj.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return obj, string(b)
+}
+
+// stoppingVisitor stops listings after the given number of pages.
+type stoppingVisitor struct {
+	collectingVisitor
+	stopAfter int
+}
+
+func (sv *stoppingVisitor) VisitListing(partialResult *S3ListBucketResult) (bool, error) {
+	sv.collectingVisitor.VisitListing(partialResult)
+	return len(sv.pages) < sv.stopAfter, nil
+}
+
+type deleteResultVisitor func(partialResult *S3DeleteResult) error
+
+func (visit deleteResultVisitor) VisitDeletion(partialResult *S3DeleteResult) error {
+	return visit(partialResult)
+}
+
+func TestStoreListFrom(t *testing.T) {
+	for name, store := range localStores(t) {
+		t.Run(name, func(t *testing.T) {
+			for _, key := range []string{"a/1", "a/2", "a/3", "a-b", "b/4", "a/5"} {
+				put(t, store, key, key, S3PutOptions{})
+			}
+			first := &stoppingVisitor{stopAfter: 1}
+			err := store.List(context.Background(), "a/", 2, first)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(first.keys, []string{"a/1", "a/2"}) || !first.pages[0].IsTruncated {
+				t.Fatalf("first page is %v, expected the truncated page [a/1 a/2]", first.keys)
+			}
+			rest := &collectingVisitor{}
+			err = store.ListFrom(context.Background(), "a/", first.pages[0].NextContinuationToken, 2, rest)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(rest.keys, []string{"a/3", "a/5"}) || len(rest.pages) != 1 || rest.pages[0].IsTruncated {
+				t.Errorf("continued listing is %v in %d page(s), expected [a/3 a/5] in 1 page", rest.keys, len(rest.pages))
+			}
+		})
+	}
+}
+
+func TestStoreGetRange(t *testing.T) {
+	tests := []struct {
+		byteRange    string
+		content      string
+		contentRange string
+	}{
+		{"", "0123456789", ""},
+		{"bytes=2-4", "234", "bytes 2-4/10"},
+		{"bytes=7-", "789", "bytes 7-9/10"},
+		{"bytes=-3", "789", "bytes 7-9/10"},
+		{"bytes=8-20", "89", "bytes 8-9/10"},
+	}
+	for name, store := range localStores(t) {
+		t.Run(name, func(t *testing.T) {
+			put(t, store, "digits", "0123456789", S3PutOptions{})
+			for _, test := range tests {
+				obj, content := get(t, store, "digits", test.byteRange)
+				if content != test.content || obj.ContentRange != test.contentRange || obj.Size != int64(len(test.content)) {
+					t.Errorf("range %q returned %q (%s, %d bytes), expected %q (%s)", test.byteRange, content, obj.ContentRange, obj.Size, test.content, test.contentRange)
+				}
+			}
+			_, err := store.Get(context.Background(), "digits", "bytes=10-")
+			if err == nil {
+				t.Error("range beyond the object succeeded")
+			}
+			_, err = store.Get(context.Background(), "missing", "")
+			if !errors.Is(err, ErrNoSuchKey) {
+				t.Errorf("getting a missing object returned %v, expected ErrNoSuchKey", err)
+			}
+		})
+	}
+}
+
+func TestStoreCopyKeepsMetadata(t *testing.T) {
+	options := S3PutOptions{
+		ContentType:     "text/csv",
+		ContentEncoding: "gzip",
+		Metadata:        map[string]string{"origin": "test"},
+	}
+	for name, store := range localStores(t) {
+		t.Run(name, func(t *testing.T) {
+			put(t, store, "src/data.csv", "a,b\n", options)
+			err := store.Copy(context.Background(), "src/data.csv", "dst/data.csv")
+			if err != nil {
+				t.Fatal(err)
+			}
+			source, _ := get(t, store, "src/data.csv", "")
+			obj, content := get(t, store, "dst/data.csv", "")
+			if content != "a,b\n" {
+				t.Errorf("copy has content %q", content)
+			}
+			if obj.ContentType != "text/csv" || obj.ContentEncoding != "gzip" || !reflect.DeepEqual(obj.Metadata, options.Metadata) {
+				t.Errorf("copy has header %s, %s, %v, expected the ones of the source", obj.ContentType, obj.ContentEncoding, obj.Metadata)
+			}
+			if obj.ETag != source.ETag {
+				t.Errorf("copy has ETag %s, expected %s", obj.ETag, source.ETag)
+			}
+		})
+	}
+}
+
+func TestStoreDelete(t *testing.T) {
+	for name, store := range localStores(t) {
+		t.Run(name, func(t *testing.T) {
+			put(t, store, "a/b/c", "c", S3PutOptions{})
+			put(t, store, "d", "d", S3PutOptions{})
+			var deleted []string
+			err := store.Delete(context.Background(), deleteResultVisitor(func(rlt *S3DeleteResult) error {
+				for _, d := range rlt.Deleted {
+					deleted = append(deleted, d.Key)
+				}
+				if len(rlt.Error) > 0 {
+					t.Errorf("deletion failed for %v", rlt.Error)
+				}
+				return nil
+			}), "a/b/c", "missing")
+			if err != nil {
+				t.Fatal(err)
+			}
+			// deleting missing objects succeeds like with S3
+			if !reflect.DeepEqual(deleted, []string{"a/b/c", "missing"}) {
+				t.Errorf("deleted %v, expected [a/b/c missing]", deleted)
+			}
+			visitor := &collectingVisitor{}
+			if err := store.List(context.Background(), "", 10, visitor); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(visitor.keys, []string{"d"}) {
+				t.Errorf("listing after deletion is %v, expected [d]", visitor.keys)
+			}
+			_, err = store.Head(context.Background(), "a/b/c")
+			if !errors.Is(err, ErrNoSuchKey) {
+				t.Errorf("deleted object is still there: %v", err)
+			}
+		})
+	}
+}
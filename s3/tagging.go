@@ -0,0 +1,136 @@
+package s3
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// limits of the tags of an object
+const (
+	MaxTags           = 10
+	MaxTagKeyLength   = 128
+	MaxTagValueLength = 256
+)
+
+type S3Tag struct {
+	Key   string `xml:"Key"`
+	Value string `xml:"Value"`
+}
+
+type s3Tagging struct {
+	XMLName xml.Name `xml:"http://s3.amazonaws.com/doc/2006-03-01/ Tagging"`
+	TagSet  []S3Tag  `xml:"TagSet>Tag"`
+}
+
+// ValidateTags checks the tags against the limits of S3, keys with the
+// prefix aws: are reserved.
+func ValidateTags(tags map[string]string) error {
+	if len(tags) > MaxTags {
+		return fmt.Errorf("%d tags exceed the maximum of %d tags per object", len(tags), MaxTags)
+	}
+	for k, v := range tags {
+		switch {
+		case k == "" || len([]rune(k)) > MaxTagKeyLength:
+			return fmt.Errorf("tag key '%s' must have 1 to %d characters", k, MaxTagKeyLength)
+		case len([]rune(v)) > MaxTagValueLength:
+			return fmt.Errorf("value of tag '%s' exceeds %d characters", k, MaxTagValueLength)
+		case strings.HasPrefix(strings.ToLower(k), "aws:"):
+			return fmt.Errorf("tag key '%s' uses the reserved prefix aws:", k)
+		}
+	}
+	return nil
+}
+
+// encodeTags encodes tags as query string for the X-Amz-Tagging header.
+func encodeTags(tags map[string]string) string {
+	values := url.Values{}
+	for k, v := range tags {
+		values.Set(k, v)
+	}
+	return canonicalQuery(values)
+}
+
+// decodeTags is the inverse of encodeTags.
+func decodeTags(s string) (map[string]string, error) {
+	values, err := url.ParseQuery(s)
+	if err != nil {
+		return nil, err
+	}
+	tags := make(map[string]string)
+	for k, v := range values {
+		tags[k] = v[0]
+	}
+	return tags, nil
+}
+
+// newTagging orders the tags by their keys.
+func newTagging(tags map[string]string) s3Tagging {
+	var tagging s3Tagging
+	for k, v := range tags {
+		tagging.TagSet = append(tagging.TagSet, S3Tag{Key: k, Value: v})
+	}
+	sort.Slice(tagging.TagSet, func(i, j int) bool { return tagging.TagSet[i].Key < tagging.TagSet[j].Key })
+	return tagging
+}
+
+func unmarshalTagging(b []byte) (map[string]string, error) {
+	var tagging s3Tagging
+	err := xml.Unmarshal(b, &tagging)
+	if err != nil {
+		return nil, err
+	}
+	tags := make(map[string]string)
+	for _, tag := range tagging.TagSet {
+		tags[tag.Key] = tag.Value
+	}
+	return tags, nil
+}
+
+// https://docs.aws.amazon.com/AmazonS3/latest/API/API_GetObjectTagging.html
+func (bucket S3Bucket) GetTags(ctx context.Context, key string) (map[string]string, error) {
+	reqUrl, err := url.Parse(bucket.Endpoint + "/" + key + "?tagging")
+	if err != nil {
+		return nil, err
+	}
+	resp, err := curl(ctx, bucket, "GET", reqUrl, http.NoBody, nil)
+	if err != nil {
+		return nil, err
+	}
+	return unmarshalTagging(resp.Bytes())
+}
+
+// https://docs.aws.amazon.com/AmazonS3/latest/API/API_PutObjectTagging.html
+//
+// The tags replace all tags of the object.
+func (bucket S3Bucket) PutTags(ctx context.Context, key string, tags map[string]string) error {
+	err := ValidateTags(tags)
+	if err != nil {
+		return err
+	}
+	reqUrl, err := url.Parse(bucket.Endpoint + "/" + key + "?tagging")
+	if err != nil {
+		return err
+	}
+	b, err := xml.Marshal(newTagging(tags))
+	if err != nil {
+		return err
+	}
+	_, err = curl(ctx, bucket, "PUT", reqUrl, bytes.NewReader(b), nil)
+	return err
+}
+
+// https://docs.aws.amazon.com/AmazonS3/latest/API/API_DeleteObjectTagging.html
+func (bucket S3Bucket) DeleteTags(ctx context.Context, key string) error {
+	reqUrl, err := url.Parse(bucket.Endpoint + "/" + key + "?tagging")
+	if err != nil {
+		return err
+	}
+	_, err = curl(ctx, bucket, "DELETE", reqUrl, http.NoBody, nil)
+	return err
+}
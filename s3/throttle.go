@@ -0,0 +1,141 @@
+package s3
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+)
+
+// throttleChunk bounds the bytes read at once, so transfers are slowed down
+// smoothly instead of stalling for long.
+const throttleChunk = 32 * 1024
+
+// Throttle limits the bandwidth and the request rate of all requests to the
+// buckets sharing it, a zero limit disables the respective throttling.
+type Throttle struct {
+	bytes    *tokenBucket
+	requests *tokenBucket
+}
+
+// NewThrottle creates a throttle for the given bytes and requests per second.
+func NewThrottle(bytesPerSecond int64, requestsPerSecond float64) *Throttle {
+	t := &Throttle{}
+	if bytesPerSecond > 0 {
+		t.bytes = newTokenBucket(float64(bytesPerSecond), float64(bytesPerSecond))
+	}
+	if requestsPerSecond > 0 {
+		burst := requestsPerSecond
+		if burst < 1 {
+			burst = 1
+		}
+		t.requests = newTokenBucket(requestsPerSecond, burst)
+	}
+	return t
+}
+
+// waitForRequest blocks until another request may be sent.
+func (t *Throttle) waitForRequest(ctx context.Context) error {
+	if t == nil || t.requests == nil {
+		return nil
+	}
+	return t.requests.take(ctx, 1)
+}
+
+// readCloser limits the bandwidth of reading from rc.
+func (t *Throttle) readCloser(ctx context.Context, rc io.ReadCloser) io.ReadCloser {
+	if t == nil || t.bytes == nil || rc == nil {
+		return rc
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{&throttledReader{ctx: ctx, r: rc, tb: t.bytes}, rc}
+}
+
+type throttledReader struct {
+	ctx context.Context
+	r   io.Reader
+	tb  *tokenBucket
+}
+
+func (tr *throttledReader) Read(b []byte) (int, error) {
+	if len(b) > throttleChunk {
+		b = b[:throttleChunk]
+	}
+	n, err := tr.r.Read(b)
+	if terr := tr.tb.take(tr.ctx, float64(n)); terr != nil {
+		return n, terr
+	}
+	return n, err
+}
+
+// Override returns a throttle sharing the limits of o, and the ones of t
+// which o does not set.
+func (t *Throttle) Override(o *Throttle) *Throttle {
+	if t == nil {
+		return o
+	}
+	if o == nil {
+		return t
+	}
+	rlt := *t
+	if o.bytes != nil {
+		rlt.bytes = o.bytes
+	}
+	if o.requests != nil {
+		rlt.requests = o.requests
+	}
+	return &rlt
+}
+
+// tokenBucket refills at rate tokens per second up to burst tokens. Takers
+// may overdraw it and wait until the debt is paid off, which keeps large
+// takes from starving. The clock is replaced by tests.
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+	now    func() time.Time
+	sleep  func(ctx context.Context, d time.Duration) error
+}
+
+func newTokenBucket(rate float64, burst float64) *tokenBucket {
+	return &tokenBucket{rate: rate, burst: burst, tokens: burst, last: time.Now(), now: time.Now, sleep: sleep}
+}
+
+// take withdraws n tokens and waits until they are available, unless the
+// context is done before.
+func (tb *tokenBucket) take(ctx context.Context, n float64) error {
+	tb.mu.Lock()
+	now := tb.now()
+	tb.tokens += now.Sub(tb.last).Seconds() * tb.rate
+	if tb.tokens > tb.burst {
+		tb.tokens = tb.burst
+	}
+	tb.last = now
+	tb.tokens -= n
+	var wait time.Duration
+	if tb.tokens < 0 {
+		wait = time.Duration(-tb.tokens / tb.rate * float64(time.Second))
+	}
+	tb.mu.Unlock()
+	if wait <= 0 {
+		return nil
+	}
+	return tb.sleep(ctx, wait)
+}
+
+// sleep waits for d unless the context is done before.
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
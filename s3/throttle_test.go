@@ -0,0 +1,134 @@
+package s3
+
+import (
+	"context"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeClock advances by the durations slept instead of waiting.
+type fakeClock struct {
+	now   time.Time
+	slept []time.Duration
+}
+
+func (c *fakeClock) sleep(ctx context.Context, d time.Duration) error {
+	c.slept = append(c.slept, d)
+	c.now = c.now.Add(d)
+	return ctx.Err()
+}
+
+func newFakeTokenBucket(rate float64, burst float64) (*tokenBucket, *fakeClock) {
+	c := &fakeClock{now: time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)}
+	tb := newTokenBucket(rate, burst)
+	tb.last = c.now
+	tb.now = func() time.Time { return c.now }
+	tb.sleep = c.sleep
+	return tb, c
+}
+
+func TestTokenBucket(t *testing.T) {
+	tb, c := newFakeTokenBucket(100, 100)
+	ctx := context.Background()
+	steps := []struct {
+		advance time.Duration
+		take    float64
+		wait    time.Duration
+	}{
+		// the burst is available at once
+		{0, 100, 0},
+		// overdrawn tokens are waited for
+		{0, 50, 500 * time.Millisecond},
+		{0, 1, 10 * time.Millisecond},
+		// the bucket refills at the rate
+		{200 * time.Millisecond, 20, 0},
+		{0, 1, 10 * time.Millisecond},
+		// up to the burst only
+		{time.Hour, 100, 0},
+		{0, 1, 10 * time.Millisecond},
+		// takes larger than the burst are served as well
+		{time.Hour, 300, 2 * time.Second},
+		{0, 0, 0},
+	}
+	for i, step := range steps {
+		c.now = c.now.Add(step.advance)
+		c.slept = nil
+		if err := tb.take(ctx, step.take); err != nil {
+			t.Fatal(err)
+		}
+		var wait time.Duration
+		for _, d := range c.slept {
+			wait += d
+		}
+		if wait != step.wait {
+			t.Errorf("step %d: taking %g waited %v, expected %v", i, step.take, wait, step.wait)
+		}
+	}
+}
+
+func TestTokenBucketCancelled(t *testing.T) {
+	tb, _ := newFakeTokenBucket(10, 10)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := tb.take(ctx, 10); err != nil {
+		t.Errorf("taking available tokens failed: %v", err)
+	}
+	if err := tb.take(ctx, 1); err != context.Canceled {
+		t.Errorf("waiting with a cancelled context returned %v", err)
+	}
+	if err := sleep(ctx, time.Hour); err != context.Canceled {
+		t.Errorf("sleeping with a cancelled context returned %v", err)
+	}
+}
+
+func TestThrottleLimits(t *testing.T) {
+	var unlimited *Throttle
+	ctx := context.Background()
+	if err := unlimited.waitForRequest(ctx); err != nil {
+		t.Error(err)
+	}
+	rc := ioutil.NopCloser(strings.NewReader("x"))
+	if unlimited.readCloser(ctx, rc) != rc || NewThrottle(0, 0).readCloser(ctx, rc) != rc {
+		t.Error("reading without bandwidth limit is throttled")
+	}
+	if throttle := NewThrottle(0, 0.5); throttle.bytes != nil || throttle.requests.burst != 1 || throttle.requests.rate != 0.5 {
+		t.Errorf("request limit below 1 allows bursts of %g", throttle.requests.burst)
+	}
+
+	throttle := NewThrottle(4, 0)
+	tb, c := newFakeTokenBucket(4, 4)
+	throttle.bytes = tb
+	r := throttle.readCloser(ctx, ioutil.NopCloser(strings.NewReader(strings.Repeat("x", 12))))
+	b, err := ioutil.ReadAll(r)
+	if err != nil || len(b) != 12 {
+		t.Fatalf("read %d bytes (%v)", len(b), err)
+	}
+	if !reflect.DeepEqual(c.slept, []time.Duration{2 * time.Second}) {
+		t.Errorf("reading 12 bytes at 4 bytes per second slept %v", c.slept)
+	}
+
+	chunks := NewThrottle(1<<30, 0)
+	r = chunks.readCloser(ctx, ioutil.NopCloser(strings.NewReader(strings.Repeat("x", 2*throttleChunk))))
+	if n, _ := r.Read(make([]byte, 2*throttleChunk)); n != throttleChunk {
+		t.Errorf("read %d bytes at once, expected at most %d", n, throttleChunk)
+	}
+}
+
+func TestThrottleOverride(t *testing.T) {
+	bucket := NewThrottle(100, 10)
+	global := NewThrottle(1000, 0)
+	var none *Throttle
+	if none.Override(global) != global || bucket.Override(none) != bucket {
+		t.Error("overriding by or of no throttle created a new one")
+	}
+	combined := bucket.Override(global)
+	if combined.bytes != global.bytes || combined.requests != bucket.requests {
+		t.Error("the bandwidth limit of the command line does not override the one of the bucket")
+	}
+	if bucket.bytes.rate != 100 || global.requests != nil {
+		t.Error("overriding changed the throttles")
+	}
+}
@@ -0,0 +1,196 @@
+package s3
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// S3ObjectVersion is a version of an object or a delete marker, which has
+// neither size nor ETag.
+type S3ObjectVersion struct {
+	Key          string    `xml:"Key"`
+	VersionId    string    `xml:"VersionId"`
+	IsLatest     bool      `xml:"IsLatest"`
+	LastModified time.Time `xml:"LastModified"`
+	ETag         string    `xml:"ETag"`
+	Size         int64     `xml:"Size"`
+	Owner        S3Owner   `xml:"Owner"`
+	StorageClass string    `xml:"StorageClass"`
+	DeleteMarker bool      `xml:"-"`
+}
+
+type S3ListVersionsResult struct {
+	Name                string            `xml:"Name"`
+	Prefix              string            `xml:"Prefix"`
+	KeyMarker           string            `xml:"KeyMarker"`
+	VersionIdMarker     string            `xml:"VersionIdMarker"`
+	NextKeyMarker       string            `xml:"NextKeyMarker"`
+	NextVersionIdMarker string            `xml:"NextVersionIdMarker"`
+	MaxKeys             int               `xml:"MaxKeys"`
+	IsTruncated         bool              `xml:"IsTruncated"`
+	Versions            []S3ObjectVersion `xml:"Version"`
+	DeleteMarkers       []S3ObjectVersion `xml:"DeleteMarker"`
+}
+
+// Entries returns the versions and the delete markers in the order of the
+// listing, by key and from the latest to the oldest.
+func (rlt *S3ListVersionsResult) Entries() []S3ObjectVersion {
+	entries := make([]S3ObjectVersion, 0, len(rlt.Versions)+len(rlt.DeleteMarkers))
+	entries = append(entries, rlt.Versions...)
+	for _, marker := range rlt.DeleteMarkers {
+		marker.DeleteMarker = true
+		entries = append(entries, marker)
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+		if a.Key != b.Key {
+			return a.Key < b.Key
+		}
+		if a.IsLatest != b.IsLatest {
+			return a.IsLatest
+		}
+		return a.LastModified.After(b.LastModified)
+	})
+	return entries
+}
+
+type S3ListVersionsResultVisitor interface {
+	VisitVersions(partialResult *S3ListVersionsResult) (bool, error)
+}
+
+type s3VersioningStatus struct {
+	Status string `xml:"Status"`
+}
+
+// https://docs.aws.amazon.com/AmazonS3/latest/API/API_ListObjectVersions.html
+func (bucket S3Bucket) ListVersions(ctx context.Context, prefix string, fetchSize int, visitor S3ListVersionsResultVisitor) error {
+	keyMarker := ""
+	versionIdMarker := ""
+	for {
+		query := url.Values{}
+		query.Set("versions", "")
+		query.Set("prefix", prefix)
+		query.Set("max-keys", strconv.Itoa(fetchSize))
+		if keyMarker != "" {
+			query.Set("key-marker", keyMarker)
+			query.Set("version-id-marker", versionIdMarker)
+		}
+		reqUrl, err := url.Parse(bucket.Endpoint + "/?" + canonicalQuery(query))
+		if err != nil {
+			return err
+		}
+		resp, err := curl(ctx, bucket, "GET", reqUrl, http.NoBody, nil)
+		if err != nil {
+			return err
+		}
+		var rlt S3ListVersionsResult
+		err = xml.Unmarshal(resp.Bytes(), &rlt)
+		if err != nil {
+			return err
+		}
+		b, err := visitor.VisitVersions(&rlt)
+		if err != nil || !b || !rlt.IsTruncated {
+			return err
+		}
+		keyMarker = rlt.NextKeyMarker
+		versionIdMarker = rlt.NextVersionIdMarker
+	}
+}
+
+// https://docs.aws.amazon.com/AmazonS3/latest/API/API_GetObject.html
+//
+// GetVersion gets a version of the object like Get gets the latest one.
+func (bucket S3Bucket) GetVersion(ctx context.Context, key string, versionId string, byteRange string) (*S3Object, error) {
+	reqUrl, err := url.Parse(bucket.Endpoint + "/" + key)
+	if err != nil {
+		return nil, err
+	}
+	if versionId != "" {
+		reqUrl.RawQuery = canonicalQuery(url.Values{"versionId": []string{versionId}})
+	}
+	header := make(map[string]string)
+	if byteRange != "" {
+		header["Range"] = byteRange
+	}
+	resp, err := send(ctx, bucket, "GET", reqUrl, http.NoBody, header)
+	if err != nil {
+		return nil, err
+	}
+	return newS3Object(key, resp), nil
+}
+
+// https://docs.aws.amazon.com/AmazonS3/latest/API/API_CopyObject.html
+//
+// RestoreVersion copies a version of the object on top of it, which makes
+// the copy its latest version.
+func (bucket S3Bucket) RestoreVersion(ctx context.Context, key string, versionId string) error {
+	reqUrl, err := url.Parse(bucket.Endpoint + "/" + key)
+	if err != nil {
+		return err
+	}
+	source := &url.URL{Path: "/" + bucket.bucketName() + "/" + key}
+	header := map[string]string{"X-Amz-Copy-Source": source.EscapedPath() + "?versionId=" + url.QueryEscape(versionId)}
+	resp, err := curl(ctx, bucket, "PUT", reqUrl, http.NoBody, header)
+	if err != nil {
+		return err
+	}
+	// errors might be reported after the response status has been sent
+	var rlt S3Error
+	if xml.Unmarshal(resp.Bytes(), &rlt) == nil && rlt.Code != "" {
+		return fmt.Errorf("restoring version %s of %s failed: %s -> %s", versionId, key, rlt.Code, rlt.Message)
+	}
+	return nil
+}
+
+// https://docs.aws.amazon.com/AmazonS3/latest/API/API_DeleteObject.html
+//
+// DeleteVersion removes a version of the object permanently, deleting its
+// latest delete marker restores the object.
+func (bucket S3Bucket) DeleteVersion(ctx context.Context, key string, versionId string) error {
+	reqUrl, err := url.Parse(bucket.Endpoint + "/" + key)
+	if err != nil {
+		return err
+	}
+	reqUrl.RawQuery = canonicalQuery(url.Values{"versionId": []string{versionId}})
+	_, err = curl(ctx, bucket, "DELETE", reqUrl, http.NoBody, nil)
+	return err
+}
+
+// https://docs.aws.amazon.com/AmazonS3/latest/API/API_DeleteObjects.html
+//
+// DeleteVersions removes the versions and delete markers permanently in
+// batches like Delete.
+func (bucket S3Bucket) DeleteVersions(ctx context.Context, visitor S3DeleteResultVisitor, versions ...S3ObjectVersion) error {
+	objects := make([]s3ObjectIdentifier, 0, len(versions))
+	for _, v := range versions {
+		objects = append(objects, s3ObjectIdentifier{Key: v.Key, VersionId: v.VersionId})
+	}
+	return bucket.deleteObjects(ctx, visitor, objects)
+}
+
+// https://docs.aws.amazon.com/AmazonS3/latest/API/API_GetBucketVersioning.html
+//
+// The status is empty for buckets whose versioning has never been enabled.
+func (bucket S3Bucket) GetVersioning(ctx context.Context) (string, error) {
+	reqUrl, err := url.Parse(bucket.Endpoint + "/?versioning")
+	if err != nil {
+		return "", err
+	}
+	resp, err := curl(ctx, bucket, "GET", reqUrl, http.NoBody, nil)
+	if err != nil {
+		return "", err
+	}
+	var rlt s3VersioningStatus
+	err = xml.Unmarshal(bytes.TrimSpace(resp.Bytes()), &rlt)
+	if err != nil {
+		return "", err
+	}
+	return rlt.Status, nil
+}
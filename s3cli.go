@@ -1,6 +1,7 @@
 package main
 
 import (
+	"os"
 	"s3cli/cmd"
 
 	log "github.com/sirupsen/logrus"
@@ -30,5 +31,5 @@ func init() {
 }
 
 func main() {
-	cmd.Execute()
+	os.Exit(cmd.Execute())
 }